@@ -3,12 +3,14 @@ package app
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"time"
 
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
 	"github.com/google/uuid"
 	"github.com/kkonst40/isso/internal/config"
 	pb "github.com/kkonst40/isso/internal/gen/user"
@@ -23,30 +25,144 @@ import (
 )
 
 type App struct {
-	httpServer *http.Server
-	grpcServer *grpc.Server
-	grpcPort   string
-	db         *sql.DB
+	httpServer     *http.Server
+	grpcServer     *grpc.Server
+	grpcPort       string
+	db             *sql.DB
+	keyService     *service.KeyService
+	oidcService    *service.OIDCService
+	logoutService  *service.LogoutService
+	passkeyService *service.WebAuthnService
+	mailer         *utils.AsyncMailer
+	emailLogin     *service.EmailLoginService
+	emailService   *service.EmailService
+	resetService   *service.PasswordResetService
+	// cancels background jobs on shutdown
+	bgCtx    context.Context
+	bgCancel context.CancelFunc
 }
 
 func New(cfg *config.Config) (*App, error) {
+	jwtProvider, err := utils.NewJWTProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	adminID := uuid.Nil
+	if cfg.AdminID != "" {
+		adminID, err = uuid.Parse(cfg.AdminID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid admin ID: %w", err)
+		}
+	}
+
+	forwardAuthService, err := service.NewForwardAuthService(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var secretBox *utils.SecretBox
+	if cfg.MFA.EncryptionKey != "" {
+		key, err := base64.StdEncoding.DecodeString(cfg.MFA.EncryptionKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MFA encryption key: %w", err)
+		}
+		secretBox, err = utils.NewSecretBox(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MFA encryption key: %w", err)
+		}
+	}
+
+	pwdHasher, err := utils.NewPasswordHandler(cfg.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	relyingParty, err := service.NewRelyingParty(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	db, err := SetupDB(cfg.DB.User, cfg.DB.Password, cfg.DB.Host, cfg.DB.DBName)
 	if err != nil {
 		return nil, err
 	}
 
 	var (
-		jwtProvider   = utils.NewJWTProvider(cfg)
-		pwdHasher     = utils.NewPasswordHandler()
 		credValidator = utils.NewValidator(cfg)
+		tokenIDCache  = utils.NewTokenIDCache(time.Duration(cfg.JWT.TokenCacheSeconds) * time.Second)
+		familyCache   = utils.NewFamilyCache(time.Duration(cfg.JWT.TokenCacheSeconds) * time.Second)
+		mailer        = utils.NewAsyncMailer(utils.NewMailer(cfg.Mail))
 	)
 
 	var (
-		userRepo    = repo.New(db)
-		userService = service.New(jwtProvider, pwdHasher, credValidator, userRepo, uuid.UUID{})
-		userHandler = handler.New(userService, cfg)
+		userRepo            = repo.New(db)
+		refreshTokenRepo    = repo.NewRefreshTokenRepo(db)
+		signingKeyRepo      = repo.NewSigningKeyRepo(db)
+		clientRepo          = repo.NewClientRepo(db)
+		authCodeRepo        = repo.NewAuthorizationCodeRepo(db)
+		deviceCodeRepo      = repo.NewDeviceCodeRepo(db)
+		pushedRequestRepo   = repo.NewPushedAuthorizationRequestRepo(db)
+		totpRepo            = repo.NewTOTPRepo(db)
+		passkeyRepo         = repo.NewWebAuthnCredentialRepo(db)
+		passkeySessionRepo  = repo.NewWebAuthnSessionRepo(db)
+		recoveryCodeRepo    = repo.NewRecoveryCodeRepo(db)
+		mfaLockoutRepo      = repo.NewMFALockoutRepo(db)
+		emailLoginRepo      = repo.NewEmailLoginChallengeRepo(db)
+		emailLockoutRepo    = repo.NewEmailLoginLockoutRepo(db)
+		verificationRepo    = repo.NewEmailVerificationRepo(db)
+		resetRepo           = repo.NewPasswordResetRepo(db)
+		logoutRepo          = repo.NewLogoutNotificationRepo(db)
+		consentRepo         = repo.NewConsentGrantRepo(db)
+		initialTokenRepo    = repo.NewInitialAccessTokenRepo(db)
+		keyService          = service.NewKeyService(jwtProvider, signingKeyRepo, cfg, adminID)
+		tokenService        = service.NewTokenService(jwtProvider, userRepo, refreshTokenRepo, tokenIDCache, familyCache)
+		clientService       = service.NewClientService(pwdHasher, clientRepo, adminID)
+		consentService      = service.NewConsentService(consentRepo, refreshTokenRepo)
+		registrationService = service.NewRegistrationService(clientService, clientRepo, initialTokenRepo, adminID)
+		logoutService       = service.NewLogoutService(jwtProvider, tokenService, clientService, userRepo, logoutRepo)
+		mfaService          = service.NewMFAService(jwtProvider, totpRepo, passkeyRepo, recoveryCodeRepo, mfaLockoutRepo, userRepo, secretBox)
+		passkeyService      = service.NewWebAuthnService(relyingParty, mfaService, passkeyRepo, passkeySessionRepo, userRepo)
+		emailLogin          = service.NewEmailLoginService(jwtProvider, mailer, emailLoginRepo, emailLockoutRepo, userRepo)
+		emailService        = service.NewEmailService(mailer, credValidator, verificationRepo, userRepo, cfg)
+		resetService        = service.NewPasswordResetService(logoutService, mailer, pwdHasher, credValidator, resetRepo, userRepo, cfg)
+		userService         = service.New(tokenService, logoutService, mfaService, passkeyService, emailLogin, pwdHasher, credValidator, userRepo, adminID)
+		oidcService         = service.NewOIDCService(jwtProvider, tokenService, clientService, userRepo, authCodeRepo, deviceCodeRepo, pushedRequestRepo)
+		userHandler         = handler.New(userService, cfg)
+		mfaHandler          = handler.NewMFAHandler(mfaService)
+		passkeyHandler      = handler.NewWebAuthnHandler(passkeyService)
+		emailHandler        = handler.NewEmailHandler(emailService)
+		resetHandler        = handler.NewPasswordResetHandler(resetService)
+		keyHandler          = handler.NewKeyHandler(keyService, jwtProvider)
+		oidcHandler         = handler.NewOIDCHandler(oidcService, tokenService, consentService, cfg)
+		clientHandler       = handler.NewClientHandler(clientService)
+		logoutHandler       = handler.NewLogoutHandler(logoutService, tokenService, cfg)
+		consentHandler      = handler.NewConsentHandler(consentService, oidcService, clientService)
+		registrationHandler = handler.NewRegistrationHandler(registrationService, cfg)
+		forwardAuthHandler  = handler.NewForwardAuthHandler(forwardAuthService, tokenService, cfg)
 	)
 
+	if err := keyService.Load(context.Background()); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	auth := func(next http.HandlerFunc) http.HandlerFunc {
+		return middleware.Auth(next, tokenService, cfg.JWT.CookieName)
+	}
+	bearer := func(next http.HandlerFunc) http.HandlerFunc {
+		return middleware.Bearer(next, middleware.TokenValidatorFunc(tokenService.ValidateAccessToken))
+	}
+	// sensitive changes need a recent login, see POST /reauth
+	reauthWindow := time.Duration(cfg.JWT.ReauthWindowMinutes) * time.Minute
+	sudo := func(next http.HandlerFunc) http.HandlerFunc {
+		return auth(middleware.RecentAuth(next, reauthWindow))
+	}
+	apiValidator := middleware.TokenValidatorFunc(tokenService.ValidateAPIToken)
+	api := func(next http.HandlerFunc, scope string) http.HandlerFunc {
+		return middleware.Bearer(middleware.RequireScope(next, scope), apiValidator)
+	}
+
 	mux := http.NewServeMux()
 
 	// for test
@@ -60,36 +176,153 @@ func New(cfg *config.Config) (*App, error) {
 		http.ServeFile(w, r, "static/me.html")
 	})
 
+	mux.HandleFunc("GET /login", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "static/login.html")
+	})
+
+	mux.HandleFunc("GET /mfa", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "static/mfa.html")
+	})
+	mux.HandleFunc("GET /mfa/methods", auth(mfaHandler.Methods))
+	mux.HandleFunc("POST /mfa/totp", sudo(mfaHandler.EnrollTOTP))
+	mux.HandleFunc("POST /mfa/totp/confirm", auth(mfaHandler.ConfirmTOTP))
+	mux.HandleFunc("DELETE /mfa/totp", sudo(mfaHandler.DisableTOTP))
+	mux.HandleFunc("GET /mfa/recovery-codes", auth(mfaHandler.RecoveryCodes))
+	mux.HandleFunc("POST /mfa/recovery-codes", sudo(mfaHandler.RegenerateRecoveryCodes))
+	mux.HandleFunc("GET /passkeys", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "static/passkeys.html")
+	})
+	mux.HandleFunc("GET /webauthn/credentials", auth(passkeyHandler.Credentials))
+	mux.HandleFunc("DELETE /webauthn/credentials/{id}", sudo(passkeyHandler.DeleteCredential))
+	mux.HandleFunc("POST /webauthn/register/begin", sudo(passkeyHandler.BeginRegistration))
+	mux.HandleFunc("POST /webauthn/register/finish", auth(passkeyHandler.FinishRegistration))
+
+	mux.HandleFunc("GET /email", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "static/email.html")
+	})
+	mux.HandleFunc("PUT /email", sudo(emailHandler.RequestChange))
+	mux.HandleFunc("POST /email/verify", emailHandler.Verify)
+
+	mux.HandleFunc("GET /password/forgot", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "static/password_reset.html")
+	})
+	mux.HandleFunc("GET /password/reset", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "static/password_reset.html")
+	})
+	mux.HandleFunc("POST /password/forgot", resetHandler.Forgot)
+	mux.HandleFunc("POST /password/reset", resetHandler.Reset)
+
+	mux.HandleFunc("GET /.well-known/jwks.json", middleware.CORS(keyHandler.JWKS))
+	mux.HandleFunc("GET /.well-known/openid-configuration", middleware.CORS(oidcHandler.Discovery))
+	mux.HandleFunc("GET /userinfo", middleware.CORS(bearer(oidcHandler.UserInfo)))
+	mux.HandleFunc("POST /userinfo", middleware.CORS(bearer(oidcHandler.UserInfo)))
+	mux.HandleFunc("OPTIONS /userinfo", middleware.CORS(oidcHandler.UserInfo))
+	mux.HandleFunc("GET /authorize", oidcHandler.Authorize)
+	mux.HandleFunc("POST /authorize", oidcHandler.Authorize)
+	mux.HandleFunc("POST /token", middleware.CORS(oidcHandler.Token))
+	mux.HandleFunc("OPTIONS /token", middleware.CORS(oidcHandler.Token))
+	mux.HandleFunc("GET /consent", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "static/consent.html")
+	})
+	mux.HandleFunc("GET /consent/request", auth(consentHandler.Request))
+	mux.HandleFunc("GET /grants", auth(consentHandler.All))
+	mux.HandleFunc("DELETE /grants/{clientId}", auth(consentHandler.Delete))
+	mux.HandleFunc("GET /device", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "static/device.html")
+	})
+	mux.HandleFunc("POST /device/code", oidcHandler.DeviceCode)
+	mux.HandleFunc("GET /device/verify", auth(oidcHandler.DeviceVerification))
+	mux.HandleFunc("POST /device/verify", auth(oidcHandler.DeviceDecide))
+	mux.HandleFunc("GET /logout/confirm", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "static/logout_confirm.html")
+	})
+	mux.HandleFunc("GET /end_session", logoutHandler.EndSession)
+	mux.HandleFunc("POST /end_session", logoutHandler.EndSession)
+	mux.HandleFunc("POST /register-client", registrationHandler.Register)
+	mux.HandleFunc("GET /register-client/{id}", registrationHandler.Get)
+	mux.HandleFunc("PUT /register-client/{id}", registrationHandler.Update)
+	mux.HandleFunc("DELETE /register-client/{id}", registrationHandler.Delete)
+	mux.HandleFunc("POST /par", oidcHandler.PushAuthorization)
+	mux.HandleFunc("GET /forward-auth", forwardAuthHandler.Check)
+	mux.HandleFunc("GET /forward-auth/return", forwardAuthHandler.Return)
+	mux.HandleFunc("POST /introspect", oidcHandler.Introspect)
+	mux.HandleFunc("POST /revoke", middleware.CORS(oidcHandler.Revoke))
+	mux.HandleFunc("OPTIONS /revoke", middleware.CORS(oidcHandler.Revoke))
+
 	mux.HandleFunc("GET /all", userHandler.All)
-	mux.HandleFunc("GET /me", middleware.Auth(userHandler.Me, jwtProvider))
-	mux.HandleFunc("POST /exist", userHandler.Exist)
+	mux.HandleFunc("GET /me", auth(userHandler.Me))
+	mux.HandleFunc("POST /exist", api(userHandler.Exist, utils.ScopeUsersRead))
 	mux.HandleFunc("POST /login", userHandler.Login)
-	mux.HandleFunc("POST /logout", middleware.Auth(userHandler.Logout, jwtProvider))
+	mux.HandleFunc("POST /login/totp", userHandler.LoginTOTP)
+	mux.HandleFunc("POST /login/recovery-code", userHandler.LoginRecoveryCode)
+	mux.HandleFunc("POST /login/email", userHandler.StartEmailLogin)
+	mux.HandleFunc("POST /login/email/code", userHandler.LoginEmailCode)
+	mux.HandleFunc("POST /login/email/link", userHandler.LoginEmailLink)
+	mux.HandleFunc("POST /login/webauthn/begin", userHandler.BeginLoginWebAuthn)
+	mux.HandleFunc("POST /login/webauthn/finish", userHandler.LoginWebAuthn)
+	mux.HandleFunc("POST /reauth", auth(userHandler.Reauthenticate))
+	mux.HandleFunc("POST /logout", auth(userHandler.Logout))
 	mux.HandleFunc("POST /register", userHandler.Create)
-	mux.HandleFunc("PUT /updatelogin", middleware.Auth(userHandler.UpdateLogin, jwtProvider))
-	mux.HandleFunc("PUT /updatepassword", middleware.Auth(userHandler.UpdatePassword, jwtProvider))
-	mux.HandleFunc("DELETE /{id}", middleware.Auth(userHandler.Delete, jwtProvider))
+	mux.HandleFunc("POST /token/refresh", userHandler.Refresh)
+	mux.HandleFunc("PUT /updatelogin", sudo(userHandler.UpdateLogin))
+	mux.HandleFunc("PUT /updatepassword", sudo(userHandler.UpdatePassword))
+	mux.HandleFunc("DELETE /{id}", sudo(userHandler.Delete))
+
+	mux.HandleFunc("GET /admin/keys", auth(keyHandler.All))
+	mux.HandleFunc("POST /admin/keys/rotate", auth(keyHandler.Rotate))
+	mux.HandleFunc("POST /admin/keys/prune", auth(keyHandler.Prune))
+	mux.HandleFunc("GET /admin/clients", auth(clientHandler.All))
+	mux.HandleFunc("POST /admin/clients", auth(clientHandler.Create))
+	mux.HandleFunc("DELETE /admin/clients/{id}", auth(clientHandler.Delete))
+	mux.HandleFunc("POST /admin/registration-tokens", auth(registrationHandler.CreateInitialToken))
 
 	httpServer := &http.Server{
 		Addr:    ":" + cfg.HttpPort,
 		Handler: middleware.Timeout(mux, 3*time.Second),
 	}
 
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(middleware.GRPCAuth(apiValidator, map[string]string{
+		pb.UserService_Exist_FullMethodName: utils.ScopeUsersRead,
+	})))
 	userGRPC := handler.NewUserGRPCHandler(userService)
 	pb.RegisterUserServiceServer(grpcServer, userGRPC)
+	tokenGRPC := handler.NewTokenGRPCHandler(oidcService)
+	pb.RegisterTokenServiceServer(grpcServer, tokenGRPC)
+	authzGRPC := handler.NewAuthzGRPCHandler(tokenService, cfg)
+	authv3.RegisterAuthorizationServer(grpcServer, authzGRPC)
+
+	bgCtx, bgCancel := context.WithCancel(context.Background())
 
 	return &App{
-		httpServer: httpServer,
-		grpcServer: grpcServer,
-		grpcPort:   cfg.GrpcPort,
-		db:         db,
+		httpServer:     httpServer,
+		grpcServer:     grpcServer,
+		grpcPort:       cfg.GrpcPort,
+		db:             db,
+		keyService:     keyService,
+		oidcService:    oidcService,
+		logoutService:  logoutService,
+		passkeyService: passkeyService,
+		mailer:         mailer,
+		emailLogin:     emailLogin,
+		emailService:   emailService,
+		resetService:   resetService,
+		bgCtx:          bgCtx,
+		bgCancel:       bgCancel,
 	}, nil
 }
 
 func (a *App) Run() error {
 	errChan := make(chan error, 2)
 
+	go a.keyService.Run(a.bgCtx)
+	go a.oidcService.RunCleanup(a.bgCtx)
+	go a.logoutService.Run(a.bgCtx)
+	go a.passkeyService.RunCleanup(a.bgCtx)
+	go a.mailer.Run(a.bgCtx)
+	go a.emailLogin.RunCleanup(a.bgCtx)
+	go a.emailService.RunCleanup(a.bgCtx)
+	go a.resetService.RunCleanup(a.bgCtx)
+
 	go func() {
 		if err := a.httpServer.ListenAndServe(); err != nil {
 			errChan <- fmt.Errorf("HTTP serve error: %w", err)
@@ -112,6 +345,7 @@ func (a *App) Run() error {
 }
 
 func (a *App) Shutdown(ctx context.Context) {
+	a.bgCancel()
 	a.grpcServer.GracefulStop()
 
 	if err := a.httpServer.Shutdown(ctx); err != nil {
@@ -14,6 +14,31 @@ var (
 	ErrLoginTaken         = errors.New("user already exists")
 	ErrNoPermission       = errors.New("no permission")
 	ErrGeneratingError    = errors.New("generating error")
+	ErrInvalidToken       = errors.New("invalid token")
+	ErrClientNotFound     = errors.New("client not found")
+	ErrClientExists       = errors.New("client already exists")
+	ErrInvalidUserCode    = errors.New("invalid user code")
+	ErrGrantNotFound      = errors.New("grant not found")
+	ErrTOTPNotFound       = errors.New("totp not enabled")
+	ErrTOTPEnabled        = errors.New("totp already enabled")
+	ErrInvalidMFACode     = errors.New("invalid mfa code")
+	ErrMFALocked          = errors.New("mfa locked")
+	ErrMFAUnavailable     = errors.New("mfa not configured")
+	ErrMFANotEnabled      = errors.New("mfa not enabled")
+	ErrPasskeyNotFound    = errors.New("passkey not found")
+	ErrPasskeyExists      = errors.New("passkey already registered")
+	ErrInvalidPasskey     = errors.New("invalid passkey response")
+	ErrInvalidLoginCode   = errors.New("invalid email login code")
+	ErrLoginCodeLocked    = errors.New("email login code locked")
+	ErrSendingMail        = errors.New("sending mail failed")
+	ErrInvalidEmail       = errors.New("invalid email")
+	ErrEmailTaken         = errors.New("email already used")
+	// also returned for used and expired links
+	ErrInvalidVerificationToken = errors.New("invalid verification token")
+	// also returned for used and expired links
+	ErrInvalidResetToken = errors.New("invalid password reset token")
+	// a generated user code collided with a live one, retry with a new code
+	ErrUserCodeTaken = errors.New("user code taken")
 )
 
 func GetMsgCode(err error) (string, int) {
@@ -33,6 +58,72 @@ func GetMsgCode(err error) (string, int) {
 	case errors.Is(err, ErrLoginTaken):
 		return "Login already taken", http.StatusConflict
 
+	case errors.Is(err, ErrInvalidToken):
+		return "Invalid or expired token", http.StatusUnauthorized
+
+	case errors.Is(err, ErrClientNotFound):
+		return "Client not found", http.StatusNotFound
+
+	case errors.Is(err, ErrClientExists):
+		return "Client already exists", http.StatusConflict
+
+	case errors.Is(err, ErrGrantNotFound):
+		return "Grant not found", http.StatusNotFound
+
+	case errors.Is(err, ErrTOTPNotFound):
+		return "Two-factor authentication is not enabled", http.StatusNotFound
+
+	case errors.Is(err, ErrTOTPEnabled):
+		return "Two-factor authentication is already enabled", http.StatusConflict
+
+	case errors.Is(err, ErrInvalidMFACode):
+		return "Invalid code", http.StatusUnauthorized
+
+	case errors.Is(err, ErrMFALocked):
+		return "Too many attempts, try again later", http.StatusTooManyRequests
+
+	case errors.Is(err, ErrMFAUnavailable):
+		return "Two-factor authentication is not configured", http.StatusServiceUnavailable
+
+	case errors.Is(err, ErrMFANotEnabled):
+		return "No second factor is enabled", http.StatusConflict
+
+	case errors.Is(err, ErrPasskeyNotFound):
+		return "Passkey not found", http.StatusNotFound
+
+	case errors.Is(err, ErrPasskeyExists):
+		return "Passkey already registered", http.StatusConflict
+
+	case errors.Is(err, ErrInvalidPasskey):
+		return "Passkey verification failed", http.StatusUnauthorized
+
+	case errors.Is(err, ErrInvalidLoginCode):
+		return "Invalid or expired login code", http.StatusUnauthorized
+
+	case errors.Is(err, ErrLoginCodeLocked):
+		return "Too many attempts, try again later", http.StatusTooManyRequests
+
+	case errors.Is(err, ErrInvalidEmail):
+		return "Invalid email", http.StatusBadRequest
+
+	case errors.Is(err, ErrEmailTaken):
+		return "Email is already used by another user", http.StatusConflict
+
+	case errors.Is(err, ErrInvalidVerificationToken):
+		return "Invalid or expired link", http.StatusBadRequest
+
+	case errors.Is(err, ErrInvalidResetToken):
+		return "Invalid or expired link", http.StatusBadRequest
+
+	case errors.Is(err, ErrSendingMail):
+		return "Mail could not be sent, try again later", http.StatusServiceUnavailable
+
+	case errors.Is(err, ErrInvalidUserCode):
+		return "Invalid or expired code", http.StatusBadRequest
+
+	case errors.Is(err, ErrInvalidRequest):
+		return err.Error(), http.StatusBadRequest
+
 	case errors.Is(err, ErrNoPermission):
 		return "User has no permission", http.StatusForbidden
 
@@ -0,0 +1,77 @@
+package apperror
+
+import (
+	"errors"
+	"net/http"
+)
+
+// OAuth 2.0 error codes, RFC 6749 section 4.1.2.1 and 5.2
+var (
+	ErrInvalidRequest          = errors.New("invalid_request")
+	ErrInvalidClient           = errors.New("invalid_client")
+	ErrInvalidGrant            = errors.New("invalid_grant")
+	ErrUnauthorizedClient      = errors.New("unauthorized_client")
+	ErrUnsupportedGrantType    = errors.New("unsupported_grant_type")
+	ErrUnsupportedResponseType = errors.New("unsupported_response_type")
+	ErrInvalidScope            = errors.New("invalid_scope")
+	ErrAccessDenied            = errors.New("access_denied")
+	ErrLoginRequired           = errors.New("login_required")
+	ErrConsentRequired         = errors.New("consent_required")
+	ErrUnsupportedTokenType    = errors.New("unsupported_token_type")
+	// RFC 8628 section 3.5
+	ErrAuthorizationPending = errors.New("authorization_pending")
+	ErrSlowDown             = errors.New("slow_down")
+	ErrExpiredToken         = errors.New("expired_token")
+	// RFC 8693 section 2.2.2
+	ErrInvalidTarget = errors.New("invalid_target")
+	// RFC 7591 section 3.2.2
+	ErrInvalidRedirectURI    = errors.New("invalid_redirect_uri")
+	ErrInvalidClientMetadata = errors.New("invalid_client_metadata")
+	// RFC 9101 section 6.2
+	ErrInvalidRequestObject = errors.New("invalid_request_object")
+	ErrInvalidRequestURI    = errors.New("invalid_request_uri")
+)
+
+// GetOAuthCode maps an error to the OAuth error code and HTTP status
+// of the token endpoint response.
+func GetOAuthCode(err error) (string, int) {
+	for _, oauthErr := range []error{
+		// wrap ErrInvalidRequest, so they go first
+		ErrInvalidRedirectURI,
+		ErrInvalidClientMetadata,
+		ErrInvalidRequest,
+		ErrInvalidGrant,
+		ErrUnauthorizedClient,
+		ErrUnsupportedGrantType,
+		ErrUnsupportedResponseType,
+		ErrInvalidScope,
+		ErrLoginRequired,
+		ErrConsentRequired,
+		ErrUnsupportedTokenType,
+		ErrAuthorizationPending,
+		ErrSlowDown,
+		ErrExpiredToken,
+		ErrAccessDenied,
+		ErrInvalidTarget,
+		ErrInvalidRequestObject,
+		ErrInvalidRequestURI,
+	} {
+		if errors.Is(err, oauthErr) {
+			return oauthErr.Error(), http.StatusBadRequest
+		}
+	}
+
+	switch {
+	case errors.Is(err, ErrInvalidClient), errors.Is(err, ErrClientNotFound):
+		return ErrInvalidClient.Error(), http.StatusUnauthorized
+
+	case errors.Is(err, ErrNoPermission):
+		return ErrAccessDenied.Error(), http.StatusForbidden
+
+	case errors.Is(err, ErrInvalidToken), errors.Is(err, ErrUserNotFound):
+		return ErrInvalidGrant.Error(), http.StatusBadRequest
+
+	default:
+		return "server_error", http.StatusInternalServerError
+	}
+}
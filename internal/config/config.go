@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
 )
 
 type DBConfig struct {
@@ -17,11 +18,23 @@ type DBConfig struct {
 }
 
 type JWTConfig struct {
-	SecretKey  string `json:"secretKey"`
-	Issuer     string `json:"issuer"`
-	Audience   string `json:"audience"`
-	CookieName string `json:"cookieName"`
-	ExpireDays int    `json:"expireDays"`
+	SecretKey           string `json:"secretKey"`
+	SigningAlg          string `json:"signingAlg"`
+	SigningKeyFile      string `json:"signingKeyFile"`
+	SigningKeyID        string `json:"signingKeyId"`
+	Issuer              string `json:"issuer"`
+	Audience            string `json:"audience"`
+	CookieName          string `json:"cookieName"`
+	RefreshCookieName   string `json:"refreshCookieName"`
+	AccessExpireMinutes int    `json:"accessExpireMinutes"`
+	KeyPublishMinutes   int    `json:"keyPublishMinutes"`
+	// refresh token lifetime
+	ExpireDays int `json:"expireDays"`
+	// TokenID cache TTL, keeps revocation delay short for other instances
+	TokenCacheSeconds int `json:"tokenCacheSeconds"`
+	// how long after a login sensitive changes are allowed without
+	// logging in again
+	ReauthWindowMinutes int `json:"reauthWindowMinutes"`
 }
 
 type CredConfig struct {
@@ -33,13 +46,70 @@ type CredConfig struct {
 	MinPwdLength   int    `json:"minPasswordLength"`
 }
 
+// ForwardAuthConfig maps hosts behind the reverse proxy to one of the
+// forward-auth policies: "login", "public" or "deny".
+type ForwardAuthConfig struct {
+	Hosts map[string]string `json:"hosts"`
+	// used for hosts not listed, "deny" if empty
+	DefaultPolicy string `json:"defaultPolicy"`
+	// the forward-auth cookie only identifies the user to forward-auth, so
+	// it can be shared with the apps' hosts. The session cookie never is.
+	CookieName   string `json:"cookieName"`
+	CookieDomain string `json:"cookieDomain"`
+}
+
+type MFAConfig struct {
+	// base64 of 32 bytes, TOTP can't be enabled without it
+	EncryptionKey string `json:"encryptionKey"`
+}
+
+// WebAuthnConfig overrides the relying party, both default to the JWT
+// issuer: its host is the RP ID and its origin the only allowed origin.
+type WebAuthnConfig struct {
+	RPID    string   `json:"rpId"`
+	Origins []string `json:"origins"`
+}
+
+// MailConfig picks the mail sender: SMTP when SMTPAddr is set, otherwise
+// files in Dir, otherwise mails are only kept in memory.
+type MailConfig struct {
+	From         string `json:"from"`
+	SMTPAddr     string `json:"smtpAddr"`
+	SMTPUser     string `json:"smtpUser"`
+	SMTPPassword string `json:"smtpPassword"`
+	Dir          string `json:"dir"`
+}
+
+// PasswordConfig picks the algorithm for new password hashes, "argon2id"
+// if empty. Zero parameters fall back to the hasher's defaults, hashes made
+// with other parameters are replaced on the next login.
+type PasswordConfig struct {
+	Algorithm string `json:"algorithm"`
+	// KiB
+	Argon2Memory      int `json:"argon2Memory"`
+	Argon2Iterations  int `json:"argon2Iterations"`
+	Argon2Parallelism int `json:"argon2Parallelism"`
+	BcryptCost        int `json:"bcryptCost"`
+	// log2 of the scrypt cost N
+	ScryptLogN int `json:"scryptLogN"`
+	ScryptR    int `json:"scryptR"`
+	ScryptP    int `json:"scryptP"`
+}
+
 type Config struct {
 	Env      string     `json:"env"`
 	HttpPort string     `json:"httpPort"`
 	GrpcPort string     `json:"grpcPort"`
+	AdminID  string     `json:"adminId"`
 	JWT      JWTConfig  `json:"jwt"`
 	DB       DBConfig   `json:"db"`
 	Cred     CredConfig `json:"cred"`
+
+	ForwardAuth ForwardAuthConfig `json:"forwardAuth"`
+	MFA         MFAConfig         `json:"mfa"`
+	WebAuthn    WebAuthnConfig    `json:"webauthn"`
+	Mail        MailConfig        `json:"mail"`
+	Password    PasswordConfig    `json:"password"`
 }
 
 func Load() (*Config, error) {
@@ -71,6 +141,12 @@ func loadConfigEnv() (*Config, error) {
 		return val
 	}
 
+	// for optional features, forward-auth denies everything and TOTP is
+	// unavailable while unset
+	getEnvOptional := func(key string) string {
+		return os.Getenv(key)
+	}
+
 	getEnvInt := func(key string) int {
 		if err != nil {
 			return 0
@@ -90,16 +166,32 @@ func loadConfigEnv() (*Config, error) {
 		return valInt
 	}
 
+	// unset and malformed values are 0, the caller's default
+	getEnvOptionalInt := func(key string) int {
+		valInt, _ := strconv.Atoi(os.Getenv(key))
+		return valInt
+	}
+
 	cfg := &Config{
 		Env:      getEnvString("ENV"),
 		HttpPort: getEnvString("HTTP_PORT"),
 		GrpcPort: getEnvString("GRPC_PORT"),
+		AdminID:  getEnvString("ADMIN_ID"),
 		JWT: JWTConfig{
 			SecretKey:  getEnvString("JWT_SECRET"),
 			Issuer:     getEnvString("JWT_ISSUER"),
 			Audience:   getEnvString("JWT_AUDIENCE"),
 			CookieName: getEnvString("JWT_COOKIE"),
 			ExpireDays: getEnvInt("JWT_EXPIREDAYS"),
+
+			SigningAlg:          getEnvString("JWT_SIGNING_ALG"),
+			SigningKeyFile:      getEnvString("JWT_SIGNING_KEY_FILE"),
+			SigningKeyID:        getEnvString("JWT_SIGNING_KEY_ID"),
+			RefreshCookieName:   getEnvString("JWT_REFRESH_COOKIE"),
+			AccessExpireMinutes: getEnvInt("JWT_ACCESS_EXPIREMINUTES"),
+			KeyPublishMinutes:   getEnvInt("JWT_KEY_PUBLISH_MINUTES"),
+			TokenCacheSeconds:   getEnvInt("JWT_TOKEN_CACHE_SECONDS"),
+			ReauthWindowMinutes: getEnvInt("JWT_REAUTH_WINDOW_MINUTES"),
 		},
 		DB: DBConfig{
 			Host:     getEnvString("DB_HOST"),
@@ -115,11 +207,66 @@ func loadConfigEnv() (*Config, error) {
 			MaxPwdLength:   getEnvInt("CRED_MAX_PASSWORD_LENGTH"),
 			MinPwdLength:   getEnvInt("CRED_MIN_PASSWORD_LENGTH"),
 		},
+		ForwardAuth: ForwardAuthConfig{
+			// FORWARD_AUTH_HOSTS="app.example.com=login,docs.example.com=public"
+			Hosts:         parseHostPolicies(getEnvOptional("FORWARD_AUTH_HOSTS")),
+			DefaultPolicy: getEnvOptional("FORWARD_AUTH_DEFAULT_POLICY"),
+			CookieName:    getEnvOptional("FORWARD_AUTH_COOKIE"),
+			CookieDomain:  getEnvOptional("FORWARD_AUTH_COOKIE_DOMAIN"),
+		},
+		MFA: MFAConfig{
+			EncryptionKey: getEnvOptional("MFA_ENCRYPTION_KEY"),
+		},
+		WebAuthn: WebAuthnConfig{
+			RPID: getEnvOptional("WEBAUTHN_RP_ID"),
+			// WEBAUTHN_ORIGINS="https://id.example.com,https://app.example.com"
+			Origins: parseList(getEnvOptional("WEBAUTHN_ORIGINS")),
+		},
+		Mail: MailConfig{
+			From:         getEnvOptional("MAIL_FROM"),
+			SMTPAddr:     getEnvOptional("MAIL_SMTP_ADDR"),
+			SMTPUser:     getEnvOptional("MAIL_SMTP_USER"),
+			SMTPPassword: getEnvOptional("MAIL_SMTP_PASSWORD"),
+			Dir:          getEnvOptional("MAIL_DIR"),
+		},
+		Password: PasswordConfig{
+			Algorithm:         getEnvOptional("PWD_HASH_ALG"),
+			Argon2Memory:      getEnvOptionalInt("PWD_ARGON2_MEMORY_KIB"),
+			Argon2Iterations:  getEnvOptionalInt("PWD_ARGON2_ITERATIONS"),
+			Argon2Parallelism: getEnvOptionalInt("PWD_ARGON2_PARALLELISM"),
+			BcryptCost:        getEnvOptionalInt("PWD_BCRYPT_COST"),
+			ScryptLogN:        getEnvOptionalInt("PWD_SCRYPT_LOG_N"),
+			ScryptR:           getEnvOptionalInt("PWD_SCRYPT_R"),
+			ScryptP:           getEnvOptionalInt("PWD_SCRYPT_P"),
+		},
 	}
 
 	return cfg, nil
 }
 
+func parseHostPolicies(val string) map[string]string {
+	policies := map[string]string{}
+	for _, pair := range strings.Split(val, ",") {
+		host, policy, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if ok {
+			policies[strings.TrimSpace(host)] = strings.TrimSpace(policy)
+		}
+	}
+
+	return policies
+}
+
+func parseList(val string) []string {
+	var items []string
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
 func loadConfigJSON() (*Config, error) {
 	exePath, err := os.Executable()
 	if err != nil {
@@ -0,0 +1,44 @@
+package dto
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type CreateClient struct {
+	Name                   string          `json:"name"`
+	RedirectURIs           []string        `json:"redirectUris"`
+	GrantTypes             []string        `json:"grantTypes"`
+	Scopes                 []string        `json:"scopes"`
+	ExchangeAudiences      []string        `json:"exchangeAudiences"`
+	PostLogoutRedirectURIs []string        `json:"postLogoutRedirectUris"`
+	BackchannelLogoutURI   string          `json:"backchannelLogoutUri"`
+	JWKS                   json.RawMessage `json:"jwks,omitempty"`
+	RequirePAR             bool            `json:"requirePushedAuthorizationRequests"`
+	Public                 bool            `json:"public"`
+	AccessTokenTTLSeconds  int             `json:"accessTokenTtlSeconds"`
+	RefreshTokenTTLSeconds int             `json:"refreshTokenTtlSeconds"`
+}
+
+type GetClient struct {
+	ID                     string          `json:"clientId"`
+	Name                   string          `json:"name"`
+	RedirectURIs           []string        `json:"redirectUris"`
+	GrantTypes             []string        `json:"grantTypes"`
+	Scopes                 []string        `json:"scopes"`
+	ExchangeAudiences      []string        `json:"exchangeAudiences"`
+	PostLogoutRedirectURIs []string        `json:"postLogoutRedirectUris"`
+	BackchannelLogoutURI   string          `json:"backchannelLogoutUri"`
+	JWKS                   json.RawMessage `json:"jwks,omitempty"`
+	RequirePAR             bool            `json:"requirePushedAuthorizationRequests"`
+	Public                 bool            `json:"public"`
+	AccessTokenTTLSeconds  int             `json:"accessTokenTtlSeconds"`
+	RefreshTokenTTLSeconds int             `json:"refreshTokenTtlSeconds"`
+	CreatedAt              time.Time       `json:"createdAt"`
+}
+
+// the secret is only shown once, on creation
+type CreatedClient struct {
+	GetClient
+	Secret string `json:"clientSecret,omitempty"`
+}
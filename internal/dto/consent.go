@@ -0,0 +1,19 @@
+package dto
+
+import "time"
+
+// ConsentRequest is shown on the consent page.
+type ConsentRequest struct {
+	ClientID      string   `json:"clientId"`
+	ClientName    string   `json:"clientName"`
+	Scopes        []string `json:"scopes"`
+	GrantedScopes []string `json:"grantedScopes"`
+}
+
+type ConsentGrant struct {
+	ClientID   string    `json:"clientId"`
+	ClientName string    `json:"clientName"`
+	Scopes     []string  `json:"scopes"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
@@ -0,0 +1,22 @@
+package dto
+
+// DeviceAuthorizationResponse is the RFC 8628 section 3.2 response.
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+type DeviceVerification struct {
+	UserCode   string `json:"userCode"`
+	ClientName string `json:"clientName"`
+	Scope      string `json:"scope"`
+}
+
+type DeviceDecision struct {
+	UserCode string `json:"userCode"`
+	Approve  bool   `json:"approve"`
+}
@@ -0,0 +1,22 @@
+package dto
+
+import "github.com/google/uuid"
+
+type EmailLoginStart struct {
+	Login string `json:"login"`
+	// local path the mailed link returns to
+	ReturnTo string `json:"returnTo"`
+}
+
+type EmailLoginChallenge struct {
+	ChallengeID uuid.UUID `json:"challengeId"`
+}
+
+type EmailLoginCode struct {
+	ChallengeID uuid.UUID `json:"challengeId"`
+	Code        string    `json:"code"`
+}
+
+type EmailLoginLink struct {
+	Token string `json:"token"`
+}
@@ -0,0 +1,15 @@
+package dto
+
+import "time"
+
+type SigningKey struct {
+	ID        string     `json:"kid"`
+	Alg       string     `json:"alg"`
+	CreatedAt time.Time  `json:"createdAt"`
+	NotBefore time.Time  `json:"notBefore"`
+	RetireAt  *time.Time `json:"retireAt,omitempty"`
+}
+
+type PruneKeysResponse struct {
+	Deleted int64 `json:"deleted"`
+}
@@ -0,0 +1,40 @@
+package dto
+
+const LoginStatusMFARequired = "mfa_required"
+
+// MFARequired is returned by /login instead of the session cookies when
+// the user has a second factor.
+type MFARequired struct {
+	Status   string   `json:"status"`
+	MFAToken string   `json:"mfaToken"`
+	Methods  []string `json:"methods"`
+}
+
+type MFALogin struct {
+	MFAToken string `json:"mfaToken"`
+	Code     string `json:"code"`
+}
+
+type MFACode struct {
+	Code string `json:"code"`
+}
+
+type MFAMethods struct {
+	Methods []string `json:"methods"`
+}
+
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauthUri"`
+	// PNG data URL of the URI
+	QRCode string `json:"qrCode"`
+}
+
+// RecoveryCodes are shown once, only their hashes are stored.
+type RecoveryCodes struct {
+	Codes []string `json:"recoveryCodes"`
+}
+
+type RecoveryCodesRemaining struct {
+	Remaining int `json:"remaining"`
+}
@@ -0,0 +1,38 @@
+package dto
+
+import "encoding/json"
+
+// ClientMetadata is the RFC 7591 section 2 subset isso supports.
+type ClientMetadata struct {
+	RedirectURIs            []string        `json:"redirect_uris"`
+	TokenEndpointAuthMethod string          `json:"token_endpoint_auth_method,omitempty"`
+	GrantTypes              []string        `json:"grant_types,omitempty"`
+	ClientName              string          `json:"client_name,omitempty"`
+	Scope                   string          `json:"scope,omitempty"`
+	PostLogoutRedirectURIs  []string        `json:"post_logout_redirect_uris,omitempty"`
+	BackchannelLogoutURI    string          `json:"backchannel_logout_uri,omitempty"`
+	JWKS                    json.RawMessage `json:"jwks,omitempty"`
+	// RFC 9126 section 6
+	RequirePAR bool `json:"require_pushed_authorization_requests,omitempty"`
+}
+
+// ClientInformation is the RFC 7591 section 3.2.1 response, the secret and
+// the registration access token are only included when issued.
+type ClientInformation struct {
+	ClientMetadata
+	ClientID                string `json:"client_id"`
+	ClientSecret            string `json:"client_secret,omitempty"`
+	ClientIDIssuedAt        int64  `json:"client_id_issued_at"`
+	ClientSecretExpiresAt   *int64 `json:"client_secret_expires_at,omitempty"`
+	RegistrationAccessToken string `json:"registration_access_token,omitempty"`
+	RegistrationClientURI   string `json:"registration_client_uri"`
+}
+
+type CreateInitialAccessToken struct {
+	TTLSeconds int `json:"ttlSeconds"`
+}
+
+type InitialAccessToken struct {
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
@@ -5,6 +5,26 @@ import "github.com/google/uuid"
 type GetUser struct {
 	ID    uuid.UUID `json:"id"`
 	Login string    `json:"login"`
+	// only shown to the user
+	Email         *string `json:"email,omitempty"`
+	EmailVerified *bool   `json:"emailVerified,omitempty"`
+}
+
+type SetEmail struct {
+	Email string `json:"email"`
+}
+
+type VerifyEmail struct {
+	Token string `json:"token"`
+}
+
+type ForgotPassword struct {
+	Login string `json:"login"`
+}
+
+type ResetPassword struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
 }
 
 // Login, register, and update user DTO
@@ -12,3 +32,17 @@ type LRUUser struct {
 	Login    string `json:"login"`
 	Password string `json:"password"`
 }
+
+type Reauthenticate struct {
+	Password string `json:"password"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int64  `json:"expiresIn"`
+}
@@ -0,0 +1,48 @@
+package dto
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// WebAuthnCeremony carries the options for navigator.credentials.create or
+// get, sessionId goes back with the browser's answer.
+type WebAuthnCeremony struct {
+	SessionID string `json:"sessionId"`
+	Options   any    `json:"options"`
+}
+
+type WebAuthnRegistration struct {
+	SessionID string `json:"sessionId"`
+	Name      string `json:"name"`
+	// PublicKeyCredential from navigator.credentials.create
+	Credential json.RawMessage `json:"credential"`
+}
+
+// WebAuthnBeginLogin has an mfaToken only when the passkey is the second
+// factor of a password login.
+type WebAuthnBeginLogin struct {
+	MFAToken string `json:"mfaToken"`
+}
+
+type WebAuthnLogin struct {
+	MFAToken  string `json:"mfaToken"`
+	SessionID string `json:"sessionId"`
+	// PublicKeyCredential from navigator.credentials.get
+	Credential json.RawMessage `json:"credential"`
+}
+
+type Passkey struct {
+	// base64url credential ID
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+// PasskeyRegistered has recovery codes when the passkey is the user's first
+// second factor.
+type PasskeyRegistered struct {
+	Passkey
+	RecoveryCodes []string `json:"recoveryCodes,omitempty"`
+}
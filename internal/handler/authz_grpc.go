@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/config"
+	"github.com/kkonst40/isso/internal/dto"
+	"github.com/kkonst40/isso/internal/service"
+	"github.com/kkonst40/isso/internal/utils"
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+)
+
+// identity headers set on allowed requests, client supplied ones are
+// overwritten or removed
+const (
+	authUserIDHeader    = "x-auth-user-id"
+	authUserLoginHeader = "x-auth-user-login"
+	authClientIDHeader  = "x-auth-client-id"
+)
+
+// AuthzGRPCHandler implements Envoy's external authorization API. Bearer
+// tokens must be issued for the isso audience, browsers are identified by
+// the session cookie.
+type AuthzGRPCHandler struct {
+	authv3.UnimplementedAuthorizationServer
+	tokenService *service.TokenService
+	cfg          *config.Config
+}
+
+func NewAuthzGRPCHandler(tokenService *service.TokenService, cfg *config.Config) *AuthzGRPCHandler {
+	return &AuthzGRPCHandler{
+		tokenService: tokenService,
+		cfg:          cfg,
+	}
+}
+
+func (s *AuthzGRPCHandler) Check(ctx context.Context, req *authv3.CheckRequest) (*authv3.CheckResponse, error) {
+	// Envoy lowercases header names
+	headers := req.GetAttributes().GetRequest().GetHttp().GetHeaders()
+
+	var (
+		claims *utils.UserClaims
+		err    error
+	)
+	if authorization, ok := headers["authorization"]; ok {
+		tokenString, ok := strings.CutPrefix(authorization, "Bearer ")
+		if !ok || tokenString == "" {
+			return deniedCheck(codes.Unauthenticated, http.StatusBadRequest, "invalid_request", "Invalid authorization header"), nil
+		}
+		claims, err = s.tokenService.ValidateAPIToken(ctx, tokenString)
+	} else {
+		claims, err = s.cookieClaims(ctx, headers["cookie"])
+	}
+
+	if err != nil {
+		errMsg, errCode := apperror.GetMsgCode(err)
+		if errCode >= http.StatusInternalServerError {
+			return deniedCheck(codes.Unavailable, http.StatusServiceUnavailable, "temporarily_unavailable", errMsg), nil
+		}
+		return deniedCheck(codes.Unauthenticated, http.StatusUnauthorized, "invalid_token", errMsg), nil
+	}
+
+	// set headers overwrite what the client sent, the ones that don't
+	// apply to this caller are removed
+	var (
+		identity []*corev3.HeaderValueOption
+		remove   []string
+	)
+	if claims.Machine() {
+		identity = append(identity, overwriteHeader(authClientIDHeader, claims.ClientID))
+		remove = append(remove, authUserIDHeader, authUserLoginHeader)
+	} else {
+		identity = append(identity,
+			overwriteHeader(authUserIDHeader, claims.ID.String()),
+			overwriteHeader(authUserLoginHeader, claims.UserName),
+		)
+		if claims.ClientID != "" {
+			identity = append(identity, overwriteHeader(authClientIDHeader, claims.ClientID))
+		} else {
+			remove = append(remove, authClientIDHeader)
+		}
+	}
+
+	return &authv3.CheckResponse{
+		Status: &rpcstatus.Status{Code: int32(codes.OK)},
+		HttpResponse: &authv3.CheckResponse_OkResponse{
+			OkResponse: &authv3.OkHttpResponse{
+				Headers:         identity,
+				HeadersToRemove: remove,
+			},
+		},
+	}, nil
+}
+
+func (s *AuthzGRPCHandler) cookieClaims(ctx context.Context, cookieHeader string) (*utils.UserClaims, error) {
+	cookies, err := http.ParseCookie(cookieHeader)
+	if err != nil {
+		return nil, apperror.ErrInvalidToken
+	}
+
+	for _, cookie := range cookies {
+		if cookie.Name == s.cfg.JWT.CookieName && cookie.Value != "" {
+			return s.tokenService.ValidateToken(ctx, cookie.Value)
+		}
+	}
+
+	return nil, apperror.ErrInvalidToken
+}
+
+// deniedCheck answers the downstream client with an RFC 6750 style error.
+func deniedCheck(code codes.Code, httpCode int, oauthCode, description string) *authv3.CheckResponse {
+	body, _ := json.Marshal(dto.OAuthError{
+		Error:            oauthCode,
+		ErrorDescription: description,
+	})
+
+	denied := &authv3.DeniedHttpResponse{
+		Status: &typev3.HttpStatus{Code: typev3.StatusCode(httpCode)},
+		Headers: []*corev3.HeaderValueOption{
+			overwriteHeader("content-type", "application/json"),
+		},
+		Body: string(body),
+	}
+	if httpCode == http.StatusUnauthorized {
+		challenge := `Bearer realm="isso", error="` + oauthCode + `"`
+		denied.Headers = append(denied.Headers, overwriteHeader("www-authenticate", challenge))
+	}
+
+	return &authv3.CheckResponse{
+		Status:       &rpcstatus.Status{Code: int32(code), Message: description},
+		HttpResponse: &authv3.CheckResponse_DeniedResponse{DeniedResponse: denied},
+	}
+}
+
+func overwriteHeader(key, value string) *corev3.HeaderValueOption {
+	return &corev3.HeaderValueOption{
+		Header:       &corev3.HeaderValue{Key: key, Value: value},
+		AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+	}
+}
@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/config"
+	"github.com/kkonst40/isso/internal/model"
+	"github.com/kkonst40/isso/internal/service"
+	"github.com/kkonst40/isso/internal/utils"
+	"google.golang.org/grpc/codes"
+)
+
+// newAuthzTest builds the handler without a database, the user's TokenID
+// is only in the cache.
+func newAuthzTest(t *testing.T) (*AuthzGRPCHandler, *utils.JWTProvider, *model.User) {
+	t.Helper()
+
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			SecretKey:           "test-secret-test-secret-test-secret",
+			Issuer:              "https://id.example.com",
+			Audience:            "isso",
+			CookieName:          "isso",
+			AccessExpireMinutes: 5,
+		},
+	}
+	jwtProvider, err := utils.NewJWTProvider(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := &model.User{ID: uuid.New(), Login: "alice", TokenID: uuid.New()}
+	tokenIDCache := utils.NewTokenIDCache(time.Minute)
+	tokenIDCache.Set(user.ID, user.TokenID, tokenIDCache.Generation())
+	tokenService := service.NewTokenService(jwtProvider, nil, nil, tokenIDCache, utils.NewFamilyCache(time.Minute))
+
+	return NewAuthzGRPCHandler(tokenService, cfg), jwtProvider, user
+}
+
+func checkRequest(headers map[string]string) *authv3.CheckRequest {
+	return &authv3.CheckRequest{
+		Attributes: &authv3.AttributeContext{
+			Request: &authv3.AttributeContext_Request{
+				Http: &authv3.AttributeContext_HttpRequest{Headers: headers},
+			},
+		},
+	}
+}
+
+func TestAuthzCheck(t *testing.T) {
+	h, jwtProvider, user := newAuthzTest(t)
+
+	session, err := jwtProvider.Generate(user, model.Authentication{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientToken, err := jwtProvider.GenerateClientToken("batch", "", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := jwtProvider.Generate(&model.User{ID: user.ID, Login: user.Login, TokenID: uuid.New()}, model.Authentication{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		set      map[string]string
+		removed  []string
+		code     codes.Code
+		httpCode int
+	}{
+		{
+			name:    "bearer token",
+			headers: map[string]string{"authorization": "Bearer " + session},
+			set:     map[string]string{authUserIDHeader: user.ID.String(), authUserLoginHeader: user.Login},
+			removed: []string{authClientIDHeader},
+		},
+		{
+			name:    "session cookie",
+			headers: map[string]string{"cookie": "theme=dark; isso=" + session},
+			set:     map[string]string{authUserIDHeader: user.ID.String(), authUserLoginHeader: user.Login},
+			removed: []string{authClientIDHeader},
+		},
+		{
+			name:    "client token",
+			headers: map[string]string{"authorization": "Bearer " + clientToken},
+			set:     map[string]string{authClientIDHeader: "batch"},
+			removed: []string{authUserIDHeader, authUserLoginHeader},
+		},
+		{
+			// forged identity headers are overwritten, not passed on
+			name: "forged headers",
+			headers: map[string]string{
+				"authorization":     "Bearer " + session,
+				authUserIDHeader:    uuid.NewString(),
+				authUserLoginHeader: "admin",
+				authClientIDHeader:  "admin-client",
+			},
+			set:     map[string]string{authUserIDHeader: user.ID.String(), authUserLoginHeader: user.Login},
+			removed: []string{authClientIDHeader},
+		},
+		{
+			name: "forged user headers with a client token",
+			headers: map[string]string{
+				"authorization":     "Bearer " + clientToken,
+				authUserIDHeader:    user.ID.String(),
+				authUserLoginHeader: user.Login,
+			},
+			set:     map[string]string{authClientIDHeader: "batch"},
+			removed: []string{authUserIDHeader, authUserLoginHeader},
+		},
+		{name: "no credentials", code: codes.Unauthenticated, httpCode: http.StatusUnauthorized},
+		{
+			name:     "invalid token",
+			headers:  map[string]string{"authorization": "Bearer not-a-token"},
+			code:     codes.Unauthenticated,
+			httpCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "revoked token",
+			headers:  map[string]string{"cookie": "isso=" + revoked},
+			code:     codes.Unauthenticated,
+			httpCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "not a bearer token",
+			headers:  map[string]string{"authorization": "Basic YWxpY2U6cHdk"},
+			code:     codes.Unauthenticated,
+			httpCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := h.Check(context.Background(), checkRequest(tt.headers))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if code := codes.Code(resp.GetStatus().GetCode()); code != tt.code {
+				t.Fatalf("code = %v, want %v", code, tt.code)
+			}
+
+			if tt.code != codes.OK {
+				denied := resp.GetDeniedResponse()
+				if denied == nil || int(denied.GetStatus().GetCode()) != tt.httpCode {
+					t.Fatalf("denied response %v, want status %d", denied, tt.httpCode)
+				}
+				return
+			}
+
+			ok := resp.GetOkResponse()
+			set := map[string]string{}
+			for _, header := range ok.GetHeaders() {
+				if header.GetAppendAction() != corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD {
+					t.Errorf("%s is appended to the client's value", header.GetHeader().GetKey())
+				}
+				set[header.GetHeader().GetKey()] = header.GetHeader().GetValue()
+			}
+			if len(set) != len(tt.set) {
+				t.Fatalf("headers = %v, want %v", set, tt.set)
+			}
+			for key, value := range tt.set {
+				if set[key] != value {
+					t.Fatalf("headers = %v, want %v", set, tt.set)
+				}
+				// Envoy applies removals after the set headers
+				if slices.Contains(ok.GetHeadersToRemove(), key) {
+					t.Fatalf("%s is set and removed", key)
+				}
+			}
+			if !slices.Equal(ok.GetHeadersToRemove(), tt.removed) {
+				t.Fatalf("removed = %v, want %v", ok.GetHeadersToRemove(), tt.removed)
+			}
+		})
+	}
+}
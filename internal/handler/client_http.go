@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/dto"
+	"github.com/kkonst40/isso/internal/middleware"
+	"github.com/kkonst40/isso/internal/model"
+	"github.com/kkonst40/isso/internal/service"
+)
+
+type ClientHandler struct {
+	clientService *service.ClientService
+}
+
+func NewClientHandler(clientService *service.ClientService) *ClientHandler {
+	return &ClientHandler{
+		clientService: clientService,
+	}
+}
+
+func (h *ClientHandler) All(w http.ResponseWriter, r *http.Request) {
+	requesterID := r.Context().Value(middleware.RequesterIDKey).(uuid.UUID)
+
+	clients, err := h.clientService.All(r.Context(), requesterID)
+	if err != nil {
+		errMsg, errCode := apperror.GetMsgCode(err)
+		http.Error(w, errMsg, errCode)
+		return
+	}
+
+	clientDTOs := make([]dto.GetClient, 0, len(clients))
+	for _, client := range clients {
+		clientDTOs = append(clientDTOs, clientDTO(&client))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(clientDTOs); err != nil {
+		http.Error(w, "Encoding response body error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *ClientHandler) Create(w http.ResponseWriter, r *http.Request) {
+	requesterID := r.Context().Value(middleware.RequesterIDKey).(uuid.UUID)
+
+	var req dto.CreateClient
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	client := &model.Client{
+		Name:                   req.Name,
+		RedirectURIs:           req.RedirectURIs,
+		GrantTypes:             req.GrantTypes,
+		Scopes:                 req.Scopes,
+		ExchangeAudiences:      req.ExchangeAudiences,
+		PostLogoutRedirectURIs: req.PostLogoutRedirectURIs,
+		BackchannelLogoutURI:   req.BackchannelLogoutURI,
+		JWKS:                   string(req.JWKS),
+		RequirePAR:             req.RequirePAR,
+		Public:                 req.Public,
+		AccessTokenTTL:         time.Duration(req.AccessTokenTTLSeconds) * time.Second,
+		RefreshTokenTTL:        time.Duration(req.RefreshTokenTTLSeconds) * time.Second,
+	}
+
+	secret, err := h.clientService.Create(r.Context(), requesterID, client)
+	if err != nil {
+		errMsg, errCode := apperror.GetMsgCode(err)
+		http.Error(w, errMsg, errCode)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+
+	if err := json.NewEncoder(w).Encode(dto.CreatedClient{
+		GetClient: clientDTO(client),
+		Secret:    secret,
+	}); err != nil {
+		http.Error(w, "Encoding response body error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *ClientHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	requesterID := r.Context().Value(middleware.RequesterIDKey).(uuid.UUID)
+
+	err := h.clientService.Delete(r.Context(), requesterID, r.PathValue("id"))
+	if err != nil {
+		errMsg, errCode := apperror.GetMsgCode(err)
+		http.Error(w, errMsg, errCode)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func clientDTO(client *model.Client) dto.GetClient {
+	return dto.GetClient{
+		ID:                     client.ID,
+		Name:                   client.Name,
+		RedirectURIs:           client.RedirectURIs,
+		GrantTypes:             client.GrantTypes,
+		Scopes:                 client.Scopes,
+		ExchangeAudiences:      client.ExchangeAudiences,
+		PostLogoutRedirectURIs: client.PostLogoutRedirectURIs,
+		BackchannelLogoutURI:   client.BackchannelLogoutURI,
+		JWKS:                   rawJSON(client.JWKS),
+		RequirePAR:             client.RequirePAR,
+		Public:                 client.Public,
+		AccessTokenTTLSeconds:  int(client.AccessTokenTTL.Seconds()),
+		RefreshTokenTTLSeconds: int(client.RefreshTokenTTL.Seconds()),
+		CreatedAt:              client.CreatedAt,
+	}
+}
+
+func rawJSON(s string) json.RawMessage {
+	if s == "" {
+		return nil
+	}
+	return json.RawMessage(s)
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/dto"
+	"github.com/kkonst40/isso/internal/middleware"
+	"github.com/kkonst40/isso/internal/service"
+	"github.com/kkonst40/isso/internal/utils"
+)
+
+type ConsentHandler struct {
+	consentService *service.ConsentService
+	oidcService    *service.OIDCService
+	clientService  *service.ClientService
+}
+
+func NewConsentHandler(
+	consentService *service.ConsentService,
+	oidcService *service.OIDCService,
+	clientService *service.ClientService,
+) *ConsentHandler {
+	return &ConsentHandler{
+		consentService: consentService,
+		oidcService:    oidcService,
+		clientService:  clientService,
+	}
+}
+
+// Request describes the authorization request the consent page was opened
+// for, its query is the one of /authorize.
+func (h *ConsentHandler) Request(w http.ResponseWriter, r *http.Request) {
+	requesterID := r.Context().Value(middleware.RequesterIDKey).(uuid.UUID)
+
+	params, err := h.oidcService.ResolveAuthorizationParams(r.Context(), r.URL.Query())
+	if err != nil {
+		_, errCode := apperror.GetOAuthCode(err)
+		http.Error(w, err.Error(), errCode)
+		return
+	}
+
+	req, err := h.oidcService.ValidateAuthorizationRequest(r.Context(), service.NewAuthorizationRequest(params))
+	if err != nil {
+		_, errCode := apperror.GetOAuthCode(err)
+		http.Error(w, err.Error(), errCode)
+		return
+	}
+
+	client, err := h.clientService.Get(r.Context(), req.ClientID)
+	if err != nil {
+		errMsg, errCode := apperror.GetMsgCode(err)
+		http.Error(w, errMsg, errCode)
+		return
+	}
+
+	granted, err := h.consentService.Granted(r.Context(), requesterID, client.ID)
+	if err != nil {
+		errMsg, errCode := apperror.GetMsgCode(err)
+		http.Error(w, errMsg, errCode)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := json.NewEncoder(w).Encode(dto.ConsentRequest{
+		ClientID:      client.ID,
+		ClientName:    client.Name,
+		Scopes:        utils.Scopes(req.Scope),
+		GrantedScopes: granted,
+	}); err != nil {
+		http.Error(w, "Encoding response body error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *ConsentHandler) All(w http.ResponseWriter, r *http.Request) {
+	requesterID := r.Context().Value(middleware.RequesterIDKey).(uuid.UUID)
+
+	grants, err := h.consentService.List(r.Context(), requesterID)
+	if err != nil {
+		errMsg, errCode := apperror.GetMsgCode(err)
+		http.Error(w, errMsg, errCode)
+		return
+	}
+
+	grantDTOs := make([]dto.ConsentGrant, 0, len(grants))
+	for _, grant := range grants {
+		grantDTOs = append(grantDTOs, dto.ConsentGrant{
+			ClientID:   grant.ClientID,
+			ClientName: grant.ClientName,
+			Scopes:     grant.Scopes,
+			CreatedAt:  grant.CreatedAt,
+			UpdatedAt:  grant.UpdatedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(grantDTOs); err != nil {
+		http.Error(w, "Encoding response body error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *ConsentHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	requesterID := r.Context().Value(middleware.RequesterIDKey).(uuid.UUID)
+
+	if err := h.consentService.Revoke(r.Context(), requesterID, r.PathValue("clientId")); err != nil {
+		errMsg, errCode := apperror.GetMsgCode(err)
+		http.Error(w, errMsg, errCode)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
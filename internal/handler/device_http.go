@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/dto"
+	"github.com/kkonst40/isso/internal/middleware"
+	"github.com/kkonst40/isso/internal/utils"
+)
+
+const devicePagePath = "/device"
+
+func (h *OIDCHandler) DeviceCode(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, apperror.ErrInvalidRequest)
+		return
+	}
+
+	clientID, clientSecret := clientCredentials(r)
+
+	auth, err := h.oidcService.DeviceAuthorize(r.Context(), clientID, clientSecret, r.PostForm.Get("scope"))
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	verificationURI := strings.TrimSuffix(h.cfg.JWT.Issuer, "/") + devicePagePath
+
+	writeOAuthJSON(w, http.StatusOK, dto.DeviceAuthorizationResponse{
+		DeviceCode:              auth.DeviceCode,
+		UserCode:                auth.UserCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + url.QueryEscape(auth.UserCode),
+		ExpiresIn:               int64(time.Until(auth.ExpiresAt).Seconds()),
+		Interval:                int64(auth.Interval.Seconds()),
+	})
+}
+
+func (h *OIDCHandler) DeviceVerification(w http.ResponseWriter, r *http.Request) {
+	verification, err := h.oidcService.DeviceVerification(r.Context(), r.URL.Query().Get("user_code"))
+	if err != nil {
+		errMsg, errCode := apperror.GetMsgCode(err)
+		http.Error(w, errMsg, errCode)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := json.NewEncoder(w).Encode(dto.DeviceVerification{
+		UserCode:   verification.UserCode,
+		ClientName: verification.ClientName,
+		Scope:      verification.Scope,
+	}); err != nil {
+		http.Error(w, "Encoding response body error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *OIDCHandler) DeviceDecide(w http.ResponseWriter, r *http.Request) {
+	requesterID := r.Context().Value(middleware.RequesterIDKey).(uuid.UUID)
+	claims := r.Context().Value(middleware.ClaimsKey).(*utils.UserClaims)
+
+	var req dto.DeviceDecision
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.oidcService.DeviceDecide(r.Context(), req.UserCode, requesterID, req.Approve, claims.Authentication()); err != nil {
+		errMsg, errCode := apperror.GetMsgCode(err)
+		http.Error(w, errMsg, errCode)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/dto"
+	"github.com/kkonst40/isso/internal/middleware"
+	"github.com/kkonst40/isso/internal/service"
+)
+
+type EmailHandler struct {
+	emailService *service.EmailService
+}
+
+func NewEmailHandler(emailService *service.EmailService) *EmailHandler {
+	return &EmailHandler{
+		emailService: emailService,
+	}
+}
+
+// RequestChange answers 202, the address is set once the mailed link is
+// opened.
+func (h *EmailHandler) RequestChange(w http.ResponseWriter, r *http.Request) {
+	requesterID := r.Context().Value(middleware.RequesterIDKey).(uuid.UUID)
+
+	var req dto.SetEmail
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.emailService.RequestChange(r.Context(), requesterID, req.Email); err != nil {
+		errMsg, errCode := apperror.GetMsgCode(err)
+		http.Error(w, errMsg, errCode)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Verify needs no session, the link may be opened in another browser.
+func (h *EmailHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	var req dto.VerifyEmail
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.emailService.Confirm(r.Context(), req.Token); err != nil {
+		errMsg, errCode := apperror.GetMsgCode(err)
+		http.Error(w, errMsg, errCode)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/kkonst40/isso/internal/config"
+	"github.com/kkonst40/isso/internal/middleware"
+	"github.com/kkonst40/isso/internal/service"
+)
+
+const (
+	forwardAuthReturnPath = "/forward-auth/return"
+
+	defaultForwardAuthCookie = "isso_forward_auth"
+)
+
+type ForwardAuthHandler struct {
+	forwardAuthService *service.ForwardAuthService
+	tokenService       *service.TokenService
+	cfg                *config.Config
+}
+
+func NewForwardAuthHandler(
+	forwardAuthService *service.ForwardAuthService,
+	tokenService *service.TokenService,
+	cfg *config.Config,
+) *ForwardAuthHandler {
+	return &ForwardAuthHandler{
+		forwardAuthService: forwardAuthService,
+		tokenService:       tokenService,
+		cfg:                cfg,
+	}
+}
+
+// Check answers the reverse proxy subrequest for the original request.
+// nginx auth_request only understands 2xx, 401 and 403, so the login page
+// URL is sent in X-Auth-Redirect of the 401. Proxies passing the response to
+// the user (Traefik ForwardAuth) can ask for a 302 with ?redirect=true.
+func (h *ForwardAuthHandler) Check(w http.ResponseWriter, r *http.Request) {
+	original := forwardedURL(r)
+
+	policy := h.forwardAuthService.Policy(original.Host)
+	if policy == service.ForwardAuthDeny {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	validator := middleware.TokenValidatorFunc(h.tokenService.ValidateForwardAuthToken)
+	claims, err := middleware.CookieClaims(r, validator, forwardAuthCookieName(h.cfg))
+	if err == nil {
+		w.Header().Set("X-Auth-User-Id", claims.ID.String())
+		w.Header().Set("X-Auth-User-Login", claims.UserName)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if policy == service.ForwardAuthPublic {
+		// empty values overwrite headers forged by the client
+		w.Header().Set("X-Auth-User-Id", "")
+		w.Header().Set("X-Auth-User-Login", "")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	returnTo := forwardAuthReturnPath + "?rd=" + url.QueryEscape(original.String())
+	loginURL := strings.TrimSuffix(h.cfg.JWT.Issuer, "/") + loginPagePath + "?return_to=" + url.QueryEscape(returnTo)
+
+	if r.URL.Query().Get("redirect") == "true" {
+		http.Redirect(w, r, loginURL, http.StatusFound)
+		return
+	}
+
+	w.Header().Set("X-Auth-Redirect", loginURL)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
+
+// Return sends the user back to the app after logging in, the login page
+// only follows relative return URLs.
+func (h *ForwardAuthHandler) Return(w http.ResponseWriter, r *http.Request) {
+	target, ok := h.forwardAuthService.ReturnURL(r.URL.Query().Get("rd"))
+	if !ok {
+		http.Error(w, "Invalid return URL", http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+func forwardAuthCookieName(cfg *config.Config) string {
+	if cfg.ForwardAuth.CookieName != "" {
+		return cfg.ForwardAuth.CookieName
+	}
+	return defaultForwardAuthCookie
+}
+
+// forwardedURL rebuilds the URL of the request the proxy is checking.
+func forwardedURL(r *http.Request) *url.URL {
+	scheme := r.Header.Get("X-Forwarded-Proto")
+	if scheme == "" {
+		scheme = "https"
+	}
+
+	host := r.Header.Get("X-Forwarded-Host")
+	if host == "" {
+		host = r.Host
+	}
+
+	uri := r.Header.Get("X-Forwarded-Uri")
+	if uri == "" {
+		// nginx: proxy_set_header X-Original-URI $request_uri;
+		uri = r.Header.Get("X-Original-URI")
+	}
+
+	u, err := url.ParseRequestURI(uri)
+	if err != nil {
+		u = &url.URL{Path: "/"}
+	}
+	u.Scheme = scheme
+	u.Host = host
+
+	return u
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/dto"
+	"github.com/kkonst40/isso/internal/middleware"
+	"github.com/kkonst40/isso/internal/model"
+	"github.com/kkonst40/isso/internal/service"
+	"github.com/kkonst40/isso/internal/utils"
+)
+
+type KeyHandler struct {
+	keyService  *service.KeyService
+	jwtProvider *utils.JWTProvider
+}
+
+func NewKeyHandler(keyService *service.KeyService, jwtProvider *utils.JWTProvider) *KeyHandler {
+	return &KeyHandler{
+		keyService:  keyService,
+		jwtProvider: jwtProvider,
+	}
+}
+
+func (h *KeyHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	if err := json.NewEncoder(w).Encode(h.jwtProvider.JWKS()); err != nil {
+		http.Error(w, "Encoding response body error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *KeyHandler) All(w http.ResponseWriter, r *http.Request) {
+	requesterID := r.Context().Value(middleware.RequesterIDKey).(uuid.UUID)
+
+	keys, err := h.keyService.All(r.Context(), requesterID)
+	if err != nil {
+		errMsg, errCode := apperror.GetMsgCode(err)
+		http.Error(w, errMsg, errCode)
+		return
+	}
+
+	keyDTOs := make([]dto.SigningKey, 0, len(keys))
+	for _, key := range keys {
+		keyDTOs = append(keyDTOs, signingKeyDTO(&key))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(keyDTOs); err != nil {
+		http.Error(w, "Encoding response body error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *KeyHandler) Rotate(w http.ResponseWriter, r *http.Request) {
+	requesterID := r.Context().Value(middleware.RequesterIDKey).(uuid.UUID)
+
+	key, err := h.keyService.Rotate(r.Context(), requesterID)
+	if err != nil {
+		errMsg, errCode := apperror.GetMsgCode(err)
+		http.Error(w, errMsg, errCode)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	if err := json.NewEncoder(w).Encode(signingKeyDTO(key)); err != nil {
+		http.Error(w, "Encoding response body error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *KeyHandler) Prune(w http.ResponseWriter, r *http.Request) {
+	requesterID := r.Context().Value(middleware.RequesterIDKey).(uuid.UUID)
+
+	deleted, err := h.keyService.Prune(r.Context(), requesterID)
+	if err != nil {
+		errMsg, errCode := apperror.GetMsgCode(err)
+		http.Error(w, errMsg, errCode)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(dto.PruneKeysResponse{Deleted: deleted}); err != nil {
+		http.Error(w, "Encoding response body error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func signingKeyDTO(key *model.SigningKey) dto.SigningKey {
+	return dto.SigningKey{
+		ID:        key.ID,
+		Alg:       key.Alg,
+		CreatedAt: key.CreatedAt,
+		NotBefore: key.NotBefore,
+		RetireAt:  key.RetireAt,
+	}
+}
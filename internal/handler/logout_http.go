@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/config"
+	"github.com/kkonst40/isso/internal/model"
+	"github.com/kkonst40/isso/internal/service"
+)
+
+const logoutConfirmPagePath = "/logout/confirm"
+
+type LogoutHandler struct {
+	logoutService *service.LogoutService
+	tokenService  *service.TokenService
+	cfg           *config.Config
+}
+
+func NewLogoutHandler(
+	logoutService *service.LogoutService,
+	tokenService *service.TokenService,
+	cfg *config.Config,
+) *LogoutHandler {
+	return &LogoutHandler{
+		logoutService: logoutService,
+		tokenService:  tokenService,
+		cfg:           cfg,
+	}
+}
+
+// EndSession is the RP-initiated logout endpoint, it accepts GET and POST.
+// Without an id_token_hint of the logged in user the user is asked first,
+// the confirmation page posts back with logout=confirm. Only POST is
+// accepted for that, so the SameSite session cookie keeps other sites from
+// logging the user out.
+func (h *LogoutHandler) EndSession(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid request parameters", http.StatusBadRequest)
+		return
+	}
+
+	userID, loggedIn := sessionUser(r, h.tokenService, h.cfg.JWT.CookieName)
+	if !loggedIn {
+		userID = uuid.Nil
+	}
+
+	redirectURI, hinted, err := h.logoutService.ValidateEndSession(r.Context(), &model.EndSessionRequest{
+		IDTokenHint:           r.Form.Get("id_token_hint"),
+		ClientID:              r.Form.Get("client_id"),
+		PostLogoutRedirectURI: r.Form.Get("post_logout_redirect_uri"),
+		State:                 r.Form.Get("state"),
+	}, userID)
+	if err != nil {
+		errMsg, errCode := apperror.GetMsgCode(err)
+		http.Error(w, errMsg, errCode)
+		return
+	}
+
+	confirmed := r.Method == http.MethodPost && r.PostForm.Get("logout") == "confirm"
+	if loggedIn && !hinted && !confirmed {
+		params := url.Values{}
+		for key, values := range r.Form {
+			if key != "logout" {
+				params[key] = values
+			}
+		}
+		http.Redirect(w, r, logoutConfirmPagePath+"?"+params.Encode(), http.StatusFound)
+		return
+	}
+
+	clearTokenCookies(w, h.cfg)
+
+	if loggedIn {
+		if err := h.logoutService.Logout(r.Context(), userID); err != nil {
+			errMsg, errCode := apperror.GetMsgCode(err)
+			http.Error(w, errMsg, errCode)
+			return
+		}
+	}
+
+	if redirectURI != "" {
+		http.Redirect(w, r, redirectURI, http.StatusFound)
+		return
+	}
+
+	http.ServeFile(w, r, "static/logout.html")
+}
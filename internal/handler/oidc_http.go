@@ -0,0 +1,399 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/config"
+	"github.com/kkonst40/isso/internal/dto"
+	"github.com/kkonst40/isso/internal/middleware"
+	"github.com/kkonst40/isso/internal/model"
+	"github.com/kkonst40/isso/internal/service"
+	"github.com/kkonst40/isso/internal/utils"
+)
+
+const (
+	loginPagePath   = "/login"
+	consentPagePath = "/consent"
+	// carries the login asked for by prompt=login back to /authorize
+	loginRequestParam = "login_request"
+)
+
+type OIDCHandler struct {
+	oidcService    *service.OIDCService
+	tokenService   *service.TokenService
+	consentService *service.ConsentService
+	cfg            *config.Config
+}
+
+func NewOIDCHandler(
+	oidcService *service.OIDCService,
+	tokenService *service.TokenService,
+	consentService *service.ConsentService,
+	cfg *config.Config,
+) *OIDCHandler {
+	return &OIDCHandler{
+		oidcService:    oidcService,
+		tokenService:   tokenService,
+		consentService: consentService,
+		cfg:            cfg,
+	}
+}
+
+func (h *OIDCHandler) Authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid request parameters", http.StatusBadRequest)
+		return
+	}
+
+	params, err := h.oidcService.ResolveAuthorizationParams(r.Context(), r.Form)
+	if err != nil {
+		_, errCode := apperror.GetOAuthCode(err)
+		http.Error(w, err.Error(), errCode)
+		return
+	}
+
+	req, err := h.oidcService.ValidateAuthorizationRequest(r.Context(), service.NewAuthorizationRequest(params))
+	if err != nil {
+		if req == nil {
+			_, errCode := apperror.GetOAuthCode(err)
+			http.Error(w, err.Error(), errCode)
+			return
+		}
+		h.redirectError(w, r, req, err)
+		return
+	}
+
+	claims, ok := h.sessionClaims(r)
+	reauth := ok && h.oidcService.NeedsReauthentication(req, claims.Authentication(), r.Form.Get(loginRequestParam))
+	if !ok || reauth {
+		if req.Prompt[service.PromptNone] {
+			h.redirectError(w, r, req, apperror.ErrLoginRequired)
+			return
+		}
+
+		params := url.Values{}
+		for key, values := range r.Form {
+			params[key] = values
+		}
+		if req.Prompt[service.PromptLogin] {
+			// the session the user comes back with has to be newer than this
+			loginRequest, err := h.oidcService.RequestLogin()
+			if err != nil {
+				h.redirectError(w, r, req, err)
+				return
+			}
+			params.Set(loginRequestParam, loginRequest)
+		}
+
+		returnTo := "/authorize?" + params.Encode()
+		loginURL := loginPagePath + "?return_to=" + url.QueryEscape(returnTo)
+		if reauth {
+			loginURL += "&prompt=login"
+		}
+		http.Redirect(w, r, loginURL, http.StatusFound)
+		return
+	}
+
+	if !h.consented(w, r, req, claims.ID) {
+		return
+	}
+
+	code, err := h.oidcService.Authorize(r.Context(), req, claims.ID, claims.Authentication())
+	if err != nil {
+		h.redirectError(w, r, req, err)
+		return
+	}
+
+	redirectWithParams(w, r, req.RedirectURI, url.Values{
+		"code":  {code},
+		"state": {req.State},
+		"iss":   {h.cfg.JWT.Issuer},
+	})
+}
+
+// consented makes sure the user approved the requested scopes. The consent
+// page posts its decision back to /authorize, only POST is accepted so the
+// SameSite session cookie keeps other sites from approving for the user.
+func (h *OIDCHandler) consented(w http.ResponseWriter, r *http.Request, req *model.AuthorizationRequest, userID uuid.UUID) bool {
+	covered, err := h.consentService.Covers(r.Context(), userID, req.ClientID, req.Scope)
+	if err != nil {
+		h.redirectError(w, r, req, err)
+		return false
+	}
+
+	if covered && !req.Prompt[service.PromptConsent] {
+		return true
+	}
+
+	switch r.PostForm.Get("consent") {
+	case "approve":
+		if err := h.consentService.Grant(r.Context(), userID, req.ClientID, req.Scope); err != nil {
+			h.redirectError(w, r, req, err)
+			return false
+		}
+		return true
+	case "deny":
+		h.redirectError(w, r, req, fmt.Errorf("%w: the user denied the request", apperror.ErrAccessDenied))
+		return false
+	}
+
+	if req.Prompt[service.PromptNone] {
+		h.redirectError(w, r, req, apperror.ErrConsentRequired)
+		return false
+	}
+
+	params := url.Values{}
+	for key, values := range r.Form {
+		if key != "consent" {
+			params[key] = values
+		}
+	}
+	http.Redirect(w, r, consentPagePath+"?"+params.Encode(), http.StatusFound)
+
+	return false
+}
+
+// PushAuthorization stores the request parameters for a later /authorize
+// call, RFC 9126 section 2.
+func (h *OIDCHandler) PushAuthorization(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, apperror.ErrInvalidRequest)
+		return
+	}
+
+	clientID, clientSecret := clientCredentials(r)
+
+	requestURI, expiresIn, err := h.oidcService.PushAuthorizationRequest(r.Context(), clientID, clientSecret, r.PostForm)
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	writeOAuthJSON(w, http.StatusCreated, dto.PushedAuthorizationResponse{
+		RequestURI: requestURI,
+		ExpiresIn:  int64(expiresIn.Seconds()),
+	})
+}
+
+func (h *OIDCHandler) Token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, apperror.ErrInvalidRequest)
+		return
+	}
+
+	clientID, clientSecret := clientCredentials(r)
+
+	tokens, err := h.oidcService.Token(r.Context(), &model.TokenRequest{
+		GrantType:    r.PostForm.Get("grant_type"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Code:         r.PostForm.Get("code"),
+		RedirectURI:  r.PostForm.Get("redirect_uri"),
+		CodeVerifier: r.PostForm.Get("code_verifier"),
+		RefreshToken: r.PostForm.Get("refresh_token"),
+		DeviceCode:   r.PostForm.Get("device_code"),
+		Scope:        r.PostForm.Get("scope"),
+
+		SubjectToken:       r.PostForm.Get("subject_token"),
+		SubjectTokenType:   r.PostForm.Get("subject_token_type"),
+		RequestedTokenType: r.PostForm.Get("requested_token_type"),
+		Audience:           r.PostForm.Get("audience"),
+	})
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	writeOAuthJSON(w, http.StatusOK, dto.OAuthTokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(time.Until(tokens.AccessExpiresAt).Seconds()),
+		RefreshToken: tokens.RefreshToken,
+		IDToken:      tokens.IDToken,
+		Scope:        tokens.Scope,
+
+		IssuedTokenType: tokens.IssuedTokenType,
+	})
+}
+
+func (h *OIDCHandler) Introspect(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, apperror.ErrInvalidRequest)
+		return
+	}
+
+	clientID, clientSecret := clientCredentials(r)
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeOAuthError(w, fmt.Errorf("%w: missing token", apperror.ErrInvalidRequest))
+		return
+	}
+
+	info, err := h.oidcService.Introspect(r.Context(), clientID, clientSecret, token, r.PostForm.Get("token_type_hint"))
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	writeOAuthJSON(w, http.StatusOK, introspectionDTO(info))
+}
+
+func (h *OIDCHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, apperror.ErrInvalidRequest)
+		return
+	}
+
+	clientID, clientSecret := clientCredentials(r)
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeOAuthError(w, fmt.Errorf("%w: missing token", apperror.ErrInvalidRequest))
+		return
+	}
+
+	if err := h.oidcService.Revoke(r.Context(), clientID, clientSecret, token, r.PostForm.Get("token_type_hint")); err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *OIDCHandler) UserInfo(w http.ResponseWriter, r *http.Request) {
+	requesterID := r.Context().Value(middleware.RequesterIDKey).(uuid.UUID)
+	claims := r.Context().Value(middleware.ClaimsKey).(*utils.UserClaims)
+
+	user, err := h.oidcService.UserInfo(r.Context(), requesterID)
+	if err != nil {
+		errMsg, errCode := apperror.GetMsgCode(err)
+		http.Error(w, errMsg, errCode)
+		return
+	}
+
+	resp := dto.UserInfo{Sub: user.ID.String()}
+	// first-party tokens have no scope and see everything
+	if claims.ClientID == "" || utils.HasScope(claims.Scope, utils.ScopeProfile) {
+		resp.PreferredUsername = user.Login
+	}
+	if (claims.ClientID == "" || utils.HasScope(claims.Scope, utils.ScopeEmail)) && user.Email != nil {
+		resp.Email = *user.Email
+		resp.EmailVerified = &user.EmailVerified
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, "Encoding response body error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *OIDCHandler) Discovery(w http.ResponseWriter, r *http.Request) {
+	issuer := strings.TrimSuffix(h.cfg.JWT.Issuer, "/")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	if err := json.NewEncoder(w).Encode(dto.OpenIDConfiguration{
+		Issuer:                                 h.cfg.JWT.Issuer,
+		AuthorizationEndpoint:                  issuer + "/authorize",
+		TokenEndpoint:                          issuer + "/token",
+		UserInfoEndpoint:                       issuer + "/userinfo",
+		IntrospectionEndpoint:                  issuer + "/introspect",
+		RevocationEndpoint:                     issuer + "/revoke",
+		DeviceAuthorizationEndpoint:            issuer + "/device/code",
+		EndSessionEndpoint:                     issuer + "/end_session",
+		RegistrationEndpoint:                   issuer + registrationPath,
+		PushedAuthorizationRequestEndpoint:     issuer + "/par",
+		RequestParameterSupported:              true,
+		RequestURIParameterSupported:           false,
+		RequestObjectSigningAlgValuesSupported: utils.RequestObjectAlgorithms,
+		BackchannelLogoutSupported:             true,
+		JWKSURI:                                issuer + "/.well-known/jwks.json",
+		ScopesSupported:                        append(slices.Clone(utils.UserScopes), utils.ScopeUsersRead),
+		ResponseTypesSupported:                 []string{"code"},
+		GrantTypesSupported:                    service.SupportedGrantTypes,
+		SubjectTypesSupported:                  []string{"public"},
+		IDTokenSigningAlgValuesSupported:       h.oidcService.SigningAlgorithms(),
+		TokenEndpointAuthMethodsSupported:      []string{"none", "client_secret_basic", "client_secret_post"},
+		CodeChallengeMethodsSupported:          []string{utils.PKCEMethodS256},
+		ACRValuesSupported:                     service.ACRValuesSupported,
+		ClaimsSupported: []string{
+			"sub", "iss", "aud", "exp", "iat", "nonce", "at_hash", "auth_time", "amr", "acr", "preferred_username",
+			"email", "email_verified",
+		},
+	}); err != nil {
+		http.Error(w, "Encoding response body error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func introspectionDTO(info *model.TokenInfo) dto.Introspection {
+	if !info.Active {
+		return dto.Introspection{}
+	}
+
+	resp := dto.Introspection{
+		Active:    true,
+		TokenType: info.TokenType,
+		Scope:     info.Scope,
+		ClientID:  info.ClientID,
+		Username:  info.Username,
+		Sub:       info.Subject,
+		Aud:       info.Audience,
+		Iss:       info.Issuer,
+		JTI:       info.JTI,
+	}
+	if !info.IssuedAt.IsZero() {
+		resp.Iat = info.IssuedAt.Unix()
+	}
+	if !info.ExpiresAt.IsZero() {
+		resp.Exp = info.ExpiresAt.Unix()
+	}
+
+	return resp
+}
+
+func (h *OIDCHandler) sessionClaims(r *http.Request) (*utils.UserClaims, bool) {
+	claims, err := middleware.CookieClaims(r, h.tokenService, h.cfg.JWT.CookieName)
+	if err != nil {
+		return nil, false
+	}
+
+	return claims, true
+}
+
+// sessionUser returns the user logged in to isso itself.
+func sessionUser(r *http.Request, tokenService *service.TokenService, cookieName string) (uuid.UUID, bool) {
+	claims, err := middleware.CookieClaims(r, tokenService, cookieName)
+	if err != nil {
+		return uuid.UUID{}, false
+	}
+
+	return claims.ID, true
+}
+
+func (h *OIDCHandler) redirectError(w http.ResponseWriter, r *http.Request, req *model.AuthorizationRequest, err error) {
+	code, errCode := apperror.GetOAuthCode(err)
+
+	description := ""
+	if errCode != http.StatusInternalServerError {
+		description = err.Error()
+	}
+
+	redirectWithParams(w, r, req.RedirectURI, url.Values{
+		"error":             {code},
+		"error_description": {description},
+		"state":             {req.State},
+		"iss":               {h.cfg.JWT.Issuer},
+	})
+}
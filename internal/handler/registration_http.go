@@ -0,0 +1,220 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/config"
+	"github.com/kkonst40/isso/internal/dto"
+	"github.com/kkonst40/isso/internal/middleware"
+	"github.com/kkonst40/isso/internal/model"
+	"github.com/kkonst40/isso/internal/service"
+	"github.com/kkonst40/isso/internal/utils"
+)
+
+const (
+	registrationPath = "/register-client"
+
+	authMethodNone              = "none"
+	authMethodClientSecretBasic = "client_secret_basic"
+	authMethodClientSecretPost  = "client_secret_post"
+)
+
+type RegistrationHandler struct {
+	registrationService *service.RegistrationService
+	cfg                 *config.Config
+}
+
+func NewRegistrationHandler(registrationService *service.RegistrationService, cfg *config.Config) *RegistrationHandler {
+	return &RegistrationHandler{
+		registrationService: registrationService,
+		cfg:                 cfg,
+	}
+}
+
+func (h *RegistrationHandler) Register(w http.ResponseWriter, r *http.Request) {
+	initialToken, ok := middleware.BearerToken(r)
+	if !ok {
+		writeRegistrationError(w, fmt.Errorf("%w: missing initial access token", apperror.ErrInvalidToken))
+		return
+	}
+
+	client, err := decodeClientMetadata(r)
+	if err != nil {
+		writeRegistrationError(w, err)
+		return
+	}
+
+	secret, registrationToken, err := h.registrationService.Register(r.Context(), initialToken, client)
+	if err != nil {
+		writeRegistrationError(w, err)
+		return
+	}
+
+	writeOAuthJSON(w, http.StatusCreated, h.clientInformation(client, secret, registrationToken))
+}
+
+func (h *RegistrationHandler) Get(w http.ResponseWriter, r *http.Request) {
+	registrationToken, ok := middleware.BearerToken(r)
+	if !ok {
+		writeRegistrationError(w, fmt.Errorf("%w: missing registration access token", apperror.ErrInvalidToken))
+		return
+	}
+
+	client, err := h.registrationService.Get(r.Context(), r.PathValue("id"), registrationToken)
+	if err != nil {
+		writeRegistrationError(w, err)
+		return
+	}
+
+	writeOAuthJSON(w, http.StatusOK, h.clientInformation(client, "", ""))
+}
+
+func (h *RegistrationHandler) Update(w http.ResponseWriter, r *http.Request) {
+	registrationToken, ok := middleware.BearerToken(r)
+	if !ok {
+		writeRegistrationError(w, fmt.Errorf("%w: missing registration access token", apperror.ErrInvalidToken))
+		return
+	}
+
+	client, err := decodeClientMetadata(r)
+	if err != nil {
+		writeRegistrationError(w, err)
+		return
+	}
+
+	newToken, err := h.registrationService.Update(r.Context(), r.PathValue("id"), registrationToken, client)
+	if err != nil {
+		writeRegistrationError(w, err)
+		return
+	}
+
+	writeOAuthJSON(w, http.StatusOK, h.clientInformation(client, "", newToken))
+}
+
+func (h *RegistrationHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	registrationToken, ok := middleware.BearerToken(r)
+	if !ok {
+		writeRegistrationError(w, fmt.Errorf("%w: missing registration access token", apperror.ErrInvalidToken))
+		return
+	}
+
+	if err := h.registrationService.Delete(r.Context(), r.PathValue("id"), registrationToken); err != nil {
+		writeRegistrationError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *RegistrationHandler) CreateInitialToken(w http.ResponseWriter, r *http.Request) {
+	requesterID := r.Context().Value(middleware.RequesterIDKey).(uuid.UUID)
+
+	var req dto.CreateInitialAccessToken
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	token, expiresAt, err := h.registrationService.CreateInitialToken(
+		r.Context(),
+		requesterID,
+		time.Duration(req.TTLSeconds)*time.Second,
+	)
+	if err != nil {
+		errMsg, errCode := apperror.GetMsgCode(err)
+		http.Error(w, errMsg, errCode)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+
+	if err := json.NewEncoder(w).Encode(dto.InitialAccessToken{
+		Token:     token,
+		ExpiresAt: expiresAt.Unix(),
+	}); err != nil {
+		http.Error(w, "Encoding response body error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *RegistrationHandler) clientInformation(client *model.Client, secret, registrationToken string) dto.ClientInformation {
+	authMethod := authMethodClientSecretBasic
+	if client.Public {
+		authMethod = authMethodNone
+	}
+
+	info := dto.ClientInformation{
+		ClientMetadata: dto.ClientMetadata{
+			RedirectURIs:            client.RedirectURIs,
+			TokenEndpointAuthMethod: authMethod,
+			GrantTypes:              client.GrantTypes,
+			ClientName:              client.Name,
+			Scope:                   strings.Join(client.Scopes, " "),
+			PostLogoutRedirectURIs:  client.PostLogoutRedirectURIs,
+			BackchannelLogoutURI:    client.BackchannelLogoutURI,
+			JWKS:                    rawJSON(client.JWKS),
+			RequirePAR:              client.RequirePAR,
+		},
+		ClientID:                client.ID,
+		ClientSecret:            secret,
+		ClientIDIssuedAt:        client.CreatedAt.Unix(),
+		RegistrationAccessToken: registrationToken,
+		RegistrationClientURI:   strings.TrimSuffix(h.cfg.JWT.Issuer, "/") + registrationPath + "/" + client.ID,
+	}
+	if secret != "" {
+		// secrets don't expire
+		var never int64
+		info.ClientSecretExpiresAt = &never
+	}
+
+	return info
+}
+
+func decodeClientMetadata(r *http.Request) (*model.Client, error) {
+	var req dto.ClientMetadata
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, fmt.Errorf("%w: invalid request body", apperror.ErrInvalidClientMetadata)
+	}
+
+	client := &model.Client{
+		Name:                   req.ClientName,
+		RedirectURIs:           req.RedirectURIs,
+		GrantTypes:             req.GrantTypes,
+		Scopes:                 utils.Scopes(req.Scope),
+		PostLogoutRedirectURIs: req.PostLogoutRedirectURIs,
+		BackchannelLogoutURI:   req.BackchannelLogoutURI,
+		JWKS:                   string(req.JWKS),
+		RequirePAR:             req.RequirePAR,
+	}
+
+	switch req.TokenEndpointAuthMethod {
+	case authMethodNone:
+		client.Public = true
+	case "", authMethodClientSecretBasic, authMethodClientSecretPost:
+	default:
+		return nil, fmt.Errorf("%w: unsupported token_endpoint_auth_method", apperror.ErrInvalidClientMetadata)
+	}
+
+	return client, nil
+}
+
+// writeRegistrationError reports bad bearer tokens as RFC 6750 errors and
+// the rest as RFC 7591 errors.
+func writeRegistrationError(w http.ResponseWriter, err error) {
+	if errors.Is(err, apperror.ErrInvalidToken) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="isso", error="invalid_token"`)
+		writeOAuthJSON(w, http.StatusUnauthorized, dto.OAuthError{Error: "invalid_token"})
+		return
+	}
+
+	writeOAuthError(w, err)
+}
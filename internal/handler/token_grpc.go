@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/kkonst40/isso/internal/apperror"
+	pb "github.com/kkonst40/isso/internal/gen/user"
+	"github.com/kkonst40/isso/internal/service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type TokenGRPCHandler struct {
+	pb.UnimplementedTokenServiceServer
+	oidcService *service.OIDCService
+}
+
+func NewTokenGRPCHandler(oidcService *service.OIDCService) *TokenGRPCHandler {
+	return &TokenGRPCHandler{oidcService: oidcService}
+}
+
+func (s *TokenGRPCHandler) Introspect(ctx context.Context, req *pb.IntrospectRequest) (*pb.IntrospectResponse, error) {
+	if req.Token == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing token")
+	}
+
+	info, err := s.oidcService.Introspect(ctx, req.ClientId, req.ClientSecret, req.Token, req.TokenTypeHint)
+	if err != nil {
+		return nil, oauthGRPCError(err)
+	}
+
+	resp := introspectionDTO(info)
+
+	return &pb.IntrospectResponse{
+		Active:    resp.Active,
+		Scope:     resp.Scope,
+		ClientId:  resp.ClientID,
+		Username:  resp.Username,
+		TokenType: resp.TokenType,
+		Exp:       resp.Exp,
+		Iat:       resp.Iat,
+		Sub:       resp.Sub,
+		Aud:       resp.Aud,
+		Iss:       resp.Iss,
+		Jti:       resp.JTI,
+	}, nil
+}
+
+func (s *TokenGRPCHandler) Revoke(ctx context.Context, req *pb.RevokeRequest) (*pb.RevokeResponse, error) {
+	if req.Token == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing token")
+	}
+
+	if err := s.oidcService.Revoke(ctx, req.ClientId, req.ClientSecret, req.Token, req.TokenTypeHint); err != nil {
+		return nil, oauthGRPCError(err)
+	}
+
+	return &pb.RevokeResponse{}, nil
+}
+
+// oauthGRPCError is grpcError for OAuth errors, the OAuth error code is
+// the status message.
+func oauthGRPCError(err error) error {
+	oauthCode, httpCode := apperror.GetOAuthCode(err)
+
+	var code codes.Code
+	switch httpCode {
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+		if oauthCode == apperror.ErrUnauthorizedClient.Error() {
+			code = codes.PermissionDenied
+		}
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	default:
+		return status.Error(codes.Internal, oauthCode)
+	}
+
+	return status.Error(code, err.Error())
+}
@@ -2,10 +2,15 @@ package handler
 
 import (
 	"context"
+	"net/http"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
 	pb "github.com/kkonst40/isso/internal/gen/user"
 	"github.com/kkonst40/isso/internal/service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type UserGRPCHandler struct {
@@ -39,3 +44,38 @@ func (s *UserGRPCHandler) Exist(ctx context.Context, req *pb.ExistRequest) (*pb.
 
 	return &pb.ExistResponse{ExistingIds: result}, nil
 }
+
+func (s *UserGRPCHandler) Refresh(ctx context.Context, req *pb.RefreshRequest) (*pb.RefreshResponse, error) {
+	tokens, err := s.userService.Refresh(ctx, req.RefreshToken)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &pb.RefreshResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    int64(time.Until(tokens.AccessExpiresAt).Seconds()),
+	}, nil
+}
+
+func grpcError(err error) error {
+	errMsg, errCode := apperror.GetMsgCode(err)
+
+	var code codes.Code
+	switch errCode {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		code = codes.InvalidArgument
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusConflict:
+		code = codes.AlreadyExists
+	default:
+		code = codes.Internal
+	}
+
+	return status.Error(code, errMsg)
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
 	"time"
 
@@ -10,7 +11,9 @@ import (
 	"github.com/kkonst40/isso/internal/config"
 	"github.com/kkonst40/isso/internal/dto"
 	"github.com/kkonst40/isso/internal/middleware"
+	"github.com/kkonst40/isso/internal/model"
 	"github.com/kkonst40/isso/internal/service"
+	"github.com/kkonst40/isso/internal/utils"
 )
 
 type UserHandler struct {
@@ -26,7 +29,27 @@ func New(userService *service.UserService, cfg *config.Config) *UserHandler {
 }
 
 func (h *UserHandler) Me(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
+	requesterID := r.Context().Value(middleware.RequesterIDKey).(uuid.UUID)
+
+	user, err := h.userService.Get(r.Context(), requesterID)
+	if err != nil {
+		errMsg, errCode := apperror.GetMsgCode(err)
+		http.Error(w, errMsg, errCode)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := json.NewEncoder(w).Encode(dto.GetUser{
+		ID:            user.ID,
+		Login:         user.Login,
+		Email:         user.Email,
+		EmailVerified: &user.EmailVerified,
+	}); err != nil {
+		http.Error(w, "Encoding response body error", http.StatusInternalServerError)
+		return
+	}
 }
 
 func (h *UserHandler) All(w http.ResponseWriter, r *http.Request) {
@@ -85,38 +108,244 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := h.userService.Login(r.Context(), req.Login, req.Password)
+	result, err := h.userService.Login(r.Context(), req.Login, req.Password)
 	if err != nil {
 		errMsg, errCode := apperror.GetMsgCode(err)
 		http.Error(w, errMsg, errCode)
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     h.cfg.JWT.CookieName,
-		Value:    token,
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   false, // false только для localhost без https
-		SameSite: http.SameSiteLaxMode,
-		Expires:  time.Now().Add(60 * 24 * time.Hour),
-	})
+	h.writeLoginResult(w, result)
+}
+
+// Reauthenticate asks the logged in user for the password again before
+// a sensitive change, it answers the same way as Login.
+func (h *UserHandler) Reauthenticate(w http.ResponseWriter, r *http.Request) {
+	requesterID := r.Context().Value(middleware.RequesterIDKey).(uuid.UUID)
+
+	var req dto.Reauthenticate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.userService.Reauthenticate(r.Context(), requesterID, req.Password)
+	if err != nil {
+		errMsg, errCode := apperror.GetMsgCode(err)
+		http.Error(w, errMsg, errCode)
+		return
+	}
+
+	h.writeLoginResult(w, result)
+}
+
+func (h *UserHandler) writeLoginResult(w http.ResponseWriter, result *model.LoginResult) {
+	if result.MFAToken != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+
+		if err := json.NewEncoder(w).Encode(dto.MFARequired{
+			Status:   dto.LoginStatusMFARequired,
+			MFAToken: result.MFAToken,
+			Methods:  result.MFAMethods,
+		}); err != nil {
+			http.Error(w, "Encoding response body error", http.StatusInternalServerError)
+			return
+		}
+		return
+	}
+
+	h.setTokenCookies(w, result.Tokens)
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func (h *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
-	requesterID := r.Context().Value(middleware.RequesterIDKey).(uuid.UUID)
-	err := h.userService.Logout(r.Context(), requesterID)
+// LoginTOTP finishes a login that returned mfa_required.
+func (h *UserHandler) LoginTOTP(w http.ResponseWriter, r *http.Request) {
+	var req dto.MFALogin
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := h.userService.LoginTOTP(r.Context(), req.MFAToken, req.Code)
 	if err != nil {
-		//
+		errMsg, errCode := apperror.GetMsgCode(err)
+		http.Error(w, errMsg, errCode)
+		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:   "pechenye",
-		Value:  "",
-		MaxAge: -1,
-	})
+	h.setTokenCookies(w, tokens)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *UserHandler) LoginRecoveryCode(w http.ResponseWriter, r *http.Request) {
+	var req dto.MFALogin
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := h.userService.LoginRecoveryCode(r.Context(), req.MFAToken, req.Code)
+	if err != nil {
+		errMsg, errCode := apperror.GetMsgCode(err)
+		http.Error(w, errMsg, errCode)
+		return
+	}
+
+	h.setTokenCookies(w, tokens)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// StartEmailLogin always answers 202 with a challenge, whether the login
+// exists or not.
+func (h *UserHandler) StartEmailLogin(w http.ResponseWriter, r *http.Request) {
+	var req dto.EmailLoginStart
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	challengeID, err := h.userService.StartEmailLogin(r.Context(), req.Login, req.ReturnTo)
+	if err != nil {
+		errMsg, errCode := apperror.GetMsgCode(err)
+		http.Error(w, errMsg, errCode)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusAccepted)
+
+	if err := json.NewEncoder(w).Encode(dto.EmailLoginChallenge{ChallengeID: challengeID}); err != nil {
+		http.Error(w, "Encoding response body error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *UserHandler) LoginEmailCode(w http.ResponseWriter, r *http.Request) {
+	var req dto.EmailLoginCode
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.userService.LoginEmailCode(r.Context(), req.ChallengeID, req.Code)
+	if err != nil {
+		errMsg, errCode := apperror.GetMsgCode(err)
+		http.Error(w, errMsg, errCode)
+		return
+	}
+
+	h.writeLoginResult(w, result)
+}
+
+// LoginEmailLink is posted by the login page the mailed link opens.
+func (h *UserHandler) LoginEmailLink(w http.ResponseWriter, r *http.Request) {
+	var req dto.EmailLoginLink
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.userService.LoginEmailLink(r.Context(), req.Token)
+	if err != nil {
+		errMsg, errCode := apperror.GetMsgCode(err)
+		http.Error(w, errMsg, errCode)
+		return
+	}
+
+	h.writeLoginResult(w, result)
+}
+
+// BeginLoginWebAuthn accepts an empty body for a passwordless login.
+func (h *UserHandler) BeginLoginWebAuthn(w http.ResponseWriter, r *http.Request) {
+	var req dto.WebAuthnBeginLogin
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	ceremony, err := h.userService.BeginLoginWebAuthn(r.Context(), req.MFAToken)
+	if err != nil {
+		errMsg, errCode := apperror.GetMsgCode(err)
+		http.Error(w, errMsg, errCode)
+		return
+	}
+
+	writeCeremony(w, ceremony)
+}
+
+func (h *UserHandler) LoginWebAuthn(w http.ResponseWriter, r *http.Request) {
+	var req dto.WebAuthnLogin
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := h.userService.LoginWebAuthn(r.Context(), req.MFAToken, req.SessionID, req.Credential)
+	if err != nil {
+		errMsg, errCode := apperror.GetMsgCode(err)
+		http.Error(w, errMsg, errCode)
+		return
+	}
+
+	h.setTokenCookies(w, tokens)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *UserHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var refreshToken string
+	if cookie, err := r.Cookie(h.cfg.JWT.RefreshCookieName); err == nil {
+		refreshToken = cookie.Value
+	} else {
+		var req dto.RefreshRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		refreshToken = req.RefreshToken
+	}
+
+	if refreshToken == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tokens, err := h.userService.Refresh(r.Context(), refreshToken)
+	if err != nil {
+		errMsg, errCode := apperror.GetMsgCode(err)
+		http.Error(w, errMsg, errCode)
+		return
+	}
+
+	h.setTokenCookies(w, tokens)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(dto.TokenResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    int64(time.Until(tokens.AccessExpiresAt).Seconds()),
+	}); err != nil {
+		http.Error(w, "Encoding response body error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	requesterID := r.Context().Value(middleware.RequesterIDKey).(uuid.UUID)
+
+	clearTokenCookies(w, h.cfg)
+
+	if err := h.userService.Logout(r.Context(), requesterID); err != nil {
+		errMsg, errCode := apperror.GetMsgCode(err)
+		http.Error(w, errMsg, errCode)
+		return
+	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -161,6 +390,7 @@ func (h *UserHandler) UpdateLogin(w http.ResponseWriter, r *http.Request) {
 
 func (h *UserHandler) UpdatePassword(w http.ResponseWriter, r *http.Request) {
 	requesterID := r.Context().Value(middleware.RequesterIDKey).(uuid.UUID)
+	claims := r.Context().Value(middleware.ClaimsKey).(*utils.UserClaims)
 
 	var req dto.LRUUser
 	err := json.NewDecoder(r.Body).Decode(&req)
@@ -169,13 +399,15 @@ func (h *UserHandler) UpdatePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.userService.UpdatePassword(r.Context(), requesterID, req.Password)
+	tokens, err := h.userService.UpdatePassword(r.Context(), requesterID, req.Password, claims.Authentication())
 	if err != nil {
 		errMsg, errCode := apperror.GetMsgCode(err)
 		http.Error(w, errMsg, errCode)
 		return
 	}
 
+	h.setTokenCookies(w, tokens)
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -196,3 +428,61 @@ func (h *UserHandler) Delete(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// refresh cookie is only sent to the refresh endpoint
+const refreshCookiePath = "/token/refresh"
+
+func (h *UserHandler) setTokenCookies(w http.ResponseWriter, tokens *model.TokenPair) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     h.cfg.JWT.CookieName,
+		Value:    tokens.AccessToken,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   false, // false только для localhost без https
+		SameSite: http.SameSiteLaxMode,
+		Expires:  tokens.AccessExpiresAt,
+	})
+	if tokens.ForwardAuthToken != "" {
+		http.SetCookie(w, &http.Cookie{
+			Name:     forwardAuthCookieName(h.cfg),
+			Value:    tokens.ForwardAuthToken,
+			Path:     "/",
+			Domain:   h.cfg.ForwardAuth.CookieDomain,
+			HttpOnly: true,
+			Secure:   false,
+			SameSite: http.SameSiteLaxMode,
+			Expires:  tokens.AccessExpiresAt,
+		})
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     h.cfg.JWT.RefreshCookieName,
+		Value:    tokens.RefreshToken,
+		Path:     refreshCookiePath,
+		HttpOnly: true,
+		Secure:   false,
+		SameSite: http.SameSiteStrictMode,
+		Expires:  tokens.RefreshExpiresAt,
+	})
+}
+
+func clearTokenCookies(w http.ResponseWriter, cfg *config.Config) {
+	http.SetCookie(w, &http.Cookie{
+		Name:   cfg.JWT.CookieName,
+		Value:  "",
+		Path:   "/",
+		MaxAge: -1,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:   forwardAuthCookieName(cfg),
+		Value:  "",
+		Path:   "/",
+		Domain: cfg.ForwardAuth.CookieDomain,
+		MaxAge: -1,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:   cfg.JWT.RefreshCookieName,
+		Value:  "",
+		Path:   refreshCookiePath,
+		MaxAge: -1,
+	})
+}
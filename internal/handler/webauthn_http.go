@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/dto"
+	"github.com/kkonst40/isso/internal/middleware"
+	"github.com/kkonst40/isso/internal/model"
+	"github.com/kkonst40/isso/internal/service"
+)
+
+type WebAuthnHandler struct {
+	passkeyService *service.WebAuthnService
+}
+
+func NewWebAuthnHandler(passkeyService *service.WebAuthnService) *WebAuthnHandler {
+	return &WebAuthnHandler{
+		passkeyService: passkeyService,
+	}
+}
+
+func (h *WebAuthnHandler) Credentials(w http.ResponseWriter, r *http.Request) {
+	requesterID := r.Context().Value(middleware.RequesterIDKey).(uuid.UUID)
+
+	creds, err := h.passkeyService.Credentials(r.Context(), requesterID)
+	if err != nil {
+		errMsg, errCode := apperror.GetMsgCode(err)
+		http.Error(w, errMsg, errCode)
+		return
+	}
+
+	passkeys := make([]dto.Passkey, 0, len(creds))
+	for _, cred := range creds {
+		passkeys = append(passkeys, passkeyDTO(&cred))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(passkeys); err != nil {
+		http.Error(w, "Encoding response body error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *WebAuthnHandler) BeginRegistration(w http.ResponseWriter, r *http.Request) {
+	requesterID := r.Context().Value(middleware.RequesterIDKey).(uuid.UUID)
+
+	ceremony, err := h.passkeyService.BeginRegistration(r.Context(), requesterID)
+	if err != nil {
+		errMsg, errCode := apperror.GetMsgCode(err)
+		http.Error(w, errMsg, errCode)
+		return
+	}
+
+	writeCeremony(w, ceremony)
+}
+
+func (h *WebAuthnHandler) FinishRegistration(w http.ResponseWriter, r *http.Request) {
+	requesterID := r.Context().Value(middleware.RequesterIDKey).(uuid.UUID)
+
+	var req dto.WebAuthnRegistration
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	cred, codes, err := h.passkeyService.FinishRegistration(r.Context(), requesterID, req.SessionID, req.Name, req.Credential)
+	if err != nil {
+		errMsg, errCode := apperror.GetMsgCode(err)
+		http.Error(w, errMsg, errCode)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	if err := json.NewEncoder(w).Encode(dto.PasskeyRegistered{
+		Passkey:       passkeyDTO(cred),
+		RecoveryCodes: codes,
+	}); err != nil {
+		http.Error(w, "Encoding response body error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *WebAuthnHandler) DeleteCredential(w http.ResponseWriter, r *http.Request) {
+	requesterID := r.Context().Value(middleware.RequesterIDKey).(uuid.UUID)
+
+	ID, err := base64.RawURLEncoding.DecodeString(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid request parameter 'id'", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.passkeyService.DeleteCredential(r.Context(), requesterID, ID); err != nil {
+		errMsg, errCode := apperror.GetMsgCode(err)
+		http.Error(w, errMsg, errCode)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func passkeyDTO(cred *model.WebAuthnCredential) dto.Passkey {
+	return dto.Passkey{
+		ID:         base64.RawURLEncoding.EncodeToString(cred.ID),
+		Name:       cred.Name,
+		CreatedAt:  cred.CreatedAt,
+		LastUsedAt: cred.LastUsedAt,
+	}
+}
+
+func writeCeremony(w http.ResponseWriter, ceremony *model.WebAuthnCeremony) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := json.NewEncoder(w).Encode(dto.WebAuthnCeremony{
+		SessionID: ceremony.SessionID,
+		Options:   ceremony.Options,
+	}); err != nil {
+		http.Error(w, "Encoding response body error", http.StatusInternalServerError)
+		return
+	}
+}
@@ -2,37 +2,52 @@ package middleware
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 
+	"github.com/kkonst40/isso/internal/apperror"
 	"github.com/kkonst40/isso/internal/utils"
 )
 
 type contextKey string
 
-const RequesterIDKey contextKey = "requesterID"
+const (
+	RequesterIDKey contextKey = "requesterID"
+	ClaimsKey      contextKey = "claims"
+)
 
-func Auth(next http.HandlerFunc, jwtProvider *utils.JWTProvider) http.HandlerFunc {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie(jwtProvider.Cfg.JWT.CookieName)
-		if err != nil {
-			http.Error(w, "Invalid cookie", http.StatusUnauthorized)
-			return
-		}
+type TokenValidator interface {
+	ValidateToken(ctx context.Context, tokenString string) (*utils.UserClaims, error)
+}
 
-		tokenString := cookie.Value
-		if tokenString == "" {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
+type TokenValidatorFunc func(ctx context.Context, tokenString string) (*utils.UserClaims, error)
+
+func (f TokenValidatorFunc) ValidateToken(ctx context.Context, tokenString string) (*utils.UserClaims, error) {
+	return f(ctx, tokenString)
+}
 
-		claims, err := jwtProvider.ValidateToken(tokenString)
+func Auth(next http.HandlerFunc, validator TokenValidator, cookieName string) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := CookieClaims(r, validator, cookieName)
 		if err != nil {
-			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+			errMsg, errCode := apperror.GetMsgCode(err)
+			http.Error(w, errMsg, errCode)
 			return
 		}
 
 		ctx := context.WithValue(r.Context(), RequesterIDKey, claims.ID)
+		ctx = context.WithValue(ctx, ClaimsKey, claims)
 
 		next(w, r.WithContext(ctx))
 	})
 }
+
+// CookieClaims validates the session cookie of the request.
+func CookieClaims(r *http.Request, validator TokenValidator, cookieName string) (*utils.UserClaims, error) {
+	cookie, err := r.Cookie(cookieName)
+	if err != nil || cookie.Value == "" {
+		return nil, fmt.Errorf("%w: missing session cookie", apperror.ErrInvalidToken)
+	}
+
+	return validator.ValidateToken(r.Context(), cookie.Value)
+}
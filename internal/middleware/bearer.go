@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/kkonst40/isso/internal/apperror"
+)
+
+// Bearer authenticates OAuth access tokens from the Authorization header,
+// errors are reported as described in RFC 6750 section 3.
+func Bearer(next http.HandlerFunc, validator TokenValidator) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenString, ok := BearerToken(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="isso"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		claims, err := validator.ValidateToken(r.Context(), tokenString)
+		if err != nil {
+			errMsg, errCode := apperror.GetMsgCode(err)
+			if errCode == http.StatusUnauthorized {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="isso", error="invalid_token"`)
+			}
+			http.Error(w, errMsg, errCode)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), RequesterIDKey, claims.ID)
+		ctx = context.WithValue(ctx, ClaimsKey, claims)
+
+		next(w, r.WithContext(ctx))
+	})
+}
+
+func BearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+
+	return token, true
+}
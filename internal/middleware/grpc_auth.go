@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+
+	"github.com/kkonst40/isso/internal/apperror"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCAuth validates the bearer token from the "authorization" metadata,
+// when it is present, and stores the requester in the context the same way
+// Auth does for HTTP handlers. Methods listed in scopes require a token
+// with the given scope.
+func GRPCAuth(validator TokenValidator, scopes map[string]string) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req any,
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		scope, scoped := scopes[info.FullMethod]
+
+		var values []string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			values = md.Get("authorization")
+		}
+		if len(values) == 0 {
+			if scoped {
+				return nil, status.Error(codes.Unauthenticated, "Unauthorized")
+			}
+			return handler(ctx, req)
+		}
+
+		tokenString, ok := strings.CutPrefix(values[0], "Bearer ")
+		if !ok || tokenString == "" {
+			return nil, status.Error(codes.Unauthenticated, "Invalid authorization metadata")
+		}
+
+		claims, err := validator.ValidateToken(ctx, tokenString)
+		if err != nil {
+			errMsg, errCode := apperror.GetMsgCode(err)
+			if errCode >= 500 {
+				return nil, status.Error(codes.Internal, errMsg)
+			}
+			return nil, status.Error(codes.Unauthenticated, errMsg)
+		}
+
+		ctx = context.WithValue(ctx, RequesterIDKey, claims.ID)
+		ctx = context.WithValue(ctx, ClaimsKey, claims)
+
+		if scoped && !hasScope(ctx, scope) {
+			return nil, status.Error(codes.PermissionDenied, "Insufficient scope")
+		}
+
+		return handler(ctx, req)
+	}
+}
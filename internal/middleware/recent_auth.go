@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/kkonst40/isso/internal/utils"
+)
+
+// RecentAuth rejects requests whose session, stored by Auth, logged in
+// longer than maxAge ago. The client is told to re-authenticate as
+// described in RFC 9470 section 3.
+func RecentAuth(next http.HandlerFunc, maxAge time.Duration) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(ClaimsKey).(*utils.UserClaims)
+		if !ok || claims.AuthTime == nil || time.Since(claims.AuthTime.Time) > maxAge {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(
+				`Bearer realm="isso", error="insufficient_user_authentication", `+
+					`error_description="A more recent authentication is required", max_age=%d`,
+				int(maxAge.Seconds()),
+			))
+			http.Error(w, "Re-authentication required", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	})
+}
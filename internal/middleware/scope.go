@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/kkonst40/isso/internal/utils"
+)
+
+// RequireScope rejects requests whose token, stored by Bearer, lacks the
+// scope, as described in RFC 6750 section 3.1.
+func RequireScope(next http.HandlerFunc, scope string) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !hasScope(r.Context(), scope) {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="isso", error="insufficient_scope", scope="%s"`, scope))
+			http.Error(w, "Insufficient scope", http.StatusForbidden)
+			return
+		}
+
+		next(w, r)
+	})
+}
+
+func hasScope(ctx context.Context, scope string) bool {
+	claims, ok := ctx.Value(ClaimsKey).(*utils.UserClaims)
+	return ok && utils.HasScope(claims.Scope, scope)
+}
@@ -0,0 +1,47 @@
+package model
+
+import (
+	"slices"
+	"time"
+)
+
+type Client struct {
+	ID           string
+	Name         string
+	SecretHash   string
+	RedirectURIs []string
+	GrantTypes   []string
+	Scopes       []string
+	// audiences the client may exchange user tokens into
+	ExchangeAudiences      []string
+	PostLogoutRedirectURIs []string
+	// empty if the client doesn't want back-channel logout notifications
+	BackchannelLogoutURI string
+	// set for dynamically registered clients only
+	RegistrationTokenHash string
+	// JWK Set verifying signed request objects, empty if the client has none
+	JWKS string
+	// the client may only start authorization with a pushed request
+	RequirePAR bool
+	// public clients can't keep a secret and authenticate with PKCE only
+	Public          bool
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	CreatedAt       time.Time
+}
+
+func (c *Client) HasRedirectURI(uri string) bool {
+	return slices.Contains(c.RedirectURIs, uri)
+}
+
+func (c *Client) HasPostLogoutRedirectURI(uri string) bool {
+	return slices.Contains(c.PostLogoutRedirectURIs, uri)
+}
+
+func (c *Client) CanExchangeInto(audience string) bool {
+	return slices.Contains(c.ExchangeAudiences, audience)
+}
+
+func (c *Client) AllowsGrant(grantType string) bool {
+	return slices.Contains(c.GrantTypes, grantType)
+}
@@ -0,0 +1,40 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type DeviceCode struct {
+	DeviceCodeHash string
+	UserCode       string
+	ClientID       string
+	Scope          string
+	UserID         *uuid.UUID
+	Interval       time.Duration
+	CreatedAt      time.Time
+	ExpiresAt      time.Time
+	LastPolledAt   *time.Time
+	ApprovedAt     *time.Time
+	DeniedAt       *time.Time
+	UsedAt         *time.Time
+	// how the approving user authenticated, set with ApprovedAt
+	Auth Authentication
+}
+
+// DeviceAuthorization is the response of the device authorization
+// endpoint, RFC 8628 section 3.2.
+type DeviceAuthorization struct {
+	DeviceCode string
+	UserCode   string
+	ExpiresAt  time.Time
+	Interval   time.Duration
+}
+
+// DeviceVerification is what the user confirms on the verification page.
+type DeviceVerification struct {
+	UserCode   string
+	ClientName string
+	Scope      string
+}
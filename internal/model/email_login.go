@@ -0,0 +1,19 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EmailLoginChallenge is a login by the link or the code mailed to the
+// user, whichever is used first.
+type EmailLoginChallenge struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	CodeHash  string
+	Attempts  int
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
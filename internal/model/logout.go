@@ -0,0 +1,26 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type LogoutNotification struct {
+	ID            uuid.UUID
+	ClientID      string
+	UserID        uuid.UUID
+	Attempts      int
+	LastError     string
+	CreatedAt     time.Time
+	NextAttemptAt time.Time
+}
+
+// EndSessionRequest is the RP-initiated logout request, OpenID Connect
+// RP-Initiated Logout 1.0 section 2.
+type EndSessionRequest struct {
+	IDTokenHint           string
+	ClientID              string
+	PostLogoutRedirectURI string
+	State                 string
+}
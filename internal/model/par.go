@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+type PushedAuthorizationRequest struct {
+	RequestURIHash string
+	ClientID       string
+	// url-encoded authorization request parameters
+	Params    string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
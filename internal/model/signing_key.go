@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+type SigningKey struct {
+	ID        string
+	Alg       string
+	KeyData   []byte
+	CreatedAt time.Time
+	NotBefore time.Time
+	RetireAt  *time.Time
+}
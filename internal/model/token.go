@@ -0,0 +1,57 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Authentication records when and how the user last proved who they are.
+// It is taken from the login into every token of the session, refreshes
+// keep it.
+type Authentication struct {
+	Time time.Time
+	// methods used, RFC 8176
+	AMR []string
+	ACR string
+}
+
+type RefreshToken struct {
+	ID        uuid.UUID
+	FamilyID  uuid.UUID
+	UserID    uuid.UUID
+	ClientID  *string
+	Scope     string
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+	Auth      Authentication
+}
+
+type TokenPair struct {
+	FamilyID         uuid.UUID
+	AccessToken      string
+	AccessExpiresAt  time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+	Scope            string
+	// only for isso's own sessions, expires with the access token
+	ForwardAuthToken string
+}
+
+// TokenInfo describes a token for introspection, RFC 7662 section 2.2.
+type TokenInfo struct {
+	Active    bool
+	TokenType string
+	Scope     string
+	ClientID  string
+	Username  string
+	Subject   string
+	Audience  []string
+	Issuer    string
+	JTI       string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
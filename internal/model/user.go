@@ -7,4 +7,7 @@ type User struct {
 	Login        string
 	PasswordHash string
 	TokenID      uuid.UUID
+	// nil until the user sets one
+	Email         *string
+	EmailVerified bool
 }
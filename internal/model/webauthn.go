@@ -0,0 +1,35 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type WebAuthnCredential struct {
+	ID     []byte
+	UserID uuid.UUID
+	Name   string
+	// webauthn.Credential as JSON
+	Data       []byte
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+}
+
+// WebAuthnSession keeps the challenge between the begin and finish calls of
+// a registration or login.
+type WebAuthnSession struct {
+	SessionHash string
+	// nil for a passwordless login
+	UserID *uuid.UUID
+	// webauthn.SessionData as JSON
+	Data      []byte
+	ExpiresAt time.Time
+}
+
+// WebAuthnCeremony is handed to the browser, Options go to
+// navigator.credentials and SessionID back to the finish call.
+type WebAuthnCeremony struct {
+	SessionID string
+	Options   any
+}
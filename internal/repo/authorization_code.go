@@ -0,0 +1,129 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/model"
+)
+
+type AuthorizationCodeRepo struct {
+	db *sql.DB
+}
+
+func NewAuthorizationCodeRepo(db *sql.DB) *AuthorizationCodeRepo {
+	return &AuthorizationCodeRepo{
+		db: db,
+	}
+}
+
+func (r *AuthorizationCodeRepo) Create(ctx context.Context, code *model.AuthorizationCode) error {
+	const query = `
+		INSERT INTO authorization_codes (
+			code_hash, client_id, user_id, redirect_uri, scope, nonce,
+			code_challenge, code_challenge_method, created_at, expires_at,
+			auth_time, amr, acr
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, COALESCE($12, '{}'::TEXT[]), $13)
+	`
+
+	_, err := r.db.ExecContext(
+		ctx,
+		query,
+		code.CodeHash,
+		code.ClientID,
+		code.UserID,
+		code.RedirectURI,
+		code.Scope,
+		code.Nonce,
+		code.CodeChallenge,
+		code.CodeChallengeMethod,
+		code.CreatedAt,
+		code.ExpiresAt,
+		code.Auth.Time,
+		code.Auth.AMR,
+		code.Auth.ACR,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return nil
+}
+
+func (r *AuthorizationCodeRepo) GetByHash(ctx context.Context, codeHash string) (*model.AuthorizationCode, error) {
+	const query = `
+		SELECT
+			code_hash, client_id, user_id, redirect_uri, scope, nonce, code_challenge,
+			code_challenge_method, created_at, expires_at, used_at, refresh_family_id,
+			auth_time, amr, acr
+		FROM authorization_codes
+		WHERE code_hash = $1
+	`
+
+	var code model.AuthorizationCode
+	err := r.db.QueryRowContext(ctx, query, codeHash).Scan(
+		&code.CodeHash,
+		&code.ClientID,
+		&code.UserID,
+		&code.RedirectURI,
+		&code.Scope,
+		&code.Nonce,
+		&code.CodeChallenge,
+		&code.CodeChallengeMethod,
+		&code.CreatedAt,
+		&code.ExpiresAt,
+		&code.UsedAt,
+		&code.RefreshFamilyID,
+		&code.Auth.Time,
+		arrayScanner(&code.Auth.AMR),
+		&code.Auth.ACR,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: authorization code not found", apperror.ErrInvalidGrant)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return &code, nil
+}
+
+// MarkUsed returns false if the code was already redeemed.
+func (r *AuthorizationCodeRepo) MarkUsed(ctx context.Context, codeHash string) (bool, error) {
+	const query = `
+		UPDATE authorization_codes
+		SET used_at = now()
+		WHERE code_hash = $1 AND used_at IS NULL
+	`
+
+	res, err := r.db.ExecContext(ctx, query, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+func (r *AuthorizationCodeRepo) SetRefreshFamily(ctx context.Context, codeHash string, familyID uuid.UUID) error {
+	const query = `
+		UPDATE authorization_codes
+		SET refresh_family_id = $1
+		WHERE code_hash = $2
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, familyID, codeHash); err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return nil
+}
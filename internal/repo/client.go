@@ -0,0 +1,217 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/model"
+)
+
+type ClientRepo struct {
+	db *sql.DB
+}
+
+func NewClientRepo(db *sql.DB) *ClientRepo {
+	return &ClientRepo{
+		db: db,
+	}
+}
+
+const clientColumns = `
+	id, name, secret_hash, redirect_uris, grant_types, scopes, exchange_audiences,
+	post_logout_redirect_uris, backchannel_logout_uri, registration_token_hash, jwks,
+	require_pushed_authorization_requests, public, access_token_ttl_seconds,
+	refresh_token_ttl_seconds, created_at
+`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanClient(row rowScanner) (*model.Client, error) {
+	var client model.Client
+	var accessTTL, refreshTTL int
+
+	if err := row.Scan(
+		&client.ID,
+		&client.Name,
+		&client.SecretHash,
+		arrayScanner(&client.RedirectURIs),
+		arrayScanner(&client.GrantTypes),
+		arrayScanner(&client.Scopes),
+		arrayScanner(&client.ExchangeAudiences),
+		arrayScanner(&client.PostLogoutRedirectURIs),
+		&client.BackchannelLogoutURI,
+		&client.RegistrationTokenHash,
+		&client.JWKS,
+		&client.RequirePAR,
+		&client.Public,
+		&accessTTL,
+		&refreshTTL,
+		&client.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	client.AccessTokenTTL = time.Duration(accessTTL) * time.Second
+	client.RefreshTokenTTL = time.Duration(refreshTTL) * time.Second
+
+	return &client, nil
+}
+
+func (r *ClientRepo) GetAll(ctx context.Context) ([]model.Client, error) {
+	query := `SELECT ` + clientColumns + ` FROM oauth_clients ORDER BY created_at`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+	defer rows.Close()
+
+	clients := []model.Client{}
+	for rows.Next() {
+		client, err := scanClient(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+		}
+
+		clients = append(clients, *client)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return clients, nil
+}
+
+func (r *ClientRepo) GetByID(ctx context.Context, ID string) (*model.Client, error) {
+	query := `SELECT ` + clientColumns + ` FROM oauth_clients WHERE id = $1`
+
+	client, err := scanClient(r.db.QueryRowContext(ctx, query, ID))
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: client %s", apperror.ErrClientNotFound, ID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return client, nil
+}
+
+func (r *ClientRepo) Create(ctx context.Context, client *model.Client) error {
+	const query = `
+		INSERT INTO oauth_clients (
+			id, name, secret_hash, redirect_uris, grant_types, scopes, exchange_audiences,
+			post_logout_redirect_uris, backchannel_logout_uri, registration_token_hash, jwks,
+			require_pushed_authorization_requests, public, access_token_ttl_seconds,
+			refresh_token_ttl_seconds, created_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+	`
+
+	_, err := r.db.ExecContext(
+		ctx,
+		query,
+		client.ID,
+		client.Name,
+		client.SecretHash,
+		client.RedirectURIs,
+		client.GrantTypes,
+		client.Scopes,
+		client.ExchangeAudiences,
+		client.PostLogoutRedirectURIs,
+		client.BackchannelLogoutURI,
+		client.RegistrationTokenHash,
+		client.JWKS,
+		client.RequirePAR,
+		client.Public,
+		int(client.AccessTokenTTL.Seconds()),
+		int(client.RefreshTokenTTL.Seconds()),
+		client.CreatedAt,
+	)
+
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			// unique violation
+			if pgErr.Code == "23505" {
+				return fmt.Errorf("%w: client '%s' exists", apperror.ErrClientExists, client.ID)
+			}
+		}
+
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return nil
+}
+
+// Update replaces the client metadata, the id and secret stay the same.
+func (r *ClientRepo) Update(ctx context.Context, client *model.Client) error {
+	const query = `
+		UPDATE oauth_clients
+		SET name = $1, redirect_uris = $2, grant_types = $3, scopes = $4, post_logout_redirect_uris = $5,
+			backchannel_logout_uri = $6, registration_token_hash = $7, jwks = $8,
+			require_pushed_authorization_requests = $9, public = $10
+		WHERE id = $11
+	`
+
+	res, err := r.db.ExecContext(
+		ctx,
+		query,
+		client.Name,
+		client.RedirectURIs,
+		client.GrantTypes,
+		client.Scopes,
+		client.PostLogoutRedirectURIs,
+		client.BackchannelLogoutURI,
+		client.RegistrationTokenHash,
+		client.JWKS,
+		client.RequirePAR,
+		client.Public,
+		client.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: client %s", apperror.ErrClientNotFound, client.ID)
+	}
+
+	return nil
+}
+
+func (r *ClientRepo) Delete(ctx context.Context, ID string) error {
+	const query = `
+		DELETE FROM oauth_clients
+		WHERE id = $1
+	`
+
+	res, err := r.db.ExecContext(ctx, query, ID)
+	if err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: client %s", apperror.ErrClientNotFound, ID)
+	}
+
+	return nil
+}
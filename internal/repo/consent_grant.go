@@ -0,0 +1,131 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/model"
+)
+
+type ConsentGrantRepo struct {
+	db *sql.DB
+}
+
+func NewConsentGrantRepo(db *sql.DB) *ConsentGrantRepo {
+	return &ConsentGrantRepo{
+		db: db,
+	}
+}
+
+const consentGrantColumns = `g.user_id, g.client_id, c.name, g.scopes, g.created_at, g.updated_at`
+
+func scanConsentGrant(row rowScanner) (*model.ConsentGrant, error) {
+	var grant model.ConsentGrant
+
+	if err := row.Scan(
+		&grant.UserID,
+		&grant.ClientID,
+		&grant.ClientName,
+		arrayScanner(&grant.Scopes),
+		&grant.CreatedAt,
+		&grant.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	return &grant, nil
+}
+
+func (r *ConsentGrantRepo) Get(ctx context.Context, userID uuid.UUID, clientID string) (*model.ConsentGrant, error) {
+	query := `
+		SELECT ` + consentGrantColumns + `
+		FROM consent_grants g JOIN oauth_clients c ON c.id = g.client_id
+		WHERE g.user_id = $1 AND g.client_id = $2
+	`
+
+	grant, err := scanConsentGrant(r.db.QueryRowContext(ctx, query, userID, clientID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: client %s", apperror.ErrGrantNotFound, clientID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return grant, nil
+}
+
+func (r *ConsentGrantRepo) GetByUser(ctx context.Context, userID uuid.UUID) ([]model.ConsentGrant, error) {
+	query := `
+		SELECT ` + consentGrantColumns + `
+		FROM consent_grants g JOIN oauth_clients c ON c.id = g.client_id
+		WHERE g.user_id = $1
+		ORDER BY g.updated_at DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+	defer rows.Close()
+
+	grants := []model.ConsentGrant{}
+	for rows.Next() {
+		grant, err := scanConsentGrant(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+		}
+
+		grants = append(grants, *grant)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return grants, nil
+}
+
+// Add merges the scopes into the user's grant for the client.
+func (r *ConsentGrantRepo) Add(ctx context.Context, userID uuid.UUID, clientID string, scopes []string) error {
+	const query = `
+		INSERT INTO consent_grants (user_id, client_id, scopes)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, client_id) DO UPDATE
+		SET scopes = ARRAY(
+				SELECT DISTINCT unnest(consent_grants.scopes || EXCLUDED.scopes) ORDER BY 1
+			),
+			updated_at = now()
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, userID, clientID, scopes); err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return nil
+}
+
+func (r *ConsentGrantRepo) Delete(ctx context.Context, userID uuid.UUID, clientID string) error {
+	const query = `
+		DELETE FROM consent_grants
+		WHERE user_id = $1 AND client_id = $2
+	`
+
+	res, err := r.db.ExecContext(ctx, query, userID, clientID)
+	if err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: client %s", apperror.ErrGrantNotFound, clientID)
+	}
+
+	return nil
+}
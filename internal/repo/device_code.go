@@ -0,0 +1,208 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/model"
+)
+
+const deviceCodeColumns = `
+	device_code_hash, user_code, client_id, scope, user_id, poll_interval, created_at,
+	expires_at, last_polled_at, approved_at, denied_at, used_at, auth_time, amr, acr
+`
+
+type DeviceCodeRepo struct {
+	db *sql.DB
+}
+
+func NewDeviceCodeRepo(db *sql.DB) *DeviceCodeRepo {
+	return &DeviceCodeRepo{
+		db: db,
+	}
+}
+
+func (r *DeviceCodeRepo) Create(ctx context.Context, code *model.DeviceCode) error {
+	const query = `
+		INSERT INTO device_codes (device_code_hash, user_code, client_id, scope, poll_interval, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	_, err := r.db.ExecContext(
+		ctx,
+		query,
+		code.DeviceCodeHash,
+		code.UserCode,
+		code.ClientID,
+		code.Scope,
+		int(code.Interval.Seconds()),
+		code.CreatedAt,
+		code.ExpiresAt,
+	)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return apperror.ErrUserCodeTaken
+		}
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return nil
+}
+
+func (r *DeviceCodeRepo) GetByHash(ctx context.Context, deviceCodeHash string) (*model.DeviceCode, error) {
+	query := `SELECT ` + deviceCodeColumns + ` FROM device_codes WHERE device_code_hash = $1`
+
+	code, err := scanDeviceCode(r.db.QueryRowContext(ctx, query, deviceCodeHash))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: device code not found", apperror.ErrInvalidGrant)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return code, nil
+}
+
+func (r *DeviceCodeRepo) GetByUserCode(ctx context.Context, userCode string) (*model.DeviceCode, error) {
+	query := `SELECT ` + deviceCodeColumns + ` FROM device_codes WHERE user_code = $1`
+
+	code, err := scanDeviceCode(r.db.QueryRowContext(ctx, query, userCode))
+	if err == sql.ErrNoRows {
+		return nil, apperror.ErrInvalidUserCode
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return code, nil
+}
+
+// SetPolled records a token request for the device code, interval is
+// increased when the client polls too often.
+func (r *DeviceCodeRepo) SetPolled(ctx context.Context, deviceCodeHash string, polledAt time.Time, interval time.Duration) error {
+	const query = `
+		UPDATE device_codes
+		SET last_polled_at = $1, poll_interval = $2
+		WHERE device_code_hash = $3
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, polledAt, int(interval.Seconds()), deviceCodeHash); err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return nil
+}
+
+// Decide approves or denies a pending, unexpired code, it returns false if
+// the code was already decided. auth is only stored on approval.
+func (r *DeviceCodeRepo) Decide(
+	ctx context.Context,
+	userCode string,
+	userID uuid.UUID,
+	approve bool,
+	auth model.Authentication,
+) (bool, error) {
+	const query = `
+		UPDATE device_codes
+		SET user_id = $1,
+			approved_at = CASE WHEN $2 THEN now() END,
+			denied_at = CASE WHEN $2 THEN NULL ELSE now() END,
+			auth_time = CASE WHEN $2 THEN $4::TIMESTAMPTZ END,
+			amr = CASE WHEN $2 THEN COALESCE($5, '{}'::TEXT[]) ELSE '{}' END,
+			acr = CASE WHEN $2 THEN $6 ELSE '' END
+		WHERE user_code = $3 AND approved_at IS NULL AND denied_at IS NULL AND expires_at > now()
+	`
+
+	res, err := r.db.ExecContext(ctx, query, userID, approve, userCode, auth.Time, auth.AMR, auth.ACR)
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// MarkUsed returns false if tokens were already issued for the code.
+func (r *DeviceCodeRepo) MarkUsed(ctx context.Context, deviceCodeHash string) (bool, error) {
+	const query = `
+		UPDATE device_codes
+		SET used_at = now()
+		WHERE device_code_hash = $1 AND used_at IS NULL
+	`
+
+	res, err := r.db.ExecContext(ctx, query, deviceCodeHash)
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// DeleteExpired frees user codes of device codes that expired before the
+// given time.
+func (r *DeviceCodeRepo) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	const query = `DELETE FROM device_codes WHERE expires_at < $1`
+
+	res, err := r.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return rowsAffected, nil
+}
+
+func scanDeviceCode(row rowScanner) (*model.DeviceCode, error) {
+	var (
+		code     model.DeviceCode
+		interval int
+		authTime *time.Time
+	)
+	err := row.Scan(
+		&code.DeviceCodeHash,
+		&code.UserCode,
+		&code.ClientID,
+		&code.Scope,
+		&code.UserID,
+		&interval,
+		&code.CreatedAt,
+		&code.ExpiresAt,
+		&code.LastPolledAt,
+		&code.ApprovedAt,
+		&code.DeniedAt,
+		&code.UsedAt,
+		&authTime,
+		arrayScanner(&code.Auth.AMR),
+		&code.Auth.ACR,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	code.Interval = time.Duration(interval) * time.Second
+	if authTime != nil {
+		code.Auth.Time = *authTime
+	}
+
+	return &code, nil
+}
@@ -0,0 +1,169 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/model"
+)
+
+const emailLoginChallengeColumns = `id, user_id, code_hash, attempts, created_at, expires_at, used_at`
+
+type EmailLoginChallengeRepo struct {
+	db *sql.DB
+}
+
+func NewEmailLoginChallengeRepo(db *sql.DB) *EmailLoginChallengeRepo {
+	return &EmailLoginChallengeRepo{
+		db: db,
+	}
+}
+
+// Replace uses up the user's earlier challenges, so only the code mailed
+// last can be guessed at.
+func (r *EmailLoginChallengeRepo) Replace(ctx context.Context, challenge *model.EmailLoginChallenge) error {
+	const retireQuery = `
+		UPDATE email_login_challenges
+		SET used_at = $2
+		WHERE user_id = $1 AND used_at IS NULL
+	`
+	const insertQuery = `
+		INSERT INTO email_login_challenges (id, user_id, code_hash, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, retireQuery, challenge.UserID, challenge.CreatedAt); err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		insertQuery,
+		challenge.ID,
+		challenge.UserID,
+		challenge.CodeHash,
+		challenge.CreatedAt,
+		challenge.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return nil
+}
+
+func (r *EmailLoginChallengeRepo) Get(ctx context.Context, ID uuid.UUID) (*model.EmailLoginChallenge, error) {
+	query := `SELECT ` + emailLoginChallengeColumns + ` FROM email_login_challenges WHERE id = $1`
+
+	challenge, err := scanEmailLoginChallenge(r.db.QueryRowContext(ctx, query, ID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: challenge not found", apperror.ErrInvalidLoginCode)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return challenge, nil
+}
+
+// Latest returns the user's most recent challenge.
+func (r *EmailLoginChallengeRepo) Latest(ctx context.Context, userID uuid.UUID) (*model.EmailLoginChallenge, error) {
+	query := `
+		SELECT ` + emailLoginChallengeColumns + `
+		FROM email_login_challenges
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+
+	challenge, err := scanEmailLoginChallenge(r.db.QueryRowContext(ctx, query, userID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: no challenge", apperror.ErrInvalidLoginCode)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return challenge, nil
+}
+
+// Fail counts a wrong code.
+func (r *EmailLoginChallengeRepo) Fail(ctx context.Context, ID uuid.UUID) error {
+	const query = `UPDATE email_login_challenges SET attempts = attempts + 1 WHERE id = $1`
+
+	if _, err := r.db.ExecContext(ctx, query, ID); err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return nil
+}
+
+// Use returns false if the challenge was already used, expired or had too
+// many wrong codes.
+func (r *EmailLoginChallengeRepo) Use(ctx context.Context, ID uuid.UUID, usedAt time.Time, maxAttempts int) (bool, error) {
+	const query = `
+		UPDATE email_login_challenges
+		SET used_at = $2
+		WHERE id = $1 AND used_at IS NULL AND expires_at > $2 AND attempts < $3
+	`
+
+	res, err := r.db.ExecContext(ctx, query, ID, usedAt, maxAttempts)
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+func (r *EmailLoginChallengeRepo) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	const query = `DELETE FROM email_login_challenges WHERE expires_at < $1`
+
+	res, err := r.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return rowsAffected, nil
+}
+
+func scanEmailLoginChallenge(row rowScanner) (*model.EmailLoginChallenge, error) {
+	var challenge model.EmailLoginChallenge
+	err := row.Scan(
+		&challenge.ID,
+		&challenge.UserID,
+		&challenge.CodeHash,
+		&challenge.Attempts,
+		&challenge.CreatedAt,
+		&challenge.ExpiresAt,
+		&challenge.UsedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &challenge, nil
+}
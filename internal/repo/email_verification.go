@@ -0,0 +1,103 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/model"
+)
+
+type EmailVerificationRepo struct {
+	db *sql.DB
+}
+
+func NewEmailVerificationRepo(db *sql.DB) *EmailVerificationRepo {
+	return &EmailVerificationRepo{
+		db: db,
+	}
+}
+
+// Replace drops the user's pending verifications, so only the link mailed
+// last works.
+func (r *EmailVerificationRepo) Replace(ctx context.Context, verification *model.EmailVerification) error {
+	const deleteQuery = `DELETE FROM email_verifications WHERE user_id = $1`
+	const insertQuery = `
+		INSERT INTO email_verifications (token_hash, user_id, email, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, deleteQuery, verification.UserID); err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		insertQuery,
+		verification.TokenHash,
+		verification.UserID,
+		verification.Email,
+		verification.CreatedAt,
+		verification.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return nil
+}
+
+// Take deletes the verification and returns it, so every link is used once.
+func (r *EmailVerificationRepo) Take(ctx context.Context, tokenHash string) (*model.EmailVerification, error) {
+	const query = `
+		DELETE FROM email_verifications
+		WHERE token_hash = $1
+		RETURNING token_hash, user_id, email, created_at, expires_at
+	`
+
+	var verification model.EmailVerification
+	err := r.db.QueryRowContext(ctx, query, tokenHash).Scan(
+		&verification.TokenHash,
+		&verification.UserID,
+		&verification.Email,
+		&verification.CreatedAt,
+		&verification.ExpiresAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: verification not found", apperror.ErrInvalidVerificationToken)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return &verification, nil
+}
+
+func (r *EmailVerificationRepo) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	const query = `DELETE FROM email_verifications WHERE expires_at < $1`
+
+	res, err := r.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return rowsAffected, nil
+}
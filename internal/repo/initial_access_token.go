@@ -0,0 +1,51 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/kkonst40/isso/internal/apperror"
+)
+
+type InitialAccessTokenRepo struct {
+	db *sql.DB
+}
+
+func NewInitialAccessTokenRepo(db *sql.DB) *InitialAccessTokenRepo {
+	return &InitialAccessTokenRepo{
+		db: db,
+	}
+}
+
+func (r *InitialAccessTokenRepo) Create(ctx context.Context, tokenHash string, expiresAt time.Time) error {
+	const query = `
+		INSERT INTO initial_access_tokens (token_hash, expires_at)
+		VALUES ($1, $2)
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, tokenHash, expiresAt); err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return nil
+}
+
+// Valid reports whether the token exists and has not expired, tokens can
+// register any number of clients until then.
+func (r *InitialAccessTokenRepo) Valid(ctx context.Context, tokenHash string) (bool, error) {
+	const query = `
+		SELECT EXISTS (
+			SELECT 1 FROM initial_access_tokens
+			WHERE token_hash = $1 AND expires_at > now()
+		)
+	`
+
+	var valid bool
+	if err := r.db.QueryRowContext(ctx, query, tokenHash).Scan(&valid); err != nil {
+		return false, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return valid, nil
+}
@@ -0,0 +1,119 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/model"
+)
+
+type LogoutNotificationRepo struct {
+	db *sql.DB
+}
+
+func NewLogoutNotificationRepo(db *sql.DB) *LogoutNotificationRepo {
+	return &LogoutNotificationRepo{
+		db: db,
+	}
+}
+
+// EnqueueForUser queues a notification for every client with a live
+// refresh token of the user and a back-channel logout URI. It must run
+// before the tokens are revoked.
+func (r *LogoutNotificationRepo) EnqueueForUser(ctx context.Context, userID uuid.UUID) error {
+	const query = `
+		INSERT INTO logout_notifications (id, client_id, user_id)
+		SELECT gen_random_uuid(), c.id, $1
+		FROM oauth_clients c
+		WHERE c.backchannel_logout_uri <> '' AND EXISTS (
+			SELECT 1 FROM refresh_tokens rt
+			WHERE rt.client_id = c.id AND rt.user_id = $1
+				AND rt.revoked_at IS NULL AND rt.expires_at > now()
+		)
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, userID); err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return nil
+}
+
+// ClaimDue returns up to limit notifications due for delivery and pushes
+// their next attempt back by lease, so a crashed delivery is retried
+// and concurrent workers don't pick the same rows.
+func (r *LogoutNotificationRepo) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]model.LogoutNotification, error) {
+	const query = `
+		UPDATE logout_notifications
+		SET next_attempt_at = now() + make_interval(secs => $2)
+		WHERE id IN (
+			SELECT id FROM logout_notifications
+			WHERE next_attempt_at <= now()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, client_id, user_id, attempts, last_error, created_at, next_attempt_at
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+	defer rows.Close()
+
+	notifications := []model.LogoutNotification{}
+	for rows.Next() {
+		var n model.LogoutNotification
+		if err := rows.Scan(
+			&n.ID,
+			&n.ClientID,
+			&n.UserID,
+			&n.Attempts,
+			&n.LastError,
+			&n.CreatedAt,
+			&n.NextAttemptAt,
+		); err != nil {
+			return nil, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+		}
+
+		notifications = append(notifications, n)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return notifications, nil
+}
+
+func (r *LogoutNotificationRepo) Retry(ctx context.Context, ID uuid.UUID, nextAttemptAt time.Time, lastError string) error {
+	const query = `
+		UPDATE logout_notifications
+		SET attempts = attempts + 1, next_attempt_at = $1, last_error = $2
+		WHERE id = $3
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, nextAttemptAt, lastError, ID); err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return nil
+}
+
+func (r *LogoutNotificationRepo) Delete(ctx context.Context, ID uuid.UUID) error {
+	const query = `
+		DELETE FROM logout_notifications
+		WHERE id = $1
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, ID); err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+)
+
+type MFALockoutRepo struct {
+	db *sql.DB
+}
+
+func NewMFALockoutRepo(db *sql.DB) *MFALockoutRepo {
+	return &MFALockoutRepo{
+		db: db,
+	}
+}
+
+// LockedUntil returns nil when the user's second factor isn't locked.
+func (r *MFALockoutRepo) LockedUntil(ctx context.Context, userID uuid.UUID) (*time.Time, error) {
+	const query = `SELECT locked_until FROM mfa_lockouts WHERE user_id = $1`
+
+	var lockedUntil *time.Time
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&lockedUntil)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return lockedUntil, nil
+}
+
+// Fail counts a wrong code and locks the second factor once maxAttempts
+// codes were wrong, the count starts over after that.
+func (r *MFALockoutRepo) Fail(ctx context.Context, userID uuid.UUID, maxAttempts int, lockUntil time.Time) error {
+	const query = `
+		INSERT INTO mfa_lockouts AS l (user_id, failed_attempts)
+		VALUES ($1, 1)
+		ON CONFLICT (user_id) DO UPDATE
+		SET failed_attempts = CASE WHEN l.failed_attempts + 1 >= $2 THEN 0 ELSE l.failed_attempts + 1 END,
+			locked_until = CASE WHEN l.failed_attempts + 1 >= $2 THEN $3 ELSE l.locked_until END
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, userID, maxAttempts, lockUntil); err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return nil
+}
+
+// Reset forgets the wrong codes after a correct one.
+func (r *MFALockoutRepo) Reset(ctx context.Context, userID uuid.UUID) error {
+	const query = `DELETE FROM mfa_lockouts WHERE user_id = $1`
+
+	if _, err := r.db.ExecContext(ctx, query, userID); err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/model"
+)
+
+const passwordResetColumns = `token_hash, user_id, created_at, expires_at`
+
+type PasswordResetRepo struct {
+	db *sql.DB
+}
+
+func NewPasswordResetRepo(db *sql.DB) *PasswordResetRepo {
+	return &PasswordResetRepo{
+		db: db,
+	}
+}
+
+// Replace drops the user's pending resets, so only the link mailed last
+// works.
+func (r *PasswordResetRepo) Replace(ctx context.Context, reset *model.PasswordReset) error {
+	const deleteQuery = `DELETE FROM password_resets WHERE user_id = $1`
+	const insertQuery = `
+		INSERT INTO password_resets (token_hash, user_id, created_at, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, deleteQuery, reset.UserID); err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		insertQuery,
+		reset.TokenHash,
+		reset.UserID,
+		reset.CreatedAt,
+		reset.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return nil
+}
+
+// Latest returns the user's pending reset.
+func (r *PasswordResetRepo) Latest(ctx context.Context, userID uuid.UUID) (*model.PasswordReset, error) {
+	query := `
+		SELECT ` + passwordResetColumns + `
+		FROM password_resets
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+
+	reset, err := scanPasswordReset(r.db.QueryRowContext(ctx, query, userID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: no reset", apperror.ErrInvalidResetToken)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return reset, nil
+}
+
+// Take deletes the reset and returns it, so every link is used once.
+func (r *PasswordResetRepo) Take(ctx context.Context, tokenHash string) (*model.PasswordReset, error) {
+	query := `DELETE FROM password_resets WHERE token_hash = $1 RETURNING ` + passwordResetColumns
+
+	reset, err := scanPasswordReset(r.db.QueryRowContext(ctx, query, tokenHash))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: reset not found", apperror.ErrInvalidResetToken)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return reset, nil
+}
+
+func (r *PasswordResetRepo) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	const query = `DELETE FROM password_resets WHERE expires_at < $1`
+
+	res, err := r.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return rowsAffected, nil
+}
+
+func scanPasswordReset(row rowScanner) (*model.PasswordReset, error) {
+	var reset model.PasswordReset
+	err := row.Scan(
+		&reset.TokenHash,
+		&reset.UserID,
+		&reset.CreatedAt,
+		&reset.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &reset, nil
+}
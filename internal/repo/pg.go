@@ -0,0 +1,13 @@
+package repo
+
+import (
+	"database/sql"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// arrayScanner scans postgres arrays through database/sql. pgtype.Map is not
+// safe for concurrent use, so every scan gets its own.
+func arrayScanner(v any) sql.Scanner {
+	return pgtype.NewMap().SQLScanner(v)
+}
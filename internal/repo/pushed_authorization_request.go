@@ -0,0 +1,103 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/model"
+)
+
+type PushedAuthorizationRequestRepo struct {
+	db *sql.DB
+}
+
+func NewPushedAuthorizationRequestRepo(db *sql.DB) *PushedAuthorizationRequestRepo {
+	return &PushedAuthorizationRequestRepo{
+		db: db,
+	}
+}
+
+func (r *PushedAuthorizationRequestRepo) Create(ctx context.Context, req *model.PushedAuthorizationRequest) error {
+	const query = `
+		INSERT INTO pushed_authorization_requests (request_uri_hash, client_id, params, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	_, err := r.db.ExecContext(
+		ctx,
+		query,
+		req.RequestURIHash,
+		req.ClientID,
+		req.Params,
+		req.CreatedAt,
+		req.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return nil
+}
+
+func (r *PushedAuthorizationRequestRepo) GetByHash(ctx context.Context, requestURIHash string) (*model.PushedAuthorizationRequest, error) {
+	const query = `
+		SELECT request_uri_hash, client_id, params, created_at, expires_at
+		FROM pushed_authorization_requests
+		WHERE request_uri_hash = $1
+	`
+
+	var req model.PushedAuthorizationRequest
+	err := r.db.QueryRowContext(ctx, query, requestURIHash).Scan(
+		&req.RequestURIHash,
+		&req.ClientID,
+		&req.Params,
+		&req.CreatedAt,
+		&req.ExpiresAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: request_uri not found", apperror.ErrInvalidRequestURI)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return &req, nil
+}
+
+// Delete reports whether the request was still there, so only one
+// authorization can consume it.
+func (r *PushedAuthorizationRequestRepo) Delete(ctx context.Context, requestURIHash string) (bool, error) {
+	const query = `DELETE FROM pushed_authorization_requests WHERE request_uri_hash = $1`
+
+	res, err := r.db.ExecContext(ctx, query, requestURIHash)
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+func (r *PushedAuthorizationRequestRepo) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	const query = `DELETE FROM pushed_authorization_requests WHERE expires_at < $1`
+
+	res, err := r.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return rowsAffected, nil
+}
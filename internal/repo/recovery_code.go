@@ -0,0 +1,103 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/model"
+)
+
+type RecoveryCodeRepo struct {
+	db *sql.DB
+}
+
+func NewRecoveryCodeRepo(db *sql.DB) *RecoveryCodeRepo {
+	return &RecoveryCodeRepo{
+		db: db,
+	}
+}
+
+func (r *RecoveryCodeRepo) CountUnused(ctx context.Context, userID uuid.UUID) (int, error) {
+	const query = `SELECT count(*) FROM mfa_recovery_codes WHERE user_id = $1 AND used_at IS NULL`
+
+	var count int
+	if err := r.db.QueryRowContext(ctx, query, userID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return count, nil
+}
+
+// Replace drops the user's codes, used or not, and stores the new set.
+func (r *RecoveryCodeRepo) Replace(ctx context.Context, userID uuid.UUID, codes []model.RecoveryCode) error {
+	const deleteQuery = `DELETE FROM mfa_recovery_codes WHERE user_id = $1`
+	const insertQuery = `
+		INSERT INTO mfa_recovery_codes (id, user_id, code_hash, created_at)
+		VALUES ($1, $2, $3, $4)
+	`
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, deleteQuery, userID); err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	for _, code := range codes {
+		if _, err := tx.ExecContext(
+			ctx,
+			insertQuery,
+			code.ID,
+			userID,
+			code.CodeHash,
+			code.CreatedAt,
+		); err != nil {
+			return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return nil
+}
+
+// Use marks the user's unused code with the given hash as used, it
+// returns false when there is no such code.
+func (r *RecoveryCodeRepo) Use(ctx context.Context, userID uuid.UUID, codeHash string, usedAt time.Time) (bool, error) {
+	const query = `
+		UPDATE mfa_recovery_codes
+		SET used_at = $3
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`
+
+	res, err := r.db.ExecContext(ctx, query, userID, codeHash, usedAt)
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+func (r *RecoveryCodeRepo) DeleteByUser(ctx context.Context, userID uuid.UUID) error {
+	const query = `DELETE FROM mfa_recovery_codes WHERE user_id = $1`
+
+	if _, err := r.db.ExecContext(ctx, query, userID); err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return nil
+}
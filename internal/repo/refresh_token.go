@@ -0,0 +1,168 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/model"
+)
+
+type RefreshTokenRepo struct {
+	db *sql.DB
+}
+
+func NewRefreshTokenRepo(db *sql.DB) *RefreshTokenRepo {
+	return &RefreshTokenRepo{
+		db: db,
+	}
+}
+
+func (r *RefreshTokenRepo) Create(ctx context.Context, token *model.RefreshToken) error {
+	const query = `
+		INSERT INTO refresh_tokens (
+			id, family_id, user_id, client_id, scope, token_hash, created_at, expires_at,
+			auth_time, amr, acr
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, COALESCE($10, '{}'::TEXT[]), $11)
+	`
+
+	_, err := r.db.ExecContext(
+		ctx,
+		query,
+		token.ID,
+		token.FamilyID,
+		token.UserID,
+		token.ClientID,
+		token.Scope,
+		token.TokenHash,
+		token.CreatedAt,
+		token.ExpiresAt,
+		token.Auth.Time,
+		token.Auth.AMR,
+		token.Auth.ACR,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return nil
+}
+
+func (r *RefreshTokenRepo) GetByHash(ctx context.Context, tokenHash string) (*model.RefreshToken, error) {
+	const query = `
+		SELECT
+			id, family_id, user_id, client_id, scope, token_hash, created_at, expires_at, used_at,
+			revoked_at, auth_time, amr, acr
+		FROM refresh_tokens
+		WHERE token_hash = $1
+	`
+
+	var token model.RefreshToken
+	err := r.db.QueryRowContext(ctx, query, tokenHash).Scan(
+		&token.ID,
+		&token.FamilyID,
+		&token.UserID,
+		&token.ClientID,
+		&token.Scope,
+		&token.TokenHash,
+		&token.CreatedAt,
+		&token.ExpiresAt,
+		&token.UsedAt,
+		&token.RevokedAt,
+		&token.Auth.Time,
+		arrayScanner(&token.Auth.AMR),
+		&token.Auth.ACR,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: refresh token not found", apperror.ErrInvalidToken)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return &token, nil
+}
+
+// MarkUsed returns false if the token was already used, so two concurrent
+// refreshes with the same token can't both succeed.
+func (r *RefreshTokenRepo) MarkUsed(ctx context.Context, ID uuid.UUID) (bool, error) {
+	const query = `
+		UPDATE refresh_tokens
+		SET used_at = now()
+		WHERE id = $1 AND used_at IS NULL
+	`
+
+	res, err := r.db.ExecContext(ctx, query, ID)
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+func (r *RefreshTokenRepo) RevokeFamily(ctx context.Context, familyID uuid.UUID) error {
+	const query = `
+		UPDATE refresh_tokens
+		SET revoked_at = now()
+		WHERE family_id = $1 AND revoked_at IS NULL
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, familyID); err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return nil
+}
+
+func (r *RefreshTokenRepo) RevokeByUser(ctx context.Context, userID uuid.UUID) error {
+	const query = `
+		UPDATE refresh_tokens
+		SET revoked_at = now()
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, userID); err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return nil
+}
+
+func (r *RefreshTokenRepo) FamilyRevoked(ctx context.Context, familyID uuid.UUID) (bool, error) {
+	const query = `
+		SELECT EXISTS (
+			SELECT 1 FROM refresh_tokens
+			WHERE family_id = $1 AND revoked_at IS NOT NULL
+		)
+	`
+
+	var revoked bool
+	if err := r.db.QueryRowContext(ctx, query, familyID).Scan(&revoked); err != nil {
+		return false, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return revoked, nil
+}
+
+func (r *RefreshTokenRepo) RevokeByUserAndClient(ctx context.Context, userID uuid.UUID, clientID string) error {
+	const query = `
+		UPDATE refresh_tokens
+		SET revoked_at = now()
+		WHERE user_id = $1 AND client_id = $2 AND revoked_at IS NULL
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, userID, clientID); err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/model"
+)
+
+type SigningKeyRepo struct {
+	db *sql.DB
+}
+
+func NewSigningKeyRepo(db *sql.DB) *SigningKeyRepo {
+	return &SigningKeyRepo{
+		db: db,
+	}
+}
+
+func (r *SigningKeyRepo) GetAll(ctx context.Context) ([]model.SigningKey, error) {
+	const query = `
+		SELECT kid, alg, key_data, created_at, not_before, retire_at
+		FROM signing_keys
+		ORDER BY not_before
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+	defer rows.Close()
+
+	keys := []model.SigningKey{}
+	for rows.Next() {
+		var key model.SigningKey
+		if err := rows.Scan(
+			&key.ID,
+			&key.Alg,
+			&key.KeyData,
+			&key.CreatedAt,
+			&key.NotBefore,
+			&key.RetireAt,
+		); err != nil {
+			return nil, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+		}
+
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return keys, nil
+}
+
+// Rotate inserts the new key and schedules every key without an earlier
+// retirement to retire at retireAt.
+func (r *SigningKeyRepo) Rotate(ctx context.Context, key *model.SigningKey, retireAt time.Time) error {
+	const retireQuery = `
+		UPDATE signing_keys
+		SET retire_at = $1
+		WHERE retire_at IS NULL OR retire_at > $1
+	`
+	const insertQuery = `
+		INSERT INTO signing_keys (kid, alg, key_data, created_at, not_before, retire_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, retireQuery, retireAt); err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	if _, err := tx.ExecContext(
+		ctx,
+		insertQuery,
+		key.ID,
+		key.Alg,
+		key.KeyData,
+		key.CreatedAt,
+		key.NotBefore,
+		key.RetireAt,
+	); err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return nil
+}
+
+func (r *SigningKeyRepo) DeleteRetired(ctx context.Context, before time.Time) (int64, error) {
+	const query = `
+		DELETE FROM signing_keys
+		WHERE retire_at IS NOT NULL AND retire_at <= $1
+	`
+
+	res, err := r.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return rowsAffected, nil
+}
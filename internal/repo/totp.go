@@ -0,0 +1,114 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/model"
+)
+
+type TOTPRepo struct {
+	db *sql.DB
+}
+
+func NewTOTPRepo(db *sql.DB) *TOTPRepo {
+	return &TOTPRepo{
+		db: db,
+	}
+}
+
+func (r *TOTPRepo) Get(ctx context.Context, userID uuid.UUID) (*model.TOTP, error) {
+	const query = `
+		SELECT user_id, secret_encrypted, confirmed_at, last_used_step, created_at
+		FROM user_totp
+		WHERE user_id = $1
+	`
+
+	var totp model.TOTP
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(
+		&totp.UserID,
+		&totp.SecretEncrypted,
+		&totp.ConfirmedAt,
+		&totp.LastUsedStep,
+		&totp.CreatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: user %s", apperror.ErrTOTPNotFound, userID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return &totp, nil
+}
+
+// SetPending starts a new enrollment, a confirmed secret is never replaced.
+// It reports whether the secret was stored.
+func (r *TOTPRepo) SetPending(ctx context.Context, userID uuid.UUID, secretEncrypted string) (bool, error) {
+	const query = `
+		INSERT INTO user_totp (user_id, secret_encrypted)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret_encrypted = EXCLUDED.secret_encrypted, last_used_step = 0, created_at = now()
+		WHERE user_totp.confirmed_at IS NULL
+	`
+
+	res, err := r.db.ExecContext(ctx, query, userID, secretEncrypted)
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// UseStep records a successful code. It reports false when the step, or a
+// later one, was used already, so every code works once.
+func (r *TOTPRepo) UseStep(ctx context.Context, userID uuid.UUID, step int64, confirm bool) (bool, error) {
+	const query = `
+		UPDATE user_totp
+		SET last_used_step = $2,
+			confirmed_at = CASE WHEN $3 THEN COALESCE(confirmed_at, now()) ELSE confirmed_at END
+		WHERE user_id = $1 AND last_used_step < $2
+	`
+
+	res, err := r.db.ExecContext(ctx, query, userID, step, confirm)
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+func (r *TOTPRepo) Delete(ctx context.Context, userID uuid.UUID) error {
+	const query = `DELETE FROM user_totp WHERE user_id = $1`
+
+	res, err := r.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: user %s", apperror.ErrTOTPNotFound, userID)
+	}
+
+	return nil
+}
@@ -12,6 +12,8 @@ import (
 	"github.com/kkonst40/isso/internal/model"
 )
 
+const userColumns = `id, login, password_hash, token_id, email, email_verified`
+
 type UserRepo struct {
 	db *sql.DB
 }
@@ -23,10 +25,7 @@ func New(db *sql.DB) *UserRepo {
 }
 
 func (r *UserRepo) GetAll(ctx context.Context) ([]model.User, error) {
-	const query = `
-		SELECT *
-		FROM users
-	`
+	query := `SELECT ` + userColumns + ` FROM users`
 
 	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
@@ -36,17 +35,12 @@ func (r *UserRepo) GetAll(ctx context.Context) ([]model.User, error) {
 
 	users := []model.User{}
 	for rows.Next() {
-		var user model.User
-		if err := rows.Scan(
-			&user.ID,
-			&user.Login,
-			&user.PasswordHash,
-			&user.TokenID,
-		); err != nil {
+		user, err := scanUser(rows)
+		if err != nil {
 			return nil, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
 		}
 
-		users = append(users, user)
+		users = append(users, *user)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -57,18 +51,9 @@ func (r *UserRepo) GetAll(ctx context.Context) ([]model.User, error) {
 }
 
 func (r *UserRepo) GetByID(ctx context.Context, ID uuid.UUID) (*model.User, error) {
-	const query = `
-		SELECT *
-		FROM users
-		WHERE id = $1
-	`
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
 
-	var user model.User
-	err := r.db.QueryRowContext(ctx, query, ID).Scan(
-		&user.ID,
-		&user.Login,
-		&user.PasswordHash,
-	)
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, ID))
 
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("%w: ID %s", apperror.ErrUserNotFound, ID)
@@ -77,23 +62,33 @@ func (r *UserRepo) GetByID(ctx context.Context, ID uuid.UUID) (*model.User, erro
 		return nil, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
 	}
 
-	return &user, nil
+	return user, nil
 }
 
-func (r *UserRepo) GetByLogin(ctx context.Context, login string) (*model.User, error) {
+func (r *UserRepo) GetTokenID(ctx context.Context, ID uuid.UUID) (uuid.UUID, error) {
 	const query = `
-		SELECT id, login, password_hash, token_id
+		SELECT token_id
 		FROM users
-		WHERE login = $1
+		WHERE id = $1
 	`
 
-	var user model.User
-	err := r.db.QueryRowContext(ctx, query, login).Scan(
-		&user.ID,
-		&user.Login,
-		&user.PasswordHash,
-		&user.TokenID,
-	)
+	var tokenID uuid.UUID
+	err := r.db.QueryRowContext(ctx, query, ID).Scan(&tokenID)
+
+	if err == sql.ErrNoRows {
+		return uuid.UUID{}, fmt.Errorf("%w: ID %s", apperror.ErrUserNotFound, ID)
+	}
+	if err != nil {
+		return uuid.UUID{}, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return tokenID, nil
+}
+
+func (r *UserRepo) GetByLogin(ctx context.Context, login string) (*model.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE login = $1`
+
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, login))
 
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("%w: login %s", apperror.ErrUserNotFound, login)
@@ -102,7 +97,7 @@ func (r *UserRepo) GetByLogin(ctx context.Context, login string) (*model.User, e
 		return nil, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
 	}
 
-	return &user, nil
+	return user, nil
 }
 
 func (r *UserRepo) Create(ctx context.Context, user *model.User) error {
@@ -136,35 +131,100 @@ func (r *UserRepo) Create(ctx context.Context, user *model.User) error {
 	return nil
 }
 
-func (r *UserRepo) Update(ctx context.Context, user *model.User) error {
-	const query = `
-		UPDATE users
-		SET 
-			login = $1,
-			password_hash = $2,
-			token_id = $3
-		WHERE id = $4
-	`
+func (r *UserRepo) UpdateLogin(ctx context.Context, ID uuid.UUID, login string) error {
+	const query = `UPDATE users SET login = $1 WHERE id = $2`
 
-	res, err := r.db.ExecContext(ctx, query, user.Login, user.Login, user.TokenID, user.ID)
+	res, err := r.db.ExecContext(ctx, query, login, ID)
 	if err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) {
 			// unique violation
 			if pgErr.Code == "23505" {
-				return fmt.Errorf("%w: login '%s' taken", apperror.ErrLoginTaken, user.Login)
+				return fmt.Errorf("%w: login '%s' taken", apperror.ErrLoginTaken, login)
 			}
 		}
 		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
 	}
 
+	return userUpdated(res, ID)
+}
+
+// UpdatePassword sets a new password together with a new TokenID, so
+// tokens issued with the old password stop working.
+func (r *UserRepo) UpdatePassword(ctx context.Context, ID uuid.UUID, pwdHash string, tokenID uuid.UUID) error {
+	const query = `UPDATE users SET password_hash = $1, token_id = $2 WHERE id = $3`
+
+	res, err := r.db.ExecContext(ctx, query, pwdHash, tokenID, ID)
+	if err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return userUpdated(res, ID)
+}
+
+// RotateTokenID revokes every access token of the user. Only token_id is
+// written, a concurrent update of other columns can't bring the old one
+// back.
+func (r *UserRepo) RotateTokenID(ctx context.Context, ID, tokenID uuid.UUID) error {
+	const query = `UPDATE users SET token_id = $1 WHERE id = $2`
+
+	res, err := r.db.ExecContext(ctx, query, tokenID, ID)
+	if err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return userUpdated(res, ID)
+}
+
+func userUpdated(res sql.Result, ID uuid.UUID) error {
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: ID %s", apperror.ErrUserNotFound, ID)
+	}
+
+	return nil
+}
+
+// UpdatePasswordHash replaces the hash of an unchanged password, it keeps
+// TokenID and does nothing if the password was changed meanwhile.
+func (r *UserRepo) UpdatePasswordHash(ctx context.Context, ID uuid.UUID, oldHash, newHash string) error {
+	const query = `UPDATE users SET password_hash = $3 WHERE id = $1 AND password_hash = $2`
+
+	if _, err := r.db.ExecContext(ctx, query, ID, oldHash, newHash); err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return nil
+}
+
+// SetEmail stores an address the user confirmed.
+func (r *UserRepo) SetEmail(ctx context.Context, ID uuid.UUID, email string) error {
+	const query = `
+		UPDATE users
+		SET email = $1, email_verified = true
+		WHERE id = $2
+	`
+
+	res, err := r.db.ExecContext(ctx, query, email, ID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return fmt.Errorf("%w: %s", apperror.ErrEmailTaken, email)
+		}
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
 	rowsAffected, err := res.RowsAffected()
 	if err != nil {
 		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("%w: ID %s", apperror.ErrUserNotFound, user.ID)
+		return fmt.Errorf("%w: ID %s", apperror.ErrUserNotFound, ID)
 	}
 
 	return nil
@@ -212,3 +272,20 @@ func (r *UserRepo) Exist(ctx context.Context, IDs []uuid.UUID) ([]uuid.UUID, err
 
 	return existIDs, nil
 }
+
+func scanUser(row rowScanner) (*model.User, error) {
+	var user model.User
+	err := row.Scan(
+		&user.ID,
+		&user.Login,
+		&user.PasswordHash,
+		&user.TokenID,
+		&user.Email,
+		&user.EmailVerified,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,134 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/model"
+)
+
+type WebAuthnCredentialRepo struct {
+	db *sql.DB
+}
+
+func NewWebAuthnCredentialRepo(db *sql.DB) *WebAuthnCredentialRepo {
+	return &WebAuthnCredentialRepo{
+		db: db,
+	}
+}
+
+func (r *WebAuthnCredentialRepo) GetByUser(ctx context.Context, userID uuid.UUID) ([]model.WebAuthnCredential, error) {
+	const query = `
+		SELECT id, user_id, name, data, created_at, last_used_at
+		FROM webauthn_credentials
+		WHERE user_id = $1
+		ORDER BY created_at
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+	defer rows.Close()
+
+	creds := []model.WebAuthnCredential{}
+	for rows.Next() {
+		var cred model.WebAuthnCredential
+		if err := rows.Scan(
+			&cred.ID,
+			&cred.UserID,
+			&cred.Name,
+			&cred.Data,
+			&cred.CreatedAt,
+			&cred.LastUsedAt,
+		); err != nil {
+			return nil, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+		}
+
+		creds = append(creds, cred)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return creds, nil
+}
+
+func (r *WebAuthnCredentialRepo) Exists(ctx context.Context, userID uuid.UUID) (bool, error) {
+	const query = `SELECT EXISTS (SELECT 1 FROM webauthn_credentials WHERE user_id = $1)`
+
+	var exists bool
+	if err := r.db.QueryRowContext(ctx, query, userID).Scan(&exists); err != nil {
+		return false, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return exists, nil
+}
+
+func (r *WebAuthnCredentialRepo) Create(ctx context.Context, cred *model.WebAuthnCredential) error {
+	const query = `
+		INSERT INTO webauthn_credentials (id, user_id, name, data, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	_, err := r.db.ExecContext(
+		ctx,
+		query,
+		cred.ID,
+		cred.UserID,
+		cred.Name,
+		cred.Data,
+		cred.CreatedAt,
+	)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return fmt.Errorf("%w: credential is registered already", apperror.ErrPasskeyExists)
+		}
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return nil
+}
+
+// Use stores the credential state after a login, the sign counter mostly.
+func (r *WebAuthnCredentialRepo) Use(ctx context.Context, ID []byte, data []byte, usedAt time.Time) error {
+	const query = `
+		UPDATE webauthn_credentials
+		SET data = $2, last_used_at = $3
+		WHERE id = $1
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, ID, data, usedAt); err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return nil
+}
+
+func (r *WebAuthnCredentialRepo) Delete(ctx context.Context, userID uuid.UUID, ID []byte) error {
+	const query = `DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2`
+
+	res, err := r.db.ExecContext(ctx, query, ID, userID)
+	if err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: user %s", apperror.ErrPasskeyNotFound, userID)
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/model"
+)
+
+type WebAuthnSessionRepo struct {
+	db *sql.DB
+}
+
+func NewWebAuthnSessionRepo(db *sql.DB) *WebAuthnSessionRepo {
+	return &WebAuthnSessionRepo{
+		db: db,
+	}
+}
+
+func (r *WebAuthnSessionRepo) Create(ctx context.Context, session *model.WebAuthnSession) error {
+	const query = `
+		INSERT INTO webauthn_sessions (session_hash, user_id, data, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`
+
+	_, err := r.db.ExecContext(
+		ctx,
+		query,
+		session.SessionHash,
+		session.UserID,
+		session.Data,
+		session.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return nil
+}
+
+// Take deletes the session and returns it, so every challenge is answered
+// once.
+func (r *WebAuthnSessionRepo) Take(ctx context.Context, sessionHash string) (*model.WebAuthnSession, error) {
+	const query = `
+		DELETE FROM webauthn_sessions
+		WHERE session_hash = $1
+		RETURNING session_hash, user_id, data, expires_at
+	`
+
+	var session model.WebAuthnSession
+	err := r.db.QueryRowContext(ctx, query, sessionHash).Scan(
+		&session.SessionHash,
+		&session.UserID,
+		&session.Data,
+		&session.ExpiresAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: session not found", apperror.ErrInvalidPasskey)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return &session, nil
+}
+
+func (r *WebAuthnSessionRepo) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	const query = `DELETE FROM webauthn_sessions WHERE expires_at < $1`
+
+	res, err := r.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", apperror.ErrInternalDB, err)
+	}
+
+	return rowsAffected, nil
+}
@@ -0,0 +1,9 @@
+package service
+
+import "github.com/google/uuid"
+
+// isAdmin reports whether the requester is the configured special user,
+// an unset admin ID never matches.
+func isAdmin(adminID, requesterID uuid.UUID) bool {
+	return adminID != uuid.Nil && requesterID == adminID
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/model"
+	"github.com/kkonst40/isso/internal/repo"
+	"github.com/kkonst40/isso/internal/utils"
+)
+
+type ClientService struct {
+	pwdHandler *utils.PasswordHandler
+	clientRepo *repo.ClientRepo
+	adminID    uuid.UUID
+}
+
+func NewClientService(
+	pwdHandler *utils.PasswordHandler,
+	clientRepo *repo.ClientRepo,
+	adminID uuid.UUID,
+) *ClientService {
+	return &ClientService{
+		pwdHandler: pwdHandler,
+		clientRepo: clientRepo,
+		adminID:    adminID,
+	}
+}
+
+func (s *ClientService) All(ctx context.Context, requesterID uuid.UUID) ([]model.Client, error) {
+	if !isAdmin(s.adminID, requesterID) {
+		return nil, apperror.ErrNoPermission
+	}
+
+	return s.clientRepo.GetAll(ctx)
+}
+
+// Create registers a client and returns its secret, which is only stored
+// hashed. Public clients get no secret.
+func (s *ClientService) Create(ctx context.Context, requesterID uuid.UUID, client *model.Client) (string, error) {
+	if !isAdmin(s.adminID, requesterID) {
+		return "", apperror.ErrNoPermission
+	}
+
+	return s.create(ctx, client)
+}
+
+func (s *ClientService) Delete(ctx context.Context, requesterID uuid.UUID, ID string) error {
+	if !isAdmin(s.adminID, requesterID) {
+		return apperror.ErrNoPermission
+	}
+
+	return s.clientRepo.Delete(ctx, ID)
+}
+
+func (s *ClientService) Get(ctx context.Context, ID string) (*model.Client, error) {
+	return s.clientRepo.GetByID(ctx, ID)
+}
+
+// Authenticate checks the client credentials of a token endpoint request,
+// public clients are identified by client_id only.
+func (s *ClientService) Authenticate(ctx context.Context, clientID, secret string) (*model.Client, error) {
+	if clientID == "" {
+		return nil, fmt.Errorf("%w: missing client_id", apperror.ErrInvalidClient)
+	}
+
+	client, err := s.clientRepo.GetByID(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrClientNotFound) {
+			return nil, fmt.Errorf("%w: %w", apperror.ErrInvalidClient, err)
+		}
+		return nil, err
+	}
+
+	if client.Public {
+		if secret != "" {
+			return nil, fmt.Errorf("%w: public client can't use a secret", apperror.ErrInvalidClient)
+		}
+		return client, nil
+	}
+
+	if secret == "" || !s.pwdHandler.VerifyPwd(secret, client.SecretHash) {
+		return nil, fmt.Errorf("%w: client authentication failed", apperror.ErrInvalidClient)
+	}
+
+	return client, nil
+}
+
+func (s *ClientService) create(ctx context.Context, client *model.Client) (string, error) {
+	if err := validateClient(client); err != nil {
+		return "", err
+	}
+
+	client.ID = uuid.NewString()
+	client.CreatedAt = time.Now()
+
+	secret := ""
+	if !client.Public {
+		var err error
+		secret, err = utils.GenerateOpaqueToken()
+		if err != nil {
+			return "", fmt.Errorf("%w: client secret", apperror.ErrGeneratingError)
+		}
+
+		client.SecretHash, err = s.pwdHandler.GeneratePwdHash(secret)
+		if err != nil {
+			return "", fmt.Errorf("%w: client secret hash", apperror.ErrGeneratingError)
+		}
+	}
+
+	if err := s.clientRepo.Create(ctx, client); err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+func validateClient(client *model.Client) error {
+	for _, uri := range slices.Concat(client.RedirectURIs, client.PostLogoutRedirectURIs) {
+		if !validClientURI(uri) {
+			return fmt.Errorf("%w: invalid redirect URI %q", apperror.ErrInvalidRequest, uri)
+		}
+	}
+
+	if client.BackchannelLogoutURI != "" && !validClientURI(client.BackchannelLogoutURI) {
+		return fmt.Errorf("%w: invalid back-channel logout URI %q", apperror.ErrInvalidRequest, client.BackchannelLogoutURI)
+	}
+
+	if len(client.GrantTypes) == 0 {
+		client.GrantTypes = []string{GrantTypeAuthorizationCode, GrantTypeRefreshToken}
+	}
+	for _, grantType := range client.GrantTypes {
+		if !slices.Contains(SupportedGrantTypes, grantType) {
+			return fmt.Errorf("%w: unsupported grant type %q", apperror.ErrInvalidRequest, grantType)
+		}
+	}
+
+	if client.Public && client.AllowsGrant(GrantTypeClientCredentials) {
+		return fmt.Errorf("%w: public clients can't use client_credentials", apperror.ErrInvalidRequest)
+	}
+
+	if client.Public && client.AllowsGrant(GrantTypeTokenExchange) {
+		return fmt.Errorf("%w: public clients can't use token exchange", apperror.ErrInvalidRequest)
+	}
+
+	if client.JWKS != "" {
+		if _, err := utils.ParseJWKS(client.JWKS); err != nil {
+			return fmt.Errorf("%w: invalid jwks: %w", apperror.ErrInvalidRequest, err)
+		}
+	}
+
+	if client.AccessTokenTTL < 0 || client.RefreshTokenTTL < 0 {
+		return fmt.Errorf("%w: negative token lifetime", apperror.ErrInvalidRequest)
+	}
+
+	return nil
+}
+
+func validClientURI(uri string) bool {
+	u, err := url.Parse(uri)
+	return err == nil && u.IsAbs() && u.Fragment == ""
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/model"
+	"github.com/kkonst40/isso/internal/repo"
+	"github.com/kkonst40/isso/internal/utils"
+)
+
+type ConsentService struct {
+	consentRepo      *repo.ConsentGrantRepo
+	refreshTokenRepo *repo.RefreshTokenRepo
+}
+
+func NewConsentService(
+	consentRepo *repo.ConsentGrantRepo,
+	refreshTokenRepo *repo.RefreshTokenRepo,
+) *ConsentService {
+	return &ConsentService{
+		consentRepo:      consentRepo,
+		refreshTokenRepo: refreshTokenRepo,
+	}
+}
+
+// Granted returns the scopes the user already approved for the client.
+func (s *ConsentService) Granted(ctx context.Context, userID uuid.UUID, clientID string) ([]string, error) {
+	grant, err := s.consentRepo.Get(ctx, userID, clientID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrGrantNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return grant.Scopes, nil
+}
+
+// Covers reports whether the user's grant includes every requested scope.
+func (s *ConsentService) Covers(ctx context.Context, userID uuid.UUID, clientID, scope string) (bool, error) {
+	granted, err := s.Granted(ctx, userID, clientID)
+	if err != nil {
+		return false, err
+	}
+
+	return utils.ScopeSubset(scope, granted), nil
+}
+
+func (s *ConsentService) Grant(ctx context.Context, userID uuid.UUID, clientID, scope string) error {
+	return s.consentRepo.Add(ctx, userID, clientID, utils.Scopes(scope))
+}
+
+func (s *ConsentService) List(ctx context.Context, userID uuid.UUID) ([]model.ConsentGrant, error) {
+	return s.consentRepo.GetByUser(ctx, userID)
+}
+
+// Revoke deletes the grant and the refresh tokens issued with it, the
+// client has to ask for consent again.
+func (s *ConsentService) Revoke(ctx context.Context, userID uuid.UUID, clientID string) error {
+	if err := s.consentRepo.Delete(ctx, userID, clientID); err != nil {
+		return err
+	}
+
+	if err := s.refreshTokenRepo.RevokeByUserAndClient(ctx, userID, clientID); err != nil {
+		return fmt.Errorf("revoking client tokens: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/model"
+	"github.com/kkonst40/isso/internal/utils"
+)
+
+const (
+	GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+	deviceCodeTTL      = 10 * time.Minute
+	devicePollInterval = 5 * time.Second
+	// RFC 8628 section 3.5: slow_down adds 5 seconds to the interval
+	devicePollSlowDown = 5 * time.Second
+	cleanupEvery       = time.Hour
+	userCodeAttempts   = 3
+)
+
+// DeviceAuthorize starts the device flow for the client, RFC 8628 section 3.1.
+func (s *OIDCService) DeviceAuthorize(ctx context.Context, clientID, clientSecret, scope string) (*model.DeviceAuthorization, error) {
+	client, err := s.clientService.Authenticate(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if !client.AllowsGrant(GrantTypeDeviceCode) {
+		return nil, fmt.Errorf("%w: device code grant is not allowed", apperror.ErrUnauthorizedClient)
+	}
+
+	if !utils.ScopeSubset(scope, utils.UserScopes) {
+		return nil, fmt.Errorf("%w: unknown scope", apperror.ErrInvalidScope)
+	}
+
+	deviceCode, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, fmt.Errorf("%w: device code", apperror.ErrGeneratingError)
+	}
+
+	now := time.Now()
+	code := &model.DeviceCode{
+		DeviceCodeHash: utils.HashToken(deviceCode),
+		ClientID:       client.ID,
+		Scope:          scope,
+		Interval:       devicePollInterval,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(deviceCodeTTL),
+	}
+
+	for attempt := 0; ; attempt++ {
+		code.UserCode, err = utils.GenerateUserCode()
+		if err != nil {
+			return nil, fmt.Errorf("%w: user code", apperror.ErrGeneratingError)
+		}
+
+		err = s.deviceCodeRepo.Create(ctx, code)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, apperror.ErrUserCodeTaken) || attempt+1 == userCodeAttempts {
+			return nil, err
+		}
+	}
+
+	return &model.DeviceAuthorization{
+		DeviceCode: deviceCode,
+		UserCode:   utils.FormatUserCode(code.UserCode),
+		ExpiresAt:  code.ExpiresAt,
+		Interval:   code.Interval,
+	}, nil
+}
+
+// DeviceVerification looks up a pending code typed in by the user, so the
+// verification page can show which client asks for access.
+func (s *OIDCService) DeviceVerification(ctx context.Context, userCode string) (*model.DeviceVerification, error) {
+	code, err := s.pendingDeviceCode(ctx, userCode)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := s.clientService.Get(ctx, code.ClientID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrClientNotFound) {
+			return nil, apperror.ErrInvalidUserCode
+		}
+		return nil, err
+	}
+
+	return &model.DeviceVerification{
+		UserCode:   utils.FormatUserCode(code.UserCode),
+		ClientName: client.Name,
+		Scope:      code.Scope,
+	}, nil
+}
+
+// DeviceDecide records the user's answer, the polling client gets tokens
+// or access_denied on its next token request.
+func (s *OIDCService) DeviceDecide(
+	ctx context.Context,
+	userCode string,
+	userID uuid.UUID,
+	approve bool,
+	auth model.Authentication,
+) error {
+	code, err := s.pendingDeviceCode(ctx, userCode)
+	if err != nil {
+		return err
+	}
+
+	decided, err := s.deviceCodeRepo.Decide(ctx, code.UserCode, userID, approve, auth)
+	if err != nil {
+		return err
+	}
+	if !decided {
+		return apperror.ErrInvalidUserCode
+	}
+
+	return nil
+}
+
+// RunCleanup deletes expired device codes, so their user codes can be
+// reused, and expired pushed authorization requests.
+func (s *OIDCService) RunCleanup(ctx context.Context) {
+	ticker := time.NewTicker(cleanupEvery)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.deviceCodeRepo.DeleteExpired(ctx, time.Now()); err != nil {
+				log.Println("Device codes cleanup error", "error", err.Error())
+			}
+			if _, err := s.pushedRequestRepo.DeleteExpired(ctx, time.Now()); err != nil {
+				log.Println("Pushed authorization requests cleanup error", "error", err.Error())
+			}
+		}
+	}
+}
+
+func (s *OIDCService) exchangeDeviceCode(ctx context.Context, client *model.Client, req *model.TokenRequest) (*model.OAuthTokens, error) {
+	code, err := s.deviceCodeRepo.GetByHash(ctx, utils.HashToken(req.DeviceCode))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	interval, err := pollDeviceCode(code, client.ID, now)
+	if interval > 0 {
+		if err := s.deviceCodeRepo.SetPolled(ctx, code.DeviceCodeHash, now, interval); err != nil {
+			return nil, err
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	marked, err := s.deviceCodeRepo.MarkUsed(ctx, code.DeviceCodeHash)
+	if err != nil {
+		return nil, err
+	}
+	if !marked {
+		return nil, fmt.Errorf("%w: device code already used", apperror.ErrInvalidGrant)
+	}
+
+	user, err := s.userRepo.GetByID(ctx, *code.UserID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrUserNotFound) {
+			return nil, fmt.Errorf("%w: %w", apperror.ErrInvalidGrant, err)
+		}
+		return nil, err
+	}
+
+	tokens, err := s.tokenService.IssueForClient(ctx, user, client, code.Scope, code.Auth)
+	if err != nil {
+		return nil, err
+	}
+
+	if !utils.HasScope(code.Scope, utils.ScopeOfflineAccess) {
+		tokens.RefreshToken = ""
+	}
+
+	result := &model.OAuthTokens{TokenPair: *tokens}
+	if utils.HasScope(code.Scope, utils.ScopeOpenID) {
+		result.IDToken, err = s.jwtProvider.GenerateIDToken(user, client.ID, code.Scope, "", tokens.AccessToken, code.Auth)
+		if err != nil {
+			return nil, fmt.Errorf("%w: id token", apperror.ErrGeneratingError)
+		}
+	}
+
+	return result, nil
+}
+
+// pollDeviceCode answers a token request for the device code, RFC 8628
+// section 3.5. While the user hasn't decided it returns the interval to
+// store with the poll, raised when the client polls too fast.
+func pollDeviceCode(code *model.DeviceCode, clientID string, now time.Time) (time.Duration, error) {
+	if code.ClientID != clientID {
+		return 0, fmt.Errorf("%w: device code was issued to another client", apperror.ErrInvalidGrant)
+	}
+
+	if now.After(code.ExpiresAt) {
+		return 0, apperror.ErrExpiredToken
+	}
+
+	if code.DeniedAt != nil {
+		return 0, fmt.Errorf("%w: the user denied the request", apperror.ErrAccessDenied)
+	}
+
+	if code.ApprovedAt != nil {
+		return 0, nil
+	}
+
+	if code.LastPolledAt != nil && now.Sub(*code.LastPolledAt) < code.Interval {
+		return code.Interval + devicePollSlowDown, apperror.ErrSlowDown
+	}
+
+	return code.Interval, apperror.ErrAuthorizationPending
+}
+
+func (s *OIDCService) pendingDeviceCode(ctx context.Context, userCode string) (*model.DeviceCode, error) {
+	code, err := s.deviceCodeRepo.GetByUserCode(ctx, utils.NormalizeUserCode(userCode))
+	if err != nil {
+		return nil, err
+	}
+
+	if code.ApprovedAt != nil || code.DeniedAt != nil || time.Now().After(code.ExpiresAt) {
+		return nil, apperror.ErrInvalidUserCode
+	}
+
+	return code, nil
+}
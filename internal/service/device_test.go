@@ -0,0 +1,107 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/model"
+)
+
+func TestPollDeviceCode(t *testing.T) {
+	now := time.Now()
+	justNow := now.Add(-time.Second)
+	longAgo := now.Add(-time.Minute)
+	pending := func() model.DeviceCode {
+		return model.DeviceCode{ClientID: "tv", Interval: devicePollInterval, ExpiresAt: now.Add(time.Minute)}
+	}
+
+	tests := []struct {
+		name     string
+		code     func(code *model.DeviceCode)
+		clientID string
+		interval time.Duration
+		err      error
+	}{
+		{name: "first poll", interval: devicePollInterval, err: apperror.ErrAuthorizationPending},
+		{
+			name:     "poll after the interval",
+			code:     func(code *model.DeviceCode) { code.LastPolledAt = &longAgo },
+			interval: devicePollInterval,
+			err:      apperror.ErrAuthorizationPending,
+		},
+		{
+			name:     "poll too fast",
+			code:     func(code *model.DeviceCode) { code.LastPolledAt = &justNow },
+			interval: devicePollInterval + devicePollSlowDown,
+			err:      apperror.ErrSlowDown,
+		},
+		{name: "approved", code: func(code *model.DeviceCode) { code.ApprovedAt = &justNow }},
+		{
+			// the client learns about the approval even when polling too fast
+			name: "approved, polled too fast",
+			code: func(code *model.DeviceCode) { code.ApprovedAt, code.LastPolledAt = &justNow, &justNow },
+		},
+		{name: "denied", code: func(code *model.DeviceCode) { code.DeniedAt = &justNow }, err: apperror.ErrAccessDenied},
+		{name: "expired", code: func(code *model.DeviceCode) { code.ExpiresAt = justNow }, err: apperror.ErrExpiredToken},
+		{
+			name: "expired after approval",
+			code: func(code *model.DeviceCode) { code.ApprovedAt, code.ExpiresAt = &longAgo, justNow },
+			err:  apperror.ErrExpiredToken,
+		},
+		{name: "another client", clientID: "other", err: apperror.ErrInvalidGrant},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := pending()
+			if tt.code != nil {
+				tt.code(&code)
+			}
+			clientID := tt.clientID
+			if clientID == "" {
+				clientID = "tv"
+			}
+
+			interval, err := pollDeviceCode(&code, clientID, now)
+			if interval != tt.interval {
+				t.Fatalf("interval = %v, want %v", interval, tt.interval)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+// A client that keeps polling too fast is slowed down further every time.
+func TestPollDeviceCodeSlowsDown(t *testing.T) {
+	start := time.Now()
+	code := &model.DeviceCode{ClientID: "tv", Interval: devicePollInterval, ExpiresAt: start.Add(time.Hour)}
+
+	polls := []struct {
+		after    time.Duration
+		interval time.Duration
+		err      error
+	}{
+		{after: 0, interval: 5 * time.Second, err: apperror.ErrAuthorizationPending},
+		{after: time.Second, interval: 10 * time.Second, err: apperror.ErrSlowDown},
+		{after: 6 * time.Second, interval: 15 * time.Second, err: apperror.ErrSlowDown},
+		{after: 15 * time.Second, interval: 15 * time.Second, err: apperror.ErrAuthorizationPending},
+	}
+
+	now := start
+	for i, poll := range polls {
+		now = now.Add(poll.after)
+
+		interval, err := pollDeviceCode(code, "tv", now)
+		if interval != poll.interval || !errors.Is(err, poll.err) {
+			t.Fatalf("poll %d: got %v, %v, want %v, %v", i, interval, err, poll.interval, poll.err)
+		}
+
+		// what SetPolled stores
+		polledAt := now
+		code.LastPolledAt, code.Interval = &polledAt, interval
+	}
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/config"
+	"github.com/kkonst40/isso/internal/model"
+	"github.com/kkonst40/isso/internal/repo"
+	"github.com/kkonst40/isso/internal/utils"
+)
+
+const (
+	emailVerificationTTL  = 24 * time.Hour
+	emailVerificationPath = "/email"
+)
+
+type EmailService struct {
+	mailer           utils.Mailer
+	credValidator    *utils.CredValidator
+	verificationRepo *repo.EmailVerificationRepo
+	userRepo         *repo.UserRepo
+	cfg              *config.Config
+}
+
+func NewEmailService(
+	mailer utils.Mailer,
+	credValidator *utils.CredValidator,
+	verificationRepo *repo.EmailVerificationRepo,
+	userRepo *repo.UserRepo,
+	cfg *config.Config,
+) *EmailService {
+	return &EmailService{
+		mailer:           mailer,
+		credValidator:    credValidator,
+		verificationRepo: verificationRepo,
+		userRepo:         userRepo,
+		cfg:              cfg,
+	}
+}
+
+// RequestChange mails a confirmation link to the new address, the user's
+// email is only changed once the link is opened.
+func (s *EmailService) RequestChange(ctx context.Context, userID uuid.UUID, email string) error {
+	email = strings.TrimSpace(email)
+	if !s.credValidator.ValidateEmail(email) {
+		return apperror.ErrInvalidEmail
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if user.Email != nil && user.EmailVerified && strings.EqualFold(*user.Email, email) {
+		return nil
+	}
+
+	token, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return fmt.Errorf("%w: verification token", apperror.ErrGeneratingError)
+	}
+
+	now := time.Now()
+	if err := s.verificationRepo.Replace(ctx, &model.EmailVerification{
+		TokenHash: utils.HashToken(token),
+		UserID:    userID,
+		Email:     email,
+		CreatedAt: now,
+		ExpiresAt: now.Add(emailVerificationTTL),
+	}); err != nil {
+		return err
+	}
+
+	link := strings.TrimSuffix(s.cfg.JWT.Issuer, "/") + emailVerificationPath + "?" + url.Values{"token": {token}}.Encode()
+
+	if err := s.mailer.Send(ctx, utils.Mail{
+		To:      email,
+		Subject: "Подтверждение почты",
+		Body: fmt.Sprintf(
+			"Чтобы привязать этот адрес к учётной записи %s, перейдите по ссылке:\n%s\n\n"+
+				"Ссылка действует %d часа. Если вы не указывали этот адрес, просто проигнорируйте это письмо.\n",
+			user.Login, link, int(emailVerificationTTL.Hours()),
+		),
+	}); err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrSendingMail, err)
+	}
+
+	return nil
+}
+
+// Confirm stores the address the link was mailed to. The previous address
+// is told about the change.
+func (s *EmailService) Confirm(ctx context.Context, token string) error {
+	verification, err := s.verificationRepo.Take(ctx, utils.HashToken(token))
+	if err != nil {
+		return err
+	}
+
+	if time.Now().After(verification.ExpiresAt) {
+		return fmt.Errorf("%w: link expired", apperror.ErrInvalidVerificationToken)
+	}
+
+	user, err := s.userRepo.GetByID(ctx, verification.UserID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.userRepo.SetEmail(ctx, user.ID, verification.Email); err != nil {
+		return err
+	}
+
+	if user.Email != nil && user.EmailVerified && !strings.EqualFold(*user.Email, verification.Email) {
+		if err := s.mailer.Send(ctx, utils.Mail{
+			To:      *user.Email,
+			Subject: "Адрес почты изменён",
+			Body: fmt.Sprintf(
+				"К учётной записи %s привязан новый адрес почты, этот адрес больше не используется.\n"+
+					"Если вы этого не делали, срочно смените пароль.\n",
+				user.Login,
+			),
+		}); err != nil {
+			log.Println("Email change notice error", "error", err.Error())
+		}
+	}
+
+	return nil
+}
+
+func (s *EmailService) RunCleanup(ctx context.Context) {
+	ticker := time.NewTicker(cleanupEvery)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.verificationRepo.DeleteExpired(ctx, time.Now()); err != nil {
+				log.Println("Email verifications cleanup error", "error", err.Error())
+			}
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/model"
+	"github.com/kkonst40/isso/internal/repo"
+	"github.com/kkonst40/isso/internal/utils"
+)
+
+const (
+	emailLoginTTL = 10 * time.Minute
+	// a new request within this time gets the challenge already mailed
+	emailLoginResendAfter = time.Minute
+	emailLoginMaxAttempts = 5
+	// a guessing attacker gets emailLoginMaxAttempts codes per
+	// emailLoginLockout, however many challenges are started
+	emailLoginLockout = 15 * time.Minute
+)
+
+type EmailLoginService struct {
+	jwtProvider   *utils.JWTProvider
+	mailer        utils.Mailer
+	challengeRepo *repo.EmailLoginChallengeRepo
+	lockoutRepo   *repo.EmailLoginLockoutRepo
+	userRepo      *repo.UserRepo
+}
+
+func NewEmailLoginService(
+	jwtProvider *utils.JWTProvider,
+	mailer utils.Mailer,
+	challengeRepo *repo.EmailLoginChallengeRepo,
+	lockoutRepo *repo.EmailLoginLockoutRepo,
+	userRepo *repo.UserRepo,
+) *EmailLoginService {
+	return &EmailLoginService{
+		jwtProvider:   jwtProvider,
+		mailer:        mailer,
+		challengeRepo: challengeRepo,
+		lockoutRepo:   lockoutRepo,
+		userRepo:      userRepo,
+	}
+}
+
+// Start mails a login link and a code to the user's verified email. The
+// returned challenge ID is needed to redeem the code. Unknown logins and
+// users without a verified email get a random ID, so they can't be told
+// apart. returnTo is put into the link when it is a local path.
+func (s *EmailLoginService) Start(ctx context.Context, login, returnTo string) (uuid.UUID, error) {
+	user, err := s.userRepo.GetByLogin(ctx, login)
+	if err != nil && !errors.Is(err, apperror.ErrUserNotFound) {
+		return uuid.UUID{}, err
+	}
+	if err != nil || user.Email == nil || !user.EmailVerified {
+		return uuid.New(), nil
+	}
+
+	now := time.Now()
+
+	latest, err := s.challengeRepo.Latest(ctx, user.ID)
+	if err != nil && !errors.Is(err, apperror.ErrInvalidLoginCode) {
+		return uuid.UUID{}, err
+	}
+	if err == nil && latest.UsedAt == nil && now.Sub(latest.CreatedAt) < emailLoginResendAfter {
+		return latest.ID, nil
+	}
+
+	challengeID, err := uuid.NewV7()
+	if err != nil {
+		return uuid.UUID{}, fmt.Errorf("%w: challenge id", apperror.ErrGeneratingError)
+	}
+
+	code, err := utils.GenerateLoginCode()
+	if err != nil {
+		return uuid.UUID{}, fmt.Errorf("%w: login code", apperror.ErrGeneratingError)
+	}
+
+	challenge := &model.EmailLoginChallenge{
+		ID:        challengeID,
+		UserID:    user.ID,
+		CodeHash:  utils.HashToken(code),
+		CreatedAt: now,
+		ExpiresAt: now.Add(emailLoginTTL),
+	}
+
+	token, err := s.jwtProvider.GenerateEmailLoginToken(user.ID, challengeID, challenge.ExpiresAt)
+	if err != nil {
+		return uuid.UUID{}, fmt.Errorf("%w: login link", apperror.ErrGeneratingError)
+	}
+
+	if err := s.challengeRepo.Replace(ctx, challenge); err != nil {
+		return uuid.UUID{}, err
+	}
+
+	if err := s.mailer.Send(ctx, utils.Mail{
+		To:      *user.Email,
+		Subject: "Вход в isso",
+		Body: fmt.Sprintf(
+			"Код для входа: %s\n\nИли перейдите по ссылке:\n%s\n\n"+
+				"Код и ссылка действуют %d минут. Если вы не запрашивали вход, просто проигнорируйте это письмо.\n",
+			code, s.loginLink(token, returnTo), int(emailLoginTTL.Minutes()),
+		),
+	}); err != nil {
+		return uuid.UUID{}, fmt.Errorf("%w: %w", apperror.ErrSendingMail, err)
+	}
+
+	return challengeID, nil
+}
+
+// VerifyLink redeems the token of a login link and returns the user with
+// the methods used.
+func (s *EmailLoginService) VerifyLink(ctx context.Context, token string) (uuid.UUID, []string, error) {
+	claims, err := s.jwtProvider.ParseEmailLoginToken(token)
+	if err != nil {
+		return uuid.UUID{}, nil, fmt.Errorf("%w: %w", apperror.ErrInvalidLoginCode, err)
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.UUID{}, nil, fmt.Errorf("%w: invalid subject", apperror.ErrInvalidLoginCode)
+	}
+
+	challengeID, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return uuid.UUID{}, nil, fmt.Errorf("%w: invalid jti", apperror.ErrInvalidLoginCode)
+	}
+
+	if err := s.use(ctx, challengeID); err != nil {
+		return uuid.UUID{}, nil, err
+	}
+
+	return userID, []string{AMREmail}, nil
+}
+
+// VerifyCode redeems the mailed code, a challenge is used up after
+// emailLoginMaxAttempts wrong codes. Wrong codes also count against the
+// user's lockout, which a new challenge doesn't reset.
+func (s *EmailLoginService) VerifyCode(ctx context.Context, challengeID uuid.UUID, code string) (uuid.UUID, []string, error) {
+	challenge, err := s.challengeRepo.Get(ctx, challengeID)
+	if err != nil {
+		return uuid.UUID{}, nil, err
+	}
+
+	lockedUntil, err := s.lockoutRepo.LockedUntil(ctx, challenge.UserID)
+	if err != nil {
+		return uuid.UUID{}, nil, err
+	}
+
+	now := time.Now()
+	wrong, err := checkLoginCode(challenge, lockedUntil, code, now)
+	if wrong {
+		if err := s.challengeRepo.Fail(ctx, challenge.ID); err != nil {
+			return uuid.UUID{}, nil, err
+		}
+		if err := s.lockoutRepo.Fail(ctx, challenge.UserID, emailLoginMaxAttempts, now.Add(emailLoginLockout)); err != nil {
+			return uuid.UUID{}, nil, err
+		}
+	}
+	if err != nil {
+		return uuid.UUID{}, nil, err
+	}
+
+	if err := s.use(ctx, challenge.ID); err != nil {
+		return uuid.UUID{}, nil, err
+	}
+
+	if err := s.lockoutRepo.Reset(ctx, challenge.UserID); err != nil {
+		return uuid.UUID{}, nil, err
+	}
+
+	return challenge.UserID, []string{AMREmail}, nil
+}
+
+// checkLoginCode decides on a code typed in for the challenge, wrong
+// reports a guess that counts against the challenge and the user.
+func checkLoginCode(challenge *model.EmailLoginChallenge, lockedUntil *time.Time, code string, now time.Time) (bool, error) {
+	if lockedUntil != nil && now.Before(*lockedUntil) {
+		return false, apperror.ErrLoginCodeLocked
+	}
+
+	if challenge.UsedAt != nil || now.After(challenge.ExpiresAt) || challenge.Attempts >= emailLoginMaxAttempts {
+		return false, fmt.Errorf("%w: challenge is not active", apperror.ErrInvalidLoginCode)
+	}
+
+	codeHash := utils.HashToken(strings.TrimSpace(code))
+	if subtle.ConstantTimeCompare([]byte(codeHash), []byte(challenge.CodeHash)) != 1 {
+		return true, apperror.ErrInvalidLoginCode
+	}
+
+	return false, nil
+}
+
+func (s *EmailLoginService) RunCleanup(ctx context.Context) {
+	ticker := time.NewTicker(cleanupEvery)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.challengeRepo.DeleteExpired(ctx, time.Now()); err != nil {
+				log.Println("Email login challenges cleanup error", "error", err.Error())
+			}
+		}
+	}
+}
+
+// use marks the challenge used, the link and the code of a challenge can't
+// both be redeemed.
+func (s *EmailLoginService) use(ctx context.Context, challengeID uuid.UUID) error {
+	used, err := s.challengeRepo.Use(ctx, challengeID, time.Now(), emailLoginMaxAttempts)
+	if err != nil {
+		return err
+	}
+	if !used {
+		return fmt.Errorf("%w: challenge already used or expired", apperror.ErrInvalidLoginCode)
+	}
+
+	return nil
+}
+
+// loginLink points to the login page, which posts the token, so a mail
+// scanner opening the link doesn't use it up.
+func (s *EmailLoginService) loginLink(token, returnTo string) string {
+	params := url.Values{"email_token": {token}}
+	if strings.HasPrefix(returnTo, "/") && !strings.HasPrefix(returnTo, "//") && !strings.Contains(returnTo, `\`) {
+		params.Set("return_to", returnTo)
+	}
+
+	return strings.TrimSuffix(s.jwtProvider.Cfg.JWT.Issuer, "/") + "/login?" + params.Encode()
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/model"
+	"github.com/kkonst40/isso/internal/utils"
+)
+
+func loginChallenge(code string, now time.Time) *model.EmailLoginChallenge {
+	return &model.EmailLoginChallenge{
+		ID:        uuid.New(),
+		CodeHash:  utils.HashToken(code),
+		CreatedAt: now,
+		ExpiresAt: now.Add(emailLoginTTL),
+	}
+}
+
+func TestCheckLoginCode(t *testing.T) {
+	now := time.Now()
+	earlier := now.Add(-time.Minute)
+	later := now.Add(time.Minute)
+
+	tests := []struct {
+		name        string
+		challenge   func(challenge *model.EmailLoginChallenge)
+		lockedUntil *time.Time
+		code        string
+		wrong       bool
+		err         error
+	}{
+		{name: "right code", code: "123456"},
+		{name: "right code with spaces", code: " 123456\n"},
+		{name: "wrong code", code: "654321", wrong: true, err: apperror.ErrInvalidLoginCode},
+		{name: "no code", code: "", wrong: true, err: apperror.ErrInvalidLoginCode},
+		{
+			name:      "used",
+			challenge: func(challenge *model.EmailLoginChallenge) { challenge.UsedAt = &earlier },
+			code:      "123456",
+			err:       apperror.ErrInvalidLoginCode,
+		},
+		{
+			name:      "expired",
+			challenge: func(challenge *model.EmailLoginChallenge) { challenge.ExpiresAt = earlier },
+			code:      "123456",
+			err:       apperror.ErrInvalidLoginCode,
+		},
+		{
+			name:      "too many wrong codes",
+			challenge: func(challenge *model.EmailLoginChallenge) { challenge.Attempts = emailLoginMaxAttempts },
+			code:      "123456",
+			err:       apperror.ErrInvalidLoginCode,
+		},
+		// a locked user doesn't learn whether the code was right
+		{name: "locked", lockedUntil: &later, code: "123456", err: apperror.ErrLoginCodeLocked},
+		{name: "locked, wrong code", lockedUntil: &later, code: "654321", err: apperror.ErrLoginCodeLocked},
+		{name: "lock expired", lockedUntil: &earlier, code: "123456"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			challenge := loginChallenge("123456", now.Add(-time.Minute))
+			if tt.challenge != nil {
+				tt.challenge(challenge)
+			}
+
+			wrong, err := checkLoginCode(challenge, tt.lockedUntil, tt.code, now)
+			if wrong != tt.wrong {
+				t.Fatalf("wrong = %v, want %v", wrong, tt.wrong)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+// Asking for a new code every minute must not give more guesses, the
+// wrong codes of earlier challenges still count.
+func TestCheckLoginCodeLockoutOutlivesChallenges(t *testing.T) {
+	now := time.Now()
+
+	// what EmailLoginLockoutRepo stores
+	var (
+		failedAttempts int
+		lockedUntil    *time.Time
+	)
+	guess := func(challenge *model.EmailLoginChallenge, code string) error {
+		wrong, err := checkLoginCode(challenge, lockedUntil, code, now)
+		if wrong {
+			challenge.Attempts++
+			failedAttempts++
+			if failedAttempts >= emailLoginMaxAttempts {
+				until := now.Add(emailLoginLockout)
+				failedAttempts, lockedUntil = 0, &until
+			}
+		}
+		return err
+	}
+
+	first := loginChallenge("111111", now)
+	for range emailLoginMaxAttempts - 1 {
+		if err := guess(first, "000000"); !errors.Is(err, apperror.ErrInvalidLoginCode) {
+			t.Fatalf("err = %v, want %v", err, apperror.ErrInvalidLoginCode)
+		}
+	}
+
+	now = now.Add(emailLoginResendAfter)
+	second := loginChallenge("222222", now)
+
+	if err := guess(second, "000000"); !errors.Is(err, apperror.ErrInvalidLoginCode) {
+		t.Fatalf("err = %v, want %v", err, apperror.ErrInvalidLoginCode)
+	}
+	if second.Attempts >= emailLoginMaxAttempts {
+		t.Fatalf("the new challenge has %d attempts, the lockout must come from the user", second.Attempts)
+	}
+
+	// the next challenge starts with no attempts, the user is still locked
+	now = now.Add(emailLoginResendAfter)
+	third := loginChallenge("333333", now)
+	if err := guess(third, "333333"); !errors.Is(err, apperror.ErrLoginCodeLocked) {
+		t.Fatalf("err = %v, want %v", err, apperror.ErrLoginCodeLocked)
+	}
+
+	now = now.Add(emailLoginLockout)
+	fourth := loginChallenge("444444", now)
+	if err := guess(fourth, "444444"); err != nil {
+		t.Fatalf("after the lockout: %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/model"
+	"github.com/kkonst40/isso/internal/utils"
+)
+
+const (
+	GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+	TokenTypeURIAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeURIJWT         = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// exchangeToken swaps a user's access token presented to the client for
+// a token of another audience the client is allowed to call, RFC 8693.
+// The new token can't outlive the subject token or widen its scope.
+func (s *OIDCService) exchangeToken(ctx context.Context, client *model.Client, req *model.TokenRequest) (*model.OAuthTokens, error) {
+	if client.Public {
+		return nil, fmt.Errorf("%w: public clients can't exchange tokens", apperror.ErrUnauthorizedClient)
+	}
+
+	if req.SubjectToken == "" {
+		return nil, fmt.Errorf("%w: missing subject_token", apperror.ErrInvalidRequest)
+	}
+	if req.SubjectTokenType != TokenTypeURIAccessToken && req.SubjectTokenType != TokenTypeURIJWT {
+		return nil, fmt.Errorf("%w: unsupported subject_token_type", apperror.ErrInvalidRequest)
+	}
+	if req.RequestedTokenType != "" && req.RequestedTokenType != TokenTypeURIAccessToken {
+		return nil, fmt.Errorf("%w: only access tokens can be requested", apperror.ErrInvalidRequest)
+	}
+
+	if req.Audience == "" || !client.CanExchangeInto(req.Audience) {
+		return nil, fmt.Errorf("%w: audience %q is not allowed for the client", apperror.ErrInvalidTarget, req.Audience)
+	}
+
+	subject, err := s.tokenService.ValidateAccessToken(ctx, req.SubjectToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: subject_token: %w", apperror.ErrInvalidRequest, err)
+	}
+	if subject.Machine() {
+		return nil, fmt.Errorf("%w: subject_token has no user", apperror.ErrInvalidRequest)
+	}
+	if !slices.Contains(subject.Audience, client.ID) {
+		return nil, fmt.Errorf("%w: subject_token was not issued to the client", apperror.ErrInvalidRequest)
+	}
+
+	scope := req.Scope
+	if scope == "" {
+		scope = subject.Scope
+	}
+	if !utils.ScopeSubset(scope, utils.Scopes(subject.Scope)) {
+		return nil, fmt.Errorf("%w: scope exceeds the subject_token scope", apperror.ErrInvalidScope)
+	}
+
+	ttl := s.jwtProvider.AccessTTL()
+	if client.AccessTokenTTL > 0 {
+		ttl = client.AccessTokenTTL
+	}
+	if remaining := time.Until(subject.ExpiresAt.Time); remaining < ttl {
+		ttl = remaining
+	}
+
+	accessToken, err := s.jwtProvider.GenerateDelegated(subject, client.ID, req.Audience, scope, ttl)
+	if err != nil {
+		return nil, fmt.Errorf("%w: access token", apperror.ErrGeneratingError)
+	}
+
+	return &model.OAuthTokens{
+		TokenPair: model.TokenPair{
+			AccessToken:     accessToken,
+			AccessExpiresAt: time.Now().Add(ttl),
+			Scope:           scope,
+		},
+		IssuedTokenType: TokenTypeURIAccessToken,
+	}, nil
+}
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/config"
+	"github.com/kkonst40/isso/internal/model"
+	"github.com/kkonst40/isso/internal/utils"
+)
+
+type exchangeTest struct {
+	service     *OIDCService
+	jwtProvider *utils.JWTProvider
+	user        *model.User
+	familyID    uuid.UUID
+	familyCache *utils.FamilyCache
+}
+
+// newExchangeTest builds the service without a database, the user's
+// TokenID and refresh token family are only in the caches.
+func newExchangeTest(t *testing.T) *exchangeTest {
+	t.Helper()
+
+	jwtProvider, err := utils.NewJWTProvider(&config.Config{
+		JWT: config.JWTConfig{
+			SecretKey:           "test-secret-test-secret-test-secret",
+			Issuer:              "https://id.example.com",
+			Audience:            "isso",
+			AccessExpireMinutes: 5,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := &model.User{ID: uuid.New(), Login: "alice", TokenID: uuid.New()}
+	familyID := uuid.New()
+
+	tokenIDCache := utils.NewTokenIDCache(time.Minute)
+	tokenIDCache.Set(user.ID, user.TokenID, tokenIDCache.Generation())
+	familyCache := utils.NewFamilyCache(time.Minute)
+	familyCache.Set(familyID, false)
+
+	tokenService := NewTokenService(jwtProvider, nil, nil, tokenIDCache, familyCache)
+
+	return &exchangeTest{
+		service:     NewOIDCService(jwtProvider, tokenService, nil, nil, nil, nil, nil),
+		jwtProvider: jwtProvider,
+		user:        user,
+		familyID:    familyID,
+		familyCache: familyCache,
+	}
+}
+
+func (e *exchangeTest) subjectToken(t *testing.T, clientID, scope string, ttl time.Duration) string {
+	t.Helper()
+
+	token, err := e.jwtProvider.GenerateForClient(e.user, clientID, e.familyID.String(), scope, ttl, model.Authentication{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+func exchangeRequest(subjectToken, audience, scope string) *model.TokenRequest {
+	return &model.TokenRequest{
+		GrantType:        GrantTypeTokenExchange,
+		SubjectToken:     subjectToken,
+		SubjectTokenType: TokenTypeURIAccessToken,
+		Audience:         audience,
+		Scope:            scope,
+	}
+}
+
+func TestExchangeToken(t *testing.T) {
+	e := newExchangeTest(t)
+	ctx := context.Background()
+	app := &model.Client{ID: "app", ExchangeAudiences: []string{"api"}}
+	api := &model.Client{ID: "api", ExchangeAudiences: []string{"db"}}
+
+	subject := e.subjectToken(t, "app", "openid profile", time.Minute)
+
+	tokens, err := e.service.exchangeToken(ctx, app, exchangeRequest(subject, "api", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokens.IssuedTokenType != TokenTypeURIAccessToken || tokens.RefreshToken != "" {
+		t.Fatalf("got type %q and a refresh token %q", tokens.IssuedTokenType, tokens.RefreshToken)
+	}
+
+	claims, err := e.service.tokenService.ValidateAccessToken(ctx, tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.ID != e.user.ID || claims.Scope != "openid profile" || claims.Audience[0] != "api" {
+		t.Fatalf("got user %s scope %q audience %v", claims.ID, claims.Scope, claims.Audience)
+	}
+	if claims.Act == nil || claims.Act.Subject != "app" {
+		t.Fatalf("act = %+v, want app", claims.Act)
+	}
+	// can't outlive the subject token, the default lifetime is 5 minutes
+	if claims.ExpiresAt.After(time.Now().Add(time.Minute)) {
+		t.Fatalf("exp %v outlives the subject token", claims.ExpiresAt)
+	}
+
+	// the resource server passes the token on, the chain is kept
+	chained, err := e.service.exchangeToken(ctx, api, exchangeRequest(tokens.AccessToken, "db", "openid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err = e.service.tokenService.ValidateAccessToken(ctx, chained.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Scope != "openid" || claims.Act.Subject != "api" || claims.Act.Act == nil || claims.Act.Act.Subject != "app" {
+		t.Fatalf("got scope %q act %+v", claims.Scope, claims.Act)
+	}
+
+	// delegated tokens are revoked with the family of the subject token
+	e.familyCache.Set(e.familyID, true)
+	if _, err := e.service.tokenService.ValidateAccessToken(ctx, chained.AccessToken); !errors.Is(err, apperror.ErrInvalidToken) {
+		t.Fatalf("revoked family: err = %v", err)
+	}
+}
+
+func TestExchangeTokenRejects(t *testing.T) {
+	e := newExchangeTest(t)
+	app := &model.Client{ID: "app", ExchangeAudiences: []string{"api"}}
+
+	subject := e.subjectToken(t, "app", "openid profile", time.Minute)
+	clientToken, err := e.jwtProvider.GenerateClientToken("app", "", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		client *model.Client
+		req    *model.TokenRequest
+		err    error
+	}{
+		{
+			name:   "public client",
+			client: &model.Client{ID: "app", Public: true, ExchangeAudiences: []string{"api"}},
+			req:    exchangeRequest(subject, "api", ""),
+			err:    apperror.ErrUnauthorizedClient,
+		},
+		{name: "audience not allowed", req: exchangeRequest(subject, "db", ""), err: apperror.ErrInvalidTarget},
+		{name: "no audience", req: exchangeRequest(subject, "", ""), err: apperror.ErrInvalidTarget},
+		{name: "wider scope", req: exchangeRequest(subject, "api", "openid email"), err: apperror.ErrInvalidScope},
+		{name: "no subject token", req: exchangeRequest("", "api", ""), err: apperror.ErrInvalidRequest},
+		{name: "invalid subject token", req: exchangeRequest("not a token", "api", ""), err: apperror.ErrInvalidRequest},
+		{
+			name: "subject token of another client",
+			req:  exchangeRequest(e.subjectToken(t, "other", "openid", time.Minute), "api", ""),
+			err:  apperror.ErrInvalidRequest,
+		},
+		{name: "client_credentials token", req: exchangeRequest(clientToken, "api", ""), err: apperror.ErrInvalidRequest},
+		{
+			name: "refresh token type",
+			req: &model.TokenRequest{
+				SubjectToken:     subject,
+				SubjectTokenType: "urn:ietf:params:oauth:token-type:refresh_token",
+				Audience:         "api",
+			},
+			err: apperror.ErrInvalidRequest,
+		},
+		{
+			name: "refresh token requested",
+			req: &model.TokenRequest{
+				SubjectToken:       subject,
+				SubjectTokenType:   TokenTypeURIAccessToken,
+				RequestedTokenType: "urn:ietf:params:oauth:token-type:refresh_token",
+				Audience:           "api",
+			},
+			err: apperror.ErrInvalidRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := tt.client
+			if client == nil {
+				client = app
+			}
+
+			if _, err := e.service.exchangeToken(context.Background(), client, tt.req); !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+		})
+	}
+
+	t.Run("revoked session", func(t *testing.T) {
+		e.familyCache.Set(e.familyID, true)
+
+		_, err := e.service.exchangeToken(context.Background(), app, exchangeRequest(subject, "api", ""))
+		if !errors.Is(err, apperror.ErrInvalidRequest) {
+			t.Fatalf("err = %v, want %v", err, apperror.ErrInvalidRequest)
+		}
+	})
+}
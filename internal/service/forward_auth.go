@@ -0,0 +1,109 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/kkonst40/isso/internal/config"
+)
+
+// Forward-auth policies of a host.
+const (
+	// only logged in users get through
+	ForwardAuthLogin = "login"
+	// anyone gets through, logged in users are identified
+	ForwardAuthPublic = "public"
+	ForwardAuthDeny   = "deny"
+)
+
+type ForwardAuthService struct {
+	hosts         map[string]string
+	defaultPolicy string
+	// hosts under it get the forward-auth cookie, "" when it's host-only
+	cookieDomain string
+}
+
+func NewForwardAuthService(cfg *config.Config) (*ForwardAuthService, error) {
+	s := &ForwardAuthService{
+		hosts:         map[string]string{},
+		defaultPolicy: cfg.ForwardAuth.DefaultPolicy,
+		cookieDomain:  strings.ToLower(strings.TrimPrefix(cfg.ForwardAuth.CookieDomain, ".")),
+	}
+
+	if s.defaultPolicy == "" {
+		s.defaultPolicy = ForwardAuthDeny
+	}
+	if !validForwardAuthPolicy(s.defaultPolicy) {
+		return nil, fmt.Errorf("unknown forward-auth policy %q", s.defaultPolicy)
+	}
+
+	for host, policy := range cfg.ForwardAuth.Hosts {
+		if !validForwardAuthPolicy(policy) {
+			return nil, fmt.Errorf("unknown forward-auth policy %q for host %s", policy, host)
+		}
+		s.hosts[strings.ToLower(host)] = policy
+	}
+
+	return s, nil
+}
+
+// Policy returns the policy of the host, the port is ignored.
+func (s *ForwardAuthService) Policy(host string) string {
+	if policy, ok := s.hosts[hostname(host)]; ok {
+		return policy
+	}
+
+	return s.defaultPolicy
+}
+
+// ReturnURL checks where the user may be sent back after logging in:
+// listed hosts and, under the default policy, hosts the forward-auth cookie
+// is shared with. Other hosts are not trusted, so the default policy can't
+// open redirects.
+func (s *ForwardAuthService) ReturnURL(rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return "", false
+	}
+
+	host := hostname(u.Host)
+	policy, ok := s.hosts[host]
+	if !ok {
+		if !s.sharesCookie(host) {
+			return "", false
+		}
+		policy = s.defaultPolicy
+	}
+	if policy == ForwardAuthDeny {
+		return "", false
+	}
+
+	return u.String(), true
+}
+
+// sharesCookie reports whether the browser sends the forward-auth cookie
+// to the host.
+func (s *ForwardAuthService) sharesCookie(host string) bool {
+	if s.cookieDomain == "" || host == "" {
+		return false
+	}
+
+	return host == s.cookieDomain || strings.HasSuffix(host, "."+s.cookieDomain)
+}
+
+func validForwardAuthPolicy(policy string) bool {
+	switch policy {
+	case ForwardAuthLogin, ForwardAuthPublic, ForwardAuthDeny:
+		return true
+	}
+	return false
+}
+
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/config"
+	"github.com/kkonst40/isso/internal/model"
+	"github.com/kkonst40/isso/internal/utils"
+)
+
+// The forward-auth cookie is shared with the apps' hosts, its token must
+// not work anywhere else and session tokens must not work in its place.
+func TestForwardAuthTokenAudience(t *testing.T) {
+	e := newExchangeTest(t)
+	ctx := context.Background()
+	tokenService := e.service.tokenService
+
+	forwardAuth, err := e.jwtProvider.GenerateForwardAuth(e.user, e.familyID.String(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := tokenService.ValidateForwardAuthToken(ctx, forwardAuth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.ID != e.user.ID || claims.UserName != e.user.Login || claims.Scope != "" {
+		t.Fatalf("got user %s %q scope %q", claims.ID, claims.UserName, claims.Scope)
+	}
+
+	for name, validate := range map[string]func(context.Context, string) (*utils.UserClaims, error){
+		"session":      tokenService.ValidateToken,
+		"api":          tokenService.ValidateAPIToken,
+		"access token": tokenService.ValidateAccessToken,
+	} {
+		if _, err := validate(ctx, forwardAuth); !errors.Is(err, apperror.ErrInvalidToken) {
+			t.Errorf("%s accepts the forward-auth token: %v", name, err)
+		}
+	}
+
+	session, err := e.jwtProvider.GenerateForClient(e.user, "", e.familyID.String(), "", time.Minute, model.Authentication{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tokenService.ValidateForwardAuthToken(ctx, session); !errors.Is(err, apperror.ErrInvalidToken) {
+		t.Fatalf("forward-auth accepts the session token: %v", err)
+	}
+
+	// logging out revokes the family, the cookie stops working with it
+	e.familyCache.Set(e.familyID, true)
+	if _, err := tokenService.ValidateForwardAuthToken(ctx, forwardAuth); !errors.Is(err, apperror.ErrInvalidToken) {
+		t.Fatalf("revoked family: err = %v", err)
+	}
+}
+
+func TestForwardAuthReturnURL(t *testing.T) {
+	hosts := map[string]string{
+		"docs.example.com":  ForwardAuthPublic,
+		"admin.example.com": ForwardAuthDeny,
+		"legacy.other.org":  ForwardAuthLogin,
+	}
+
+	tests := []struct {
+		name          string
+		defaultPolicy string
+		cookieDomain  string
+		hostOnly      bool
+		url           string
+		ok            bool
+	}{
+		{name: "listed host", url: "https://docs.example.com/page", ok: true},
+		{name: "listed host outside the cookie domain", url: "https://legacy.other.org/", ok: true},
+		{name: "denied host", url: "https://admin.example.com/"},
+		{name: "host under the default policy", url: "https://app.example.com/page?q=1", ok: true},
+		{name: "host under the default policy with a port", url: "http://APP.example.com:8080/", ok: true},
+		{name: "cookie domain itself", url: "https://example.com/", ok: true},
+		{name: "leading dot in the cookie domain", cookieDomain: ".example.com", url: "https://app.example.com/", ok: true},
+		{name: "unlisted host outside the cookie domain", url: "https://other.org/"},
+		{name: "look-alike suffix", url: "https://evil-example.com/"},
+		{name: "cookie domain as a prefix", url: "https://example.com.evil.org/"},
+		{name: "default policy deny", defaultPolicy: ForwardAuthDeny, url: "https://app.example.com/"},
+		{name: "host-only cookie", hostOnly: true, url: "https://app.example.com/"},
+		{name: "host-only cookie, listed host", hostOnly: true, url: "https://docs.example.com/", ok: true},
+		{name: "not http", url: "javascript:alert(1)"},
+		{name: "relative", url: "/page"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{ForwardAuth: config.ForwardAuthConfig{
+				Hosts:         hosts,
+				DefaultPolicy: ForwardAuthLogin,
+				CookieDomain:  "example.com",
+			}}
+			if tt.defaultPolicy != "" {
+				cfg.ForwardAuth.DefaultPolicy = tt.defaultPolicy
+			}
+			if tt.cookieDomain != "" {
+				cfg.ForwardAuth.CookieDomain = tt.cookieDomain
+			}
+			if tt.hostOnly {
+				cfg.ForwardAuth.CookieDomain = ""
+			}
+
+			s, err := NewForwardAuthService(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, ok := s.ReturnURL(tt.url); ok != tt.ok {
+				t.Fatalf("ReturnURL(%q) ok = %v, want %v", tt.url, ok, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/config"
+	"github.com/kkonst40/isso/internal/model"
+	"github.com/kkonst40/isso/internal/repo"
+	"github.com/kkonst40/isso/internal/utils"
+)
+
+const keyReloadInterval = time.Minute
+
+type KeyService struct {
+	jwtProvider    *utils.JWTProvider
+	signingKeyRepo *repo.SigningKeyRepo
+	cfg            *config.Config
+	adminID        uuid.UUID
+}
+
+func NewKeyService(
+	jwtProvider *utils.JWTProvider,
+	signingKeyRepo *repo.SigningKeyRepo,
+	cfg *config.Config,
+	adminID uuid.UUID,
+) *KeyService {
+	return &KeyService{
+		jwtProvider:    jwtProvider,
+		signingKeyRepo: signingKeyRepo,
+		cfg:            cfg,
+		adminID:        adminID,
+	}
+}
+
+// Load reads rotated keys from the database into the key ring.
+func (s *KeyService) Load(ctx context.Context) error {
+	records, err := s.signingKeyRepo.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]*utils.SigningKey, 0, len(records))
+	for _, record := range records {
+		key, err := utils.ParseSigningKey(record.Alg, record.ID, record.KeyData)
+		if err != nil {
+			return fmt.Errorf("signing key %s parsing error: %w", record.ID, err)
+		}
+
+		key.NotBefore = record.NotBefore
+		if record.RetireAt != nil {
+			key.RetireAt = *record.RetireAt
+		}
+
+		keys = append(keys, key)
+	}
+
+	s.jwtProvider.SetKeys(keys)
+
+	if !s.jwtProvider.CanSign() {
+		return fmt.Errorf("no active JWT signing key")
+	}
+
+	return nil
+}
+
+// Run reloads keys periodically, so rotations made by other instances
+// are picked up.
+func (s *KeyService) Run(ctx context.Context) {
+	ticker := time.NewTicker(keyReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Load(ctx); err != nil {
+				log.Println("Signing keys reload error", "error", err.Error())
+			}
+		}
+	}
+}
+
+func (s *KeyService) All(ctx context.Context, requesterID uuid.UUID) ([]model.SigningKey, error) {
+	if !isAdmin(s.adminID, requesterID) {
+		return nil, apperror.ErrNoPermission
+	}
+
+	return s.signingKeyRepo.GetAll(ctx)
+}
+
+// Rotate creates a new signing key which starts signing after the publish
+// delay, so verifiers can fetch it from JWKS in advance. Previous keys are
+// retired once the tokens they signed have expired.
+func (s *KeyService) Rotate(ctx context.Context, requesterID uuid.UUID) (*model.SigningKey, error) {
+	if !isAdmin(s.adminID, requesterID) {
+		return nil, apperror.ErrNoPermission
+	}
+
+	alg := s.cfg.JWT.SigningAlg
+	if alg == "" {
+		alg = jwt.SigningMethodHS256.Alg()
+	}
+
+	key, keyData, err := utils.GenerateSigningKey(alg)
+	if err != nil {
+		return nil, fmt.Errorf("%w: signing key", apperror.ErrGeneratingError)
+	}
+
+	now := time.Now()
+	record := &model.SigningKey{
+		ID:        key.ID,
+		Alg:       alg,
+		KeyData:   keyData,
+		CreatedAt: now,
+		NotBefore: now.Add(time.Duration(s.cfg.JWT.KeyPublishMinutes) * time.Minute),
+	}
+	retireAt := record.NotBefore.Add(s.jwtProvider.AccessTTL())
+
+	if err := s.signingKeyRepo.Rotate(ctx, record, retireAt); err != nil {
+		return nil, err
+	}
+
+	if err := s.Load(ctx); err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// Prune deletes keys that are already retired.
+func (s *KeyService) Prune(ctx context.Context, requesterID uuid.UUID) (int64, error) {
+	if !isAdmin(s.adminID, requesterID) {
+		return 0, apperror.ErrNoPermission
+	}
+
+	deleted, err := s.signingKeyRepo.DeleteRetired(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	if err := s.Load(ctx); err != nil {
+		return 0, err
+	}
+
+	return deleted, nil
+}
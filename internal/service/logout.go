@@ -0,0 +1,260 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/model"
+	"github.com/kkonst40/isso/internal/repo"
+	"github.com/kkonst40/isso/internal/utils"
+)
+
+const (
+	logoutPollInterval  = 10 * time.Second
+	logoutBatchSize     = 20
+	logoutLease         = time.Minute
+	logoutRetryBase     = 30 * time.Second
+	logoutRetryMax      = time.Hour
+	logoutMaxAttempts   = 10
+	logoutDeliveryLimit = 5 * time.Second
+)
+
+type LogoutService struct {
+	jwtProvider   *utils.JWTProvider
+	tokenService  *TokenService
+	clientService *ClientService
+	userRepo      *repo.UserRepo
+	logoutRepo    *repo.LogoutNotificationRepo
+	httpClient    *http.Client
+}
+
+func NewLogoutService(
+	jwtProvider *utils.JWTProvider,
+	tokenService *TokenService,
+	clientService *ClientService,
+	userRepo *repo.UserRepo,
+	logoutRepo *repo.LogoutNotificationRepo,
+) *LogoutService {
+	return &LogoutService{
+		jwtProvider:   jwtProvider,
+		tokenService:  tokenService,
+		clientService: clientService,
+		userRepo:      userRepo,
+		logoutRepo:    logoutRepo,
+		httpClient: &http.Client{
+			Timeout: logoutDeliveryLimit,
+			// a redirect would resend the logout token somewhere else
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Logout ends every session of the user, see EndSessions.
+func (s *LogoutService) Logout(ctx context.Context, userID uuid.UUID) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("logging out error: %w", err)
+	}
+
+	_, err = s.EndSessions(ctx, user.ID, func(tokenID uuid.UUID) error {
+		return s.userRepo.RotateTokenID(ctx, user.ID, tokenID)
+	})
+
+	return err
+}
+
+// EndSessions logs the user out everywhere, on logout and when the password
+// changes: clients holding a session are queued for a back-channel
+// notification, then setTokenID stores a new TokenID and refresh tokens
+// are revoked. It returns the new TokenID.
+func (s *LogoutService) EndSessions(ctx context.Context, userID uuid.UUID, setTokenID func(tokenID uuid.UUID) error) (uuid.UUID, error) {
+	if err := s.logoutRepo.EnqueueForUser(ctx, userID); err != nil {
+		return uuid.UUID{}, err
+	}
+
+	tokenID := uuid.New()
+	if err := setTokenID(tokenID); err != nil {
+		s.tokenService.Invalidate(userID)
+		return uuid.UUID{}, err
+	}
+
+	if err := s.tokenService.RevokeAll(ctx, userID); err != nil {
+		return uuid.UUID{}, err
+	}
+
+	return tokenID, nil
+}
+
+// ValidateEndSession checks an RP-initiated logout request and returns
+// where to send the user afterwards, "" if the request has no valid
+// post_logout_redirect_uri. The hint must belong to the logged in user,
+// uuid.Nil if nobody is logged in. hinted reports a hint matching the
+// session, which lets the logout go ahead without asking the user.
+func (s *LogoutService) ValidateEndSession(ctx context.Context, req *model.EndSessionRequest, sessionUserID uuid.UUID) (string, bool, error) {
+	clientID := req.ClientID
+	hinted := false
+
+	if req.IDTokenHint != "" {
+		hint, err := s.jwtProvider.ParseIDTokenHint(req.IDTokenHint)
+		if err != nil {
+			return "", false, fmt.Errorf("%w: invalid id_token_hint", apperror.ErrInvalidRequest)
+		}
+
+		if _, err := s.clientService.Get(ctx, hint.Audience[0]); err != nil {
+			if errors.Is(err, apperror.ErrClientNotFound) {
+				return "", false, fmt.Errorf("%w: id_token_hint was not issued to a registered client", apperror.ErrInvalidRequest)
+			}
+			return "", false, err
+		}
+
+		if sessionUserID != uuid.Nil && hint.Subject != sessionUserID.String() {
+			return "", false, fmt.Errorf("%w: id_token_hint belongs to another user", apperror.ErrInvalidRequest)
+		}
+		hinted = sessionUserID != uuid.Nil
+
+		if clientID == "" {
+			clientID = hint.Audience[0]
+		}
+		if !slices.Contains(hint.Audience, clientID) {
+			return "", false, fmt.Errorf("%w: id_token_hint was issued to another client", apperror.ErrInvalidRequest)
+		}
+	}
+
+	if req.PostLogoutRedirectURI == "" {
+		return "", hinted, nil
+	}
+
+	if clientID == "" {
+		return "", false, fmt.Errorf("%w: post_logout_redirect_uri requires client_id or id_token_hint", apperror.ErrInvalidRequest)
+	}
+
+	client, err := s.clientService.Get(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrClientNotFound) {
+			return "", false, fmt.Errorf("%w: %w", apperror.ErrInvalidRequest, err)
+		}
+		return "", false, err
+	}
+
+	if !client.HasPostLogoutRedirectURI(req.PostLogoutRedirectURI) {
+		return "", false, fmt.Errorf("%w: post_logout_redirect_uri is not registered", apperror.ErrInvalidRequest)
+	}
+
+	u, err := url.Parse(req.PostLogoutRedirectURI)
+	if err != nil {
+		return "", false, fmt.Errorf("%w: invalid post_logout_redirect_uri", apperror.ErrInvalidRequest)
+	}
+	if req.State != "" {
+		query := u.Query()
+		query.Set("state", req.State)
+		u.RawQuery = query.Encode()
+	}
+
+	return u.String(), hinted, nil
+}
+
+// Run delivers queued back-channel logout notifications until ctx is done.
+func (s *LogoutService) Run(ctx context.Context) {
+	ticker := time.NewTicker(logoutPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.deliverDue(ctx); err != nil {
+				log.Println("Back-channel logout delivery error", "error", err.Error())
+			}
+		}
+	}
+}
+
+func (s *LogoutService) deliverDue(ctx context.Context) error {
+	notifications, err := s.logoutRepo.ClaimDue(ctx, logoutBatchSize, logoutLease)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range notifications {
+		deliveryErr := s.deliver(ctx, &n)
+		if deliveryErr == nil {
+			if err := s.logoutRepo.Delete(ctx, n.ID); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if n.Attempts+1 >= logoutMaxAttempts {
+			log.Println("Back-channel logout dropped", "client", n.ClientID, "error", deliveryErr.Error())
+			if err := s.logoutRepo.Delete(ctx, n.ID); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := s.logoutRepo.Retry(ctx, n.ID, time.Now().Add(logoutBackoff(n.Attempts)), deliveryErr.Error()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deliver posts the logout token, OpenID Connect Back-Channel Logout 1.0
+// section 2.5. Deleted clients or clients without a logout URI succeed.
+func (s *LogoutService) deliver(ctx context.Context, n *model.LogoutNotification) error {
+	client, err := s.clientService.Get(ctx, n.ClientID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrClientNotFound) {
+			return nil
+		}
+		return err
+	}
+	if client.BackchannelLogoutURI == "" {
+		return nil
+	}
+
+	logoutToken, err := s.jwtProvider.GenerateLogoutToken(n.UserID, client.ID)
+	if err != nil {
+		return fmt.Errorf("%w: logout token", apperror.ErrGeneratingError)
+	}
+
+	form := url.Values{"logout_token": {logoutToken}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, client.BackchannelLogoutURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func logoutBackoff(attempts int) time.Duration {
+	backoff := logoutRetryBase << attempts
+	if backoff <= 0 || backoff > logoutRetryMax {
+		return logoutRetryMax
+	}
+	return backoff
+}
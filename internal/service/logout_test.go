@@ -0,0 +1,231 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/config"
+	"github.com/kkonst40/isso/internal/model"
+	"github.com/kkonst40/isso/internal/repo"
+	"github.com/kkonst40/isso/internal/utils"
+)
+
+// recordingDB is a database/sql driver that records the statements run
+// against it. Queries get the row registered for the first matching
+// fragment, or no rows.
+type recordingDB struct {
+	mu         sync.Mutex
+	statements []string
+	rows       map[string][]driver.Value
+}
+
+func newRecordingDB(t *testing.T, rows map[string][]driver.Value) (*sql.DB, *recordingDB) {
+	rec := &recordingDB{rows: rows}
+	db := sql.OpenDB(rec)
+	t.Cleanup(func() { db.Close() })
+
+	return db, rec
+}
+
+func (d *recordingDB) Connect(context.Context) (driver.Conn, error) { return recordingConn{d}, nil }
+func (d *recordingDB) Driver() driver.Driver                        { return nil }
+
+func (d *recordingDB) record(query string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.statements = append(d.statements, strings.Join(strings.Fields(query), " "))
+}
+
+// index returns the position of the first statement starting with prefix.
+func (d *recordingDB) index(prefix string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return slices.IndexFunc(d.statements, func(statement string) bool {
+		return strings.HasPrefix(statement, prefix)
+	})
+}
+
+type recordingConn struct{ db *recordingDB }
+
+func (c recordingConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c recordingConn) Close() error                        { return nil }
+func (c recordingConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+// CheckNamedValue passes every argument through, nothing is stored.
+func (c recordingConn) CheckNamedValue(*driver.NamedValue) error { return nil }
+
+func (c recordingConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	c.db.record(query)
+	return driver.RowsAffected(1), nil
+}
+
+func (c recordingConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	c.db.record(query)
+	for fragment, row := range c.db.rows {
+		if strings.Contains(query, fragment) {
+			return &recordingRows{row: row}, nil
+		}
+	}
+	return &recordingRows{}, nil
+}
+
+type recordingRows struct {
+	row  []driver.Value
+	done bool
+}
+
+func (r *recordingRows) Columns() []string { return make([]string, len(r.row)) }
+func (r *recordingRows) Close() error      { return nil }
+
+func (r *recordingRows) Next(dest []driver.Value) error {
+	if r.row == nil || r.done {
+		return io.EOF
+	}
+	r.done = true
+	copy(dest, r.row)
+	return nil
+}
+
+type logoutTest struct {
+	sqlDB         *sql.DB
+	db            *recordingDB
+	user          *model.User
+	cfg           *config.Config
+	userRepo      *repo.UserRepo
+	pwdHandler    *utils.PasswordHandler
+	credValidator *utils.CredValidator
+	tokenService  *TokenService
+	logoutService *LogoutService
+}
+
+func newLogoutTest(t *testing.T) *logoutTest {
+	t.Helper()
+
+	user := &model.User{ID: uuid.New(), Login: "alice", TokenID: uuid.New()}
+	db, rec := newRecordingDB(t, map[string][]driver.Value{
+		"FROM users WHERE id": {user.ID.String(), user.Login, "", user.TokenID.String(), "alice@example.com", true},
+	})
+
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			SecretKey:           "test-secret-test-secret-test-secret",
+			Issuer:              "https://id.example.com",
+			Audience:            "isso",
+			AccessExpireMinutes: 5,
+			ExpireDays:          1,
+		},
+		Cred: config.CredConfig{
+			PwdChars:     "abcdefghijklmnopqrstuvwxyz0123456789",
+			MinPwdLength: 8,
+			MaxPwdLength: 64,
+		},
+	}
+	jwtProvider, err := utils.NewJWTProvider(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pwdHandler, err := utils.NewPasswordHandler(config.PasswordConfig{Algorithm: "bcrypt", BcryptCost: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userRepo := repo.New(db)
+	tokenService := NewTokenService(
+		jwtProvider,
+		userRepo,
+		repo.NewRefreshTokenRepo(db),
+		utils.NewTokenIDCache(time.Minute),
+		utils.NewFamilyCache(time.Minute),
+	)
+
+	return &logoutTest{
+		sqlDB:         db,
+		db:            rec,
+		user:          user,
+		cfg:           cfg,
+		userRepo:      userRepo,
+		pwdHandler:    pwdHandler,
+		credValidator: utils.NewValidator(cfg),
+		tokenService:  tokenService,
+		logoutService: NewLogoutService(jwtProvider, tokenService, nil, userRepo, repo.NewLogoutNotificationRepo(db)),
+	}
+}
+
+// checkLoggedOut makes sure clients were queued for a back-channel
+// notification while they still held a session, before the TokenID
+// changed and refresh tokens were revoked.
+func (l *logoutTest) checkLoggedOut(t *testing.T, setTokenID string) {
+	t.Helper()
+
+	enqueued := l.db.index("INSERT INTO logout_notifications")
+	rotated := l.db.index(setTokenID)
+	revoked := l.db.index("UPDATE refresh_tokens SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL")
+
+	if enqueued < 0 || rotated < 0 || revoked < 0 {
+		t.Fatalf("enqueued %d, rotated %d, revoked %d in %q", enqueued, rotated, revoked, l.db.statements)
+	}
+	if enqueued > rotated || rotated > revoked {
+		t.Fatalf("out of order: %q", l.db.statements)
+	}
+}
+
+func TestLogoutNotifiesClients(t *testing.T) {
+	l := newLogoutTest(t)
+
+	if err := l.logoutService.Logout(context.Background(), l.user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	l.checkLoggedOut(t, "UPDATE users SET token_id")
+}
+
+func TestUpdatePasswordNotifiesClients(t *testing.T) {
+	l := newLogoutTest(t)
+	userService := New(l.tokenService, l.logoutService, nil, nil, nil, l.pwdHandler, l.credValidator, l.userRepo, uuid.Nil)
+
+	tokens, err := userService.UpdatePassword(context.Background(), l.user.ID, "newpassword1", model.Authentication{Time: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l.checkLoggedOut(t, "UPDATE users SET password_hash")
+
+	// the requester keeps a session, under the new TokenID
+	claims, err := l.tokenService.jwtProvider.ValidateToken(tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.TokenID == l.user.TokenID {
+		t.Fatal("the new session has the old TokenID")
+	}
+}
+
+func TestPasswordResetNotifiesClients(t *testing.T) {
+	l := newLogoutTest(t)
+	l.db.rows["DELETE FROM password_resets"] = []driver.Value{"hash", l.user.ID.String(), time.Now(), time.Now().Add(passwordResetTTL)}
+
+	resetService := NewPasswordResetService(
+		l.logoutService,
+		utils.NewMemoryMailer(),
+		l.pwdHandler,
+		l.credValidator,
+		repo.NewPasswordResetRepo(l.sqlDB),
+		l.userRepo,
+		l.cfg,
+	)
+
+	if err := resetService.Reset(context.Background(), "token", "newpassword1"); err != nil {
+		t.Fatal(err)
+	}
+
+	l.checkLoggedOut(t, "UPDATE users SET password_hash")
+}
@@ -0,0 +1,271 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/model"
+	"github.com/kkonst40/isso/internal/repo"
+	"github.com/kkonst40/isso/internal/utils"
+)
+
+// Authentication method references, RFC 8176.
+const (
+	AMRPassword    = "pwd"
+	AMROTP         = "otp"
+	AMRHardwareKey = "hwk"
+	AMRMultiFactor = "mfa"
+	// a link or code mailed to the user, not registered in RFC 8176
+	AMREmail = "email"
+)
+
+const (
+	MFAMethodTOTP = "totp"
+
+	totpIssuer = "isso"
+	// a guessing attacker gets mfaMaxAttempts codes per mfaLockout
+	mfaMaxAttempts = 5
+	mfaLockout     = 15 * time.Minute
+)
+
+type MFAService struct {
+	jwtProvider  *utils.JWTProvider
+	totpRepo     *repo.TOTPRepo
+	passkeyRepo  *repo.WebAuthnCredentialRepo
+	recoveryRepo *repo.RecoveryCodeRepo
+	lockoutRepo  *repo.MFALockoutRepo
+	userRepo     *repo.UserRepo
+	// nil when no encryption key is configured, TOTP is unavailable then
+	secretBox *utils.SecretBox
+}
+
+func NewMFAService(
+	jwtProvider *utils.JWTProvider,
+	totpRepo *repo.TOTPRepo,
+	passkeyRepo *repo.WebAuthnCredentialRepo,
+	recoveryRepo *repo.RecoveryCodeRepo,
+	lockoutRepo *repo.MFALockoutRepo,
+	userRepo *repo.UserRepo,
+	secretBox *utils.SecretBox,
+) *MFAService {
+	return &MFAService{
+		jwtProvider:  jwtProvider,
+		totpRepo:     totpRepo,
+		passkeyRepo:  passkeyRepo,
+		recoveryRepo: recoveryRepo,
+		lockoutRepo:  lockoutRepo,
+		userRepo:     userRepo,
+		secretBox:    secretBox,
+	}
+}
+
+// Methods lists the second factors the user has enabled, recovery codes
+// only count next to a real one.
+func (s *MFAService) Methods(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	methods := []string{}
+
+	totp, err := s.totpRepo.Get(ctx, userID)
+	if err != nil && !errors.Is(err, apperror.ErrTOTPNotFound) {
+		return nil, err
+	}
+	if err == nil && totp.Confirmed() {
+		methods = append(methods, MFAMethodTOTP)
+	}
+
+	hasPasskeys, err := s.passkeyRepo.Exists(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if hasPasskeys {
+		methods = append(methods, MFAMethodWebAuthn)
+	}
+
+	if len(methods) > 0 {
+		remaining, err := s.recoveryRepo.CountUnused(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if remaining > 0 {
+			methods = append(methods, MFAMethodRecoveryCode)
+		}
+	}
+
+	return methods, nil
+}
+
+// Challenge returns the token a login continues with after the first
+// factor, amr lists the methods the user passed so far.
+func (s *MFAService) Challenge(userID uuid.UUID, amr []string) (string, error) {
+	token, err := s.jwtProvider.GenerateMFAToken(userID, amr)
+	if err != nil {
+		return "", fmt.Errorf("%w: mfa token", apperror.ErrGeneratingError)
+	}
+
+	return token, nil
+}
+
+// EnrollTOTP generates a new secret, it only replaces an unconfirmed one.
+func (s *MFAService) EnrollTOTP(ctx context.Context, userID uuid.UUID) (*model.TOTPEnrollment, error) {
+	if s.secretBox == nil {
+		return nil, apperror.ErrMFAUnavailable
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, fmt.Errorf("%w: totp secret", apperror.ErrGeneratingError)
+	}
+
+	sealed, err := s.secretBox.Seal(secret, userID[:])
+	if err != nil {
+		return nil, fmt.Errorf("%w: totp secret encryption", apperror.ErrGeneratingError)
+	}
+
+	stored, err := s.totpRepo.SetPending(ctx, userID, sealed)
+	if err != nil {
+		return nil, err
+	}
+	if !stored {
+		return nil, apperror.ErrTOTPEnabled
+	}
+
+	return &model.TOTPEnrollment{
+		Secret: utils.EncodeTOTPSecret(secret),
+		URI:    utils.TOTPURI(totpIssuer, user.Login, secret),
+	}, nil
+}
+
+// ConfirmTOTP enables TOTP once the user proves the app has the secret. It
+// returns new recovery codes when the user has none.
+func (s *MFAService) ConfirmTOTP(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	totp, err := s.totpRepo.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if totp.Confirmed() {
+		return nil, apperror.ErrTOTPEnabled
+	}
+
+	if err := s.verifyTOTP(ctx, totp, code, true); err != nil {
+		return nil, err
+	}
+
+	return s.ensureRecoveryCodes(ctx, userID)
+}
+
+func (s *MFAService) DisableTOTP(ctx context.Context, userID uuid.UUID, code string) error {
+	totp, err := s.totpRepo.Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !totp.Confirmed() {
+		return apperror.ErrTOTPNotFound
+	}
+
+	if err := s.verifyTOTP(ctx, totp, code, false); err != nil {
+		return err
+	}
+
+	if err := s.totpRepo.Delete(ctx, userID); err != nil {
+		return err
+	}
+
+	return s.forgetRecoveryCodes(ctx, userID)
+}
+
+// VerifyTOTPLogin checks the second step of a login and returns the user
+// with the methods used.
+func (s *MFAService) VerifyTOTPLogin(ctx context.Context, mfaToken, code string) (uuid.UUID, []string, error) {
+	userID, amr, err := s.parseChallenge(mfaToken)
+	if err != nil {
+		return uuid.UUID{}, nil, err
+	}
+
+	totp, err := s.totpRepo.Get(ctx, userID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrTOTPNotFound) {
+			return uuid.UUID{}, nil, fmt.Errorf("%w: %w", apperror.ErrInvalidMFACode, err)
+		}
+		return uuid.UUID{}, nil, err
+	}
+
+	if !totp.Confirmed() {
+		return uuid.UUID{}, nil, fmt.Errorf("%w: totp is not confirmed", apperror.ErrInvalidMFACode)
+	}
+
+	if err := s.verifyTOTP(ctx, totp, code, false); err != nil {
+		return uuid.UUID{}, nil, err
+	}
+
+	return userID, append(amr, AMROTP), nil
+}
+
+func (s *MFAService) parseChallenge(mfaToken string) (uuid.UUID, []string, error) {
+	claims, err := s.jwtProvider.ParseMFAToken(mfaToken)
+	if err != nil {
+		return uuid.UUID{}, nil, fmt.Errorf("%w: %w", apperror.ErrInvalidToken, err)
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.UUID{}, nil, fmt.Errorf("%w: invalid subject", apperror.ErrInvalidToken)
+	}
+
+	return userID, claims.AMR, nil
+}
+
+func (s *MFAService) verifyTOTP(ctx context.Context, totp *model.TOTP, code string, confirm bool) error {
+	if s.secretBox == nil {
+		return apperror.ErrMFAUnavailable
+	}
+
+	now := time.Now()
+	if err := s.checkLockout(ctx, totp.UserID, now); err != nil {
+		return err
+	}
+
+	secret, err := s.secretBox.Open(totp.SecretEncrypted, totp.UserID[:])
+	if err != nil {
+		return fmt.Errorf("%w: can't decrypt totp secret", apperror.ErrMFAUnavailable)
+	}
+
+	step, ok := utils.ValidateTOTP(secret, code, now)
+	if !ok {
+		if err := s.lockoutRepo.Fail(ctx, totp.UserID, mfaMaxAttempts, now.Add(mfaLockout)); err != nil {
+			return err
+		}
+		return apperror.ErrInvalidMFACode
+	}
+
+	used, err := s.totpRepo.UseStep(ctx, totp.UserID, step, confirm)
+	if err != nil {
+		return err
+	}
+	if !used {
+		return fmt.Errorf("%w: code already used", apperror.ErrInvalidMFACode)
+	}
+
+	return s.lockoutRepo.Reset(ctx, totp.UserID)
+}
+
+func (s *MFAService) checkLockout(ctx context.Context, userID uuid.UUID, now time.Time) error {
+	lockedUntil, err := s.lockoutRepo.LockedUntil(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if lockedUntil != nil && now.Before(*lockedUntil) {
+		return apperror.ErrMFALocked
+	}
+
+	return nil
+}
@@ -0,0 +1,341 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/model"
+	"github.com/kkonst40/isso/internal/repo"
+	"github.com/kkonst40/isso/internal/utils"
+)
+
+const authCodeTTL = time.Minute
+
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeRefreshToken      = "refresh_token"
+	GrantTypeClientCredentials = "client_credentials"
+)
+
+// prompt values, OpenID Connect Core section 3.1.2.1
+const (
+	PromptNone    = "none"
+	PromptLogin   = "login"
+	PromptConsent = "consent"
+)
+
+var SupportedGrantTypes = []string{
+	GrantTypeAuthorizationCode,
+	GrantTypeRefreshToken,
+	GrantTypeClientCredentials,
+	GrantTypeDeviceCode,
+	GrantTypeTokenExchange,
+}
+
+type OIDCService struct {
+	jwtProvider       *utils.JWTProvider
+	tokenService      *TokenService
+	clientService     *ClientService
+	userRepo          *repo.UserRepo
+	authCodeRepo      *repo.AuthorizationCodeRepo
+	deviceCodeRepo    *repo.DeviceCodeRepo
+	pushedRequestRepo *repo.PushedAuthorizationRequestRepo
+}
+
+func NewOIDCService(
+	jwtProvider *utils.JWTProvider,
+	tokenService *TokenService,
+	clientService *ClientService,
+	userRepo *repo.UserRepo,
+	authCodeRepo *repo.AuthorizationCodeRepo,
+	deviceCodeRepo *repo.DeviceCodeRepo,
+	pushedRequestRepo *repo.PushedAuthorizationRequestRepo,
+) *OIDCService {
+	return &OIDCService{
+		jwtProvider:       jwtProvider,
+		tokenService:      tokenService,
+		clientService:     clientService,
+		userRepo:          userRepo,
+		authCodeRepo:      authCodeRepo,
+		deviceCodeRepo:    deviceCodeRepo,
+		pushedRequestRepo: pushedRequestRepo,
+	}
+}
+
+// ValidateAuthorizationRequest checks the client and redirect_uri first.
+// While they are not trusted the returned request is nil and the error must
+// be shown to the user, afterwards errors are sent back to the redirect_uri.
+func (s *OIDCService) ValidateAuthorizationRequest(
+	ctx context.Context,
+	req *model.AuthorizationRequest,
+) (*model.AuthorizationRequest, error) {
+	client, err := s.clientService.Get(ctx, req.ClientID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.RedirectURI == "" && len(client.RedirectURIs) == 1 {
+		req.RedirectURI = client.RedirectURIs[0]
+	}
+	if !client.HasRedirectURI(req.RedirectURI) {
+		return nil, fmt.Errorf("%w: redirect_uri is not registered", apperror.ErrInvalidRequest)
+	}
+
+	if !client.AllowsGrant(GrantTypeAuthorizationCode) {
+		return req, fmt.Errorf("%w: authorization code grant is not allowed", apperror.ErrUnauthorizedClient)
+	}
+
+	if req.ResponseType != "code" {
+		return req, fmt.Errorf("%w: only response_type=code is supported", apperror.ErrUnsupportedResponseType)
+	}
+
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != utils.PKCEMethodS256 {
+		return req, fmt.Errorf("%w: PKCE with S256 is required", apperror.ErrInvalidRequest)
+	}
+
+	if err := checkPrompt(req.Prompt); err != nil {
+		return req, err
+	}
+
+	if !utils.HasScope(req.Scope, utils.ScopeOpenID) {
+		return req, fmt.Errorf("%w: openid scope is required", apperror.ErrInvalidScope)
+	}
+
+	if !utils.ScopeSubset(req.Scope, utils.UserScopes) {
+		return req, fmt.Errorf("%w: unknown scope", apperror.ErrInvalidScope)
+	}
+
+	return req, nil
+}
+
+func parsePrompt(prompt string) map[string]bool {
+	values := map[string]bool{}
+	for _, value := range strings.Fields(prompt) {
+		values[value] = true
+	}
+
+	return values
+}
+
+// checkPrompt rejects prompt=none together with other values, OpenID
+// Connect Core section 3.1.2.1.
+func checkPrompt(prompt map[string]bool) error {
+	if prompt[PromptNone] && len(prompt) > 1 {
+		return fmt.Errorf("%w: prompt=none can't be combined with other values", apperror.ErrInvalidRequest)
+	}
+
+	return nil
+}
+
+// Authorize issues a single-use authorization code for the logged in user,
+// auth is how the user's session was authenticated.
+func (s *OIDCService) Authorize(
+	ctx context.Context,
+	req *model.AuthorizationRequest,
+	userID uuid.UUID,
+	auth model.Authentication,
+) (string, error) {
+	if req.RequestURI != "" {
+		if err := s.consumePushedRequest(ctx, req.RequestURI); err != nil {
+			return "", err
+		}
+	}
+
+	code, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", fmt.Errorf("%w: authorization code", apperror.ErrGeneratingError)
+	}
+
+	now := time.Now()
+	authCode := &model.AuthorizationCode{
+		CodeHash:            utils.HashToken(code),
+		ClientID:            req.ClientID,
+		UserID:              userID,
+		RedirectURI:         req.RedirectURI,
+		Scope:               req.Scope,
+		Nonce:               req.Nonce,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		CreatedAt:           now,
+		ExpiresAt:           now.Add(authCodeTTL),
+		Auth:                auth,
+	}
+
+	if err := s.authCodeRepo.Create(ctx, authCode); err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+func (s *OIDCService) Token(ctx context.Context, req *model.TokenRequest) (*model.OAuthTokens, error) {
+	if !slices.Contains(SupportedGrantTypes, req.GrantType) {
+		return nil, fmt.Errorf("%w: %s", apperror.ErrUnsupportedGrantType, req.GrantType)
+	}
+
+	client, err := s.clientService.Authenticate(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if !client.AllowsGrant(req.GrantType) {
+		return nil, fmt.Errorf("%w: grant type %q is not allowed", apperror.ErrUnauthorizedClient, req.GrantType)
+	}
+
+	switch req.GrantType {
+	case GrantTypeAuthorizationCode:
+		return s.exchangeCode(ctx, client, req)
+	case GrantTypeRefreshToken:
+		tokens, err := s.tokenService.Refresh(ctx, req.RefreshToken, client)
+		if err != nil {
+			return nil, err
+		}
+		return &model.OAuthTokens{TokenPair: *tokens}, nil
+	case GrantTypeClientCredentials:
+		return s.clientCredentials(ctx, client, req)
+	case GrantTypeDeviceCode:
+		return s.exchangeDeviceCode(ctx, client, req)
+	case GrantTypeTokenExchange:
+		return s.exchangeToken(ctx, client, req)
+	default:
+		return nil, fmt.Errorf("%w: %s", apperror.ErrUnsupportedGrantType, req.GrantType)
+	}
+}
+
+// clientCredentials grants the requested scopes the client is registered
+// for, or all of them when no scope is requested.
+func (s *OIDCService) clientCredentials(ctx context.Context, client *model.Client, req *model.TokenRequest) (*model.OAuthTokens, error) {
+	if client.Public {
+		return nil, fmt.Errorf("%w: public clients can't use client_credentials", apperror.ErrUnauthorizedClient)
+	}
+
+	scope := req.Scope
+	if scope == "" {
+		scope = strings.Join(client.Scopes, " ")
+	}
+	if !utils.ScopeSubset(scope, client.Scopes) {
+		return nil, fmt.Errorf("%w: scope is not allowed for the client", apperror.ErrInvalidScope)
+	}
+
+	tokens, err := s.tokenService.IssueClientToken(client, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.OAuthTokens{TokenPair: *tokens}, nil
+}
+
+func (s *OIDCService) exchangeCode(ctx context.Context, client *model.Client, req *model.TokenRequest) (*model.OAuthTokens, error) {
+	code, err := s.authCodeRepo.GetByHash(ctx, utils.HashToken(req.Code))
+	if err != nil {
+		return nil, err
+	}
+
+	if code.ClientID != client.ID {
+		return nil, fmt.Errorf("%w: code was issued to another client", apperror.ErrInvalidGrant)
+	}
+
+	marked, err := s.authCodeRepo.MarkUsed(ctx, code.CodeHash)
+	if err != nil {
+		return nil, err
+	}
+	if !marked {
+		// RFC 6749 section 4.1.2: revoke tokens issued with a reused code
+		if code.RefreshFamilyID != nil {
+			if err := s.tokenService.RevokeFamily(ctx, *code.RefreshFamilyID); err != nil {
+				return nil, err
+			}
+		}
+		return nil, fmt.Errorf("%w: code already used", apperror.ErrInvalidGrant)
+	}
+
+	if time.Now().After(code.ExpiresAt) {
+		return nil, fmt.Errorf("%w: code expired", apperror.ErrInvalidGrant)
+	}
+
+	if code.RedirectURI != req.RedirectURI {
+		return nil, fmt.Errorf("%w: redirect_uri mismatch", apperror.ErrInvalidGrant)
+	}
+
+	if !utils.VerifyPKCE(req.CodeVerifier, code.CodeChallenge) {
+		return nil, fmt.Errorf("%w: code_verifier mismatch", apperror.ErrInvalidGrant)
+	}
+
+	user, err := s.userRepo.GetByID(ctx, code.UserID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrUserNotFound) {
+			return nil, fmt.Errorf("%w: %w", apperror.ErrInvalidGrant, err)
+		}
+		return nil, err
+	}
+
+	tokens, err := s.tokenService.IssueForClient(ctx, user, client, code.Scope, code.Auth)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.authCodeRepo.SetRefreshFamily(ctx, code.CodeHash, tokens.FamilyID); err != nil {
+		return nil, err
+	}
+
+	// refresh tokens outlive the session, the user has to allow that
+	if !utils.HasScope(code.Scope, utils.ScopeOfflineAccess) {
+		tokens.RefreshToken = ""
+	}
+
+	idToken, err := s.jwtProvider.GenerateIDToken(user, client.ID, code.Scope, code.Nonce, tokens.AccessToken, code.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("%w: id token", apperror.ErrGeneratingError)
+	}
+
+	return &model.OAuthTokens{
+		TokenPair: *tokens,
+		IDToken:   idToken,
+	}, nil
+}
+
+// Introspect is only available to confidential clients, resource servers
+// are expected to be registered as such.
+func (s *OIDCService) Introspect(ctx context.Context, clientID, clientSecret, token, tokenTypeHint string) (*model.TokenInfo, error) {
+	client, err := s.clientService.Authenticate(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if client.Public {
+		return nil, fmt.Errorf("%w: public clients can't introspect tokens", apperror.ErrUnauthorizedClient)
+	}
+
+	return s.tokenService.Introspect(ctx, token, tokenTypeHint)
+}
+
+func (s *OIDCService) Revoke(ctx context.Context, clientID, clientSecret, token, tokenTypeHint string) error {
+	client, err := s.clientService.Authenticate(ctx, clientID, clientSecret)
+	if err != nil {
+		return err
+	}
+
+	return s.tokenService.Revoke(ctx, token, tokenTypeHint, client.ID)
+}
+
+func (s *OIDCService) UserInfo(ctx context.Context, userID uuid.UUID) (*model.User, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrUserNotFound) {
+			return nil, fmt.Errorf("%w: %w", apperror.ErrInvalidToken, err)
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *OIDCService) SigningAlgorithms() []string {
+	return s.jwtProvider.Algorithms()
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/model"
+)
+
+func TestPrompt(t *testing.T) {
+	tests := []struct {
+		prompt string
+		want   []string
+		ok     bool
+	}{
+		{prompt: "", ok: true},
+		{prompt: "none", want: []string{PromptNone}, ok: true},
+		{prompt: "login consent", want: []string{PromptLogin, PromptConsent}, ok: true},
+		{prompt: " consent  login ", want: []string{PromptLogin, PromptConsent}, ok: true},
+		{prompt: "none none", want: []string{PromptNone}, ok: true},
+		{prompt: "none login", want: []string{PromptNone, PromptLogin}},
+		{prompt: "consent none", want: []string{PromptNone, PromptConsent}},
+		{prompt: "none select_account", want: []string{PromptNone, "select_account"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prompt, func(t *testing.T) {
+			req := NewAuthorizationRequest(url.Values{"prompt": {tt.prompt}})
+			if len(req.Prompt) != len(tt.want) {
+				t.Fatalf("got %v, want %v", req.Prompt, tt.want)
+			}
+			for _, value := range tt.want {
+				if !req.Prompt[value] {
+					t.Fatalf("got %v, want %v", req.Prompt, tt.want)
+				}
+			}
+
+			err := checkPrompt(req.Prompt)
+			if tt.ok && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.ok && !errors.Is(err, apperror.ErrInvalidRequest) {
+				t.Fatalf("err = %v, want %v", err, apperror.ErrInvalidRequest)
+			}
+		})
+	}
+}
+
+func TestNeedsReauthentication(t *testing.T) {
+	s := newExchangeTest(t).service
+	earlier := model.Authentication{Time: time.Now().Add(-time.Hour), ACR: ACRPassword}
+	justNow := model.Authentication{Time: time.Now(), ACR: ACRPassword}
+
+	tests := []struct {
+		name   string
+		params url.Values
+		auth   model.Authentication
+		want   bool
+	}{
+		{name: "no prompt", params: url.Values{}, auth: earlier},
+		{name: "prompt=login", params: url.Values{"prompt": {"login"}}, auth: earlier, want: true},
+		{name: "prompt=login among others", params: url.Values{"prompt": {"consent login"}}, auth: earlier, want: true},
+		// the client asks for a new login however young the session is
+		{name: "prompt=login with a young session", params: url.Values{"prompt": {"login"}}, auth: justNow, want: true},
+		{name: "stronger acr", params: url.Values{"acr_values": {ACRMultiFactor}}, auth: earlier, want: true},
+		{name: "stronger acr after a login", params: url.Values{"acr_values": {ACRMultiFactor}}, auth: justNow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.NeedsReauthentication(NewAuthorizationRequest(tt.params), tt.auth, ""); got != tt.want {
+				t.Fatalf("NeedsReauthentication = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// The user comes back from the login page with the login request token,
+// only a login after it satisfies prompt=login.
+func TestNeedsReauthenticationLoginRequest(t *testing.T) {
+	e := newExchangeTest(t)
+	req := NewAuthorizationRequest(url.Values{"prompt": {"login"}})
+
+	loginRequest, err := e.service.RequestLogin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := e.jwtProvider.GenerateLoginRequestToken(-time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		authTime     time.Time
+		loginRequest string
+		want         bool
+	}{
+		{name: "logged in after the request", authTime: time.Now().Add(time.Second), loginRequest: loginRequest},
+		{name: "session from before the request", authTime: time.Now().Add(-time.Minute), loginRequest: loginRequest, want: true},
+		{name: "expired request", authTime: time.Now(), loginRequest: expired, want: true},
+		{name: "forged request", authTime: time.Now(), loginRequest: "not-a-token", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := model.Authentication{Time: tt.authTime, ACR: ACRPassword}
+			if got := e.service.NeedsReauthentication(req, auth, tt.loginRequest); got != tt.want {
+				t.Fatalf("NeedsReauthentication = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
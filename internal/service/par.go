@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/model"
+	"github.com/kkonst40/isso/internal/utils"
+)
+
+const (
+	RequestURIPrefix = "urn:ietf:params:oauth:request_uri:"
+
+	// the request has to be used before the user logs in and consents, it is
+	// consumed once the code is issued
+	pushedRequestTTL = 90 * time.Second
+)
+
+// NewAuthorizationRequest reads the authorization request parameters.
+func NewAuthorizationRequest(params url.Values) *model.AuthorizationRequest {
+	return &model.AuthorizationRequest{
+		ClientID:            params.Get("client_id"),
+		RedirectURI:         params.Get("redirect_uri"),
+		ResponseType:        params.Get("response_type"),
+		Scope:               params.Get("scope"),
+		State:               params.Get("state"),
+		Nonce:               params.Get("nonce"),
+		CodeChallenge:       params.Get("code_challenge"),
+		CodeChallengeMethod: params.Get("code_challenge_method"),
+		Prompt:              parsePrompt(params.Get("prompt")),
+		ACRValues:           params.Get("acr_values"),
+		RequestURI:          params.Get("request_uri"),
+	}
+}
+
+// PushAuthorizationRequest validates and stores the request sent by the
+// client over the back channel, RFC 9126 section 2. It returns the
+// request_uri to start the authorization with.
+func (s *OIDCService) PushAuthorizationRequest(
+	ctx context.Context,
+	clientID, clientSecret string,
+	params url.Values,
+) (string, time.Duration, error) {
+	client, err := s.clientService.Authenticate(ctx, clientID, clientSecret)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if params.Has("request_uri") {
+		return "", 0, fmt.Errorf("%w: request_uri can't be pushed", apperror.ErrInvalidRequest)
+	}
+
+	if params.Has("request") {
+		params, err = s.requestObjectParams(client, params.Get("request"))
+		if err != nil {
+			return "", 0, err
+		}
+	} else {
+		params.Del("client_secret")
+	}
+
+	if params.Get("client_id") != client.ID {
+		return "", 0, fmt.Errorf("%w: client_id mismatch", apperror.ErrInvalidRequest)
+	}
+
+	if _, err := s.ValidateAuthorizationRequest(ctx, NewAuthorizationRequest(params)); err != nil {
+		return "", 0, err
+	}
+
+	token, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", 0, fmt.Errorf("%w: request_uri", apperror.ErrGeneratingError)
+	}
+
+	now := time.Now()
+	if err := s.pushedRequestRepo.Create(ctx, &model.PushedAuthorizationRequest{
+		RequestURIHash: utils.HashToken(token),
+		ClientID:       client.ID,
+		Params:         params.Encode(),
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(pushedRequestTTL),
+	}); err != nil {
+		return "", 0, err
+	}
+
+	return RequestURIPrefix + token, pushedRequestTTL, nil
+}
+
+// ResolveAuthorizationParams replaces a request_uri or a request object
+// with the parameters they carry. The result still has to be validated.
+func (s *OIDCService) ResolveAuthorizationParams(ctx context.Context, params url.Values) (url.Values, error) {
+	client, err := s.clientService.Get(ctx, params.Get("client_id"))
+	if err != nil {
+		return nil, err
+	}
+
+	if params.Has("request_uri") {
+		if params.Has("request") {
+			return nil, fmt.Errorf("%w: request and request_uri can't be used together", apperror.ErrInvalidRequest)
+		}
+		return s.pushedRequestParams(ctx, client, params.Get("request_uri"))
+	}
+
+	if client.RequirePAR {
+		return nil, fmt.Errorf("%w: the client must push authorization requests", apperror.ErrInvalidRequest)
+	}
+
+	if params.Has("request") {
+		return s.requestObjectParams(client, params.Get("request"))
+	}
+
+	return params, nil
+}
+
+func (s *OIDCService) pushedRequestParams(ctx context.Context, client *model.Client, requestURI string) (url.Values, error) {
+	token, ok := strings.CutPrefix(requestURI, RequestURIPrefix)
+	if !ok {
+		return nil, fmt.Errorf("%w: only pushed requests are supported", apperror.ErrInvalidRequestURI)
+	}
+
+	pushed, err := s.pushedRequestRepo.GetByHash(ctx, utils.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+
+	if pushed.ClientID != client.ID {
+		return nil, fmt.Errorf("%w: request_uri was issued to another client", apperror.ErrInvalidRequestURI)
+	}
+
+	if time.Now().After(pushed.ExpiresAt) {
+		return nil, fmt.Errorf("%w: request_uri expired", apperror.ErrInvalidRequestURI)
+	}
+
+	params, err := url.ParseQuery(pushed.Params)
+	if err != nil {
+		return nil, fmt.Errorf("%w: stored request is malformed", apperror.ErrInvalidRequestURI)
+	}
+	params.Set("request_uri", requestURI)
+
+	return params, nil
+}
+
+func (s *OIDCService) requestObjectParams(client *model.Client, requestObject string) (url.Values, error) {
+	if client.JWKS == "" {
+		return nil, fmt.Errorf("%w: the client has no registered keys", apperror.ErrInvalidRequestObject)
+	}
+
+	keys, err := utils.ParseJWKS(client.JWKS)
+	if err != nil {
+		return nil, fmt.Errorf("%w: registered keys are invalid", apperror.ErrInvalidRequestObject)
+	}
+
+	params, err := utils.ParseRequestObject(requestObject, client.ID, s.jwtProvider.Cfg.JWT.Issuer, keys)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", apperror.ErrInvalidRequestObject, err)
+	}
+
+	return params, nil
+}
+
+// consumePushedRequest makes the request_uri single-use.
+func (s *OIDCService) consumePushedRequest(ctx context.Context, requestURI string) error {
+	token, _ := strings.CutPrefix(requestURI, RequestURIPrefix)
+
+	deleted, err := s.pushedRequestRepo.Delete(ctx, utils.HashToken(token))
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return fmt.Errorf("%w: request_uri already used", apperror.ErrInvalidRequestURI)
+	}
+
+	return nil
+}
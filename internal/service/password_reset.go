@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/config"
+	"github.com/kkonst40/isso/internal/model"
+	"github.com/kkonst40/isso/internal/repo"
+	"github.com/kkonst40/isso/internal/utils"
+)
+
+const (
+	passwordResetTTL = time.Hour
+	// a new request within this time doesn't send another mail
+	passwordResetResendAfter = time.Minute
+	passwordResetPath        = "/password/reset"
+)
+
+type PasswordResetService struct {
+	logoutService *LogoutService
+	mailer        utils.Mailer
+	pwdHandler    *utils.PasswordHandler
+	credValidator *utils.CredValidator
+	resetRepo     *repo.PasswordResetRepo
+	userRepo      *repo.UserRepo
+	cfg           *config.Config
+}
+
+func NewPasswordResetService(
+	logoutService *LogoutService,
+	mailer utils.Mailer,
+	pwdHandler *utils.PasswordHandler,
+	credValidator *utils.CredValidator,
+	resetRepo *repo.PasswordResetRepo,
+	userRepo *repo.UserRepo,
+	cfg *config.Config,
+) *PasswordResetService {
+	return &PasswordResetService{
+		logoutService: logoutService,
+		mailer:        mailer,
+		pwdHandler:    pwdHandler,
+		credValidator: credValidator,
+		resetRepo:     resetRepo,
+		userRepo:      userRepo,
+		cfg:           cfg,
+	}
+}
+
+// Forgot mails a reset link to the user's verified email. Unknown logins
+// and users without a verified email get the same answer, so they can't be
+// told apart.
+func (s *PasswordResetService) Forgot(ctx context.Context, login string) error {
+	user, err := s.userRepo.GetByLogin(ctx, login)
+	if err != nil && !errors.Is(err, apperror.ErrUserNotFound) {
+		return err
+	}
+	if err != nil || user.Email == nil || !user.EmailVerified {
+		return nil
+	}
+
+	now := time.Now()
+
+	latest, err := s.resetRepo.Latest(ctx, user.ID)
+	if err != nil && !errors.Is(err, apperror.ErrInvalidResetToken) {
+		return err
+	}
+	if err == nil && now.Sub(latest.CreatedAt) < passwordResetResendAfter {
+		return nil
+	}
+
+	token, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return fmt.Errorf("%w: reset token", apperror.ErrGeneratingError)
+	}
+
+	if err := s.resetRepo.Replace(ctx, &model.PasswordReset{
+		TokenHash: utils.HashToken(token),
+		UserID:    user.ID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(passwordResetTTL),
+	}); err != nil {
+		return err
+	}
+
+	link := strings.TrimSuffix(s.cfg.JWT.Issuer, "/") + passwordResetPath + "?" + url.Values{"token": {token}}.Encode()
+
+	if err := s.mailer.Send(ctx, utils.Mail{
+		To:      *user.Email,
+		Subject: "Сброс пароля",
+		Body: fmt.Sprintf(
+			"Чтобы задать новый пароль для учётной записи %s, перейдите по ссылке:\n%s\n\n"+
+				"Ссылка действует %d минут. Если вы не запрашивали сброс пароля, просто проигнорируйте это письмо.\n",
+			user.Login, link, int(passwordResetTTL.Minutes()),
+		),
+	}); err != nil {
+		return fmt.Errorf("%w: %w", apperror.ErrSendingMail, err)
+	}
+
+	return nil
+}
+
+// Reset sets the new password and, like UpdatePassword, logs every session
+// of the user out and notifies clients over the back channel.
+func (s *PasswordResetService) Reset(ctx context.Context, token, newPwd string) error {
+	// checked first, so a rejected password doesn't use up the link
+	if !s.credValidator.ValidatePwd(newPwd) {
+		return apperror.ErrInvalidPwd
+	}
+
+	reset, err := s.resetRepo.Take(ctx, utils.HashToken(token))
+	if err != nil {
+		return err
+	}
+
+	if time.Now().After(reset.ExpiresAt) {
+		return fmt.Errorf("%w: link expired", apperror.ErrInvalidResetToken)
+	}
+
+	user, err := s.userRepo.GetByID(ctx, reset.UserID)
+	if err != nil {
+		return err
+	}
+
+	newPwdHash, err := s.pwdHandler.GeneratePwdHash(newPwd)
+	if err != nil {
+		return fmt.Errorf("%w: password hash", apperror.ErrGeneratingError)
+	}
+
+	if _, err := s.logoutService.EndSessions(ctx, user.ID, func(tokenID uuid.UUID) error {
+		return s.userRepo.UpdatePassword(ctx, user.ID, newPwdHash, tokenID)
+	}); err != nil {
+		return err
+	}
+
+	if user.Email != nil && user.EmailVerified {
+		if err := s.mailer.Send(ctx, utils.Mail{
+			To:      *user.Email,
+			Subject: "Пароль изменён",
+			Body: fmt.Sprintf(
+				"Пароль учётной записи %s был сброшен по ссылке из письма, все сеансы завершены.\n"+
+					"Если вы этого не делали, срочно смените пароль и проверьте доступ к почте.\n",
+				user.Login,
+			),
+		}); err != nil {
+			log.Println("Password reset notice error", "error", err.Error())
+		}
+	}
+
+	return nil
+}
+
+func (s *PasswordResetService) RunCleanup(ctx context.Context) {
+	ticker := time.NewTicker(cleanupEvery)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.resetRepo.DeleteExpired(ctx, time.Now()); err != nil {
+				log.Println("Password resets cleanup error", "error", err.Error())
+			}
+		}
+	}
+}
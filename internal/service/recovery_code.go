@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/model"
+	"github.com/kkonst40/isso/internal/utils"
+)
+
+const (
+	MFAMethodRecoveryCode = "recovery_code"
+
+	recoveryCodeCount = 10
+)
+
+func (s *MFAService) RecoveryCodesRemaining(ctx context.Context, userID uuid.UUID) (int, error) {
+	return s.recoveryRepo.CountUnused(ctx, userID)
+}
+
+// RegenerateRecoveryCodes replaces all codes of the user, the old ones stop
+// working.
+func (s *MFAService) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	methods, err := s.Methods(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(methods) == 0 {
+		return nil, apperror.ErrMFANotEnabled
+	}
+
+	return s.issueRecoveryCodes(ctx, userID)
+}
+
+// VerifyRecoveryCodeLogin finishes a login with a recovery code instead of
+// the second factor. Wrong codes count against the same lockout as TOTP.
+func (s *MFAService) VerifyRecoveryCodeLogin(ctx context.Context, mfaToken, code string) (uuid.UUID, []string, error) {
+	userID, amr, err := s.parseChallenge(mfaToken)
+	if err != nil {
+		return uuid.UUID{}, nil, err
+	}
+
+	now := time.Now()
+	if err := s.checkLockout(ctx, userID, now); err != nil {
+		return uuid.UUID{}, nil, err
+	}
+
+	used, err := s.useRecoveryCode(ctx, userID, utils.NormalizeRecoveryCode(code), now)
+	if err != nil {
+		return uuid.UUID{}, nil, err
+	}
+	if !used {
+		if err := s.lockoutRepo.Fail(ctx, userID, mfaMaxAttempts, now.Add(mfaLockout)); err != nil {
+			return uuid.UUID{}, nil, err
+		}
+		return uuid.UUID{}, nil, apperror.ErrInvalidMFACode
+	}
+
+	if err := s.lockoutRepo.Reset(ctx, userID); err != nil {
+		return uuid.UUID{}, nil, err
+	}
+
+	// a recovery code is a one-time password printed in advance
+	return userID, append(amr, AMROTP), nil
+}
+
+// useRecoveryCode looks the code up by its SHA-256 hash, the codes are
+// random enough that a slow password hash buys nothing.
+func (s *MFAService) useRecoveryCode(ctx context.Context, userID uuid.UUID, normalized string, now time.Time) (bool, error) {
+	if normalized == "" {
+		return false, nil
+	}
+
+	return s.recoveryRepo.Use(ctx, userID, utils.HashToken(normalized), now)
+}
+
+// ensureRecoveryCodes issues codes when a second factor is enrolled and the
+// user has none left, codes the user already saved stay valid.
+func (s *MFAService) ensureRecoveryCodes(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	remaining, err := s.recoveryRepo.CountUnused(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if remaining > 0 {
+		return nil, nil
+	}
+
+	return s.issueRecoveryCodes(ctx, userID)
+}
+
+// forgetRecoveryCodes deletes the codes once the last second factor is
+// gone, the next enrollment gets a fresh set.
+func (s *MFAService) forgetRecoveryCodes(ctx context.Context, userID uuid.UUID) error {
+	methods, err := s.Methods(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if len(methods) > 0 {
+		return nil
+	}
+
+	return s.recoveryRepo.DeleteByUser(ctx, userID)
+}
+
+func (s *MFAService) issueRecoveryCodes(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	now := time.Now()
+	plain := make([]string, 0, recoveryCodeCount)
+	codes := make([]model.RecoveryCode, 0, recoveryCodeCount)
+
+	for range recoveryCodeCount {
+		code, err := utils.GenerateRecoveryCode()
+		if err != nil {
+			return nil, fmt.Errorf("%w: recovery code", apperror.ErrGeneratingError)
+		}
+
+		plain = append(plain, code)
+		codes = append(codes, model.RecoveryCode{
+			ID:        uuid.New(),
+			UserID:    userID,
+			CodeHash:  utils.HashToken(utils.NormalizeRecoveryCode(code)),
+			CreatedAt: now,
+		})
+	}
+
+	if err := s.recoveryRepo.Replace(ctx, userID, codes); err != nil {
+		return nil, err
+	}
+
+	return plain, nil
+}
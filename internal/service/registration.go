@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/model"
+	"github.com/kkonst40/isso/internal/repo"
+	"github.com/kkonst40/isso/internal/utils"
+)
+
+// RegistrationService implements dynamic client registration, RFC 7591,
+// and the client configuration endpoint, RFC 7592.
+type RegistrationService struct {
+	clientService    *ClientService
+	clientRepo       *repo.ClientRepo
+	initialTokenRepo *repo.InitialAccessTokenRepo
+	adminID          uuid.UUID
+}
+
+func NewRegistrationService(
+	clientService *ClientService,
+	clientRepo *repo.ClientRepo,
+	initialTokenRepo *repo.InitialAccessTokenRepo,
+	adminID uuid.UUID,
+) *RegistrationService {
+	return &RegistrationService{
+		clientService:    clientService,
+		clientRepo:       clientRepo,
+		initialTokenRepo: initialTokenRepo,
+		adminID:          adminID,
+	}
+}
+
+// CreateInitialToken issues a token the platform can register clients with
+// until it expires.
+func (s *RegistrationService) CreateInitialToken(ctx context.Context, requesterID uuid.UUID, ttl time.Duration) (string, time.Time, error) {
+	if !isAdmin(s.adminID, requesterID) {
+		return "", time.Time{}, apperror.ErrNoPermission
+	}
+
+	if ttl <= 0 {
+		return "", time.Time{}, fmt.Errorf("%w: token lifetime must be positive", apperror.ErrInvalidRequest)
+	}
+
+	token, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("%w: initial access token", apperror.ErrGeneratingError)
+	}
+
+	expiresAt := time.Now().Add(ttl)
+	if err := s.initialTokenRepo.Create(ctx, utils.HashToken(token), expiresAt); err != nil {
+		return "", time.Time{}, err
+	}
+
+	return token, expiresAt, nil
+}
+
+// Register creates a client and returns its secret and registration access
+// token, both are only shown once.
+func (s *RegistrationService) Register(ctx context.Context, initialToken string, client *model.Client) (string, string, error) {
+	valid, err := s.initialTokenRepo.Valid(ctx, utils.HashToken(initialToken))
+	if err != nil {
+		return "", "", err
+	}
+	if !valid {
+		return "", "", fmt.Errorf("%w: invalid initial access token", apperror.ErrInvalidToken)
+	}
+
+	if err := validateRegistration(client); err != nil {
+		return "", "", err
+	}
+	if err := checkRegistrationPrivileges(client, nil); err != nil {
+		return "", "", err
+	}
+
+	registrationToken, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", "", fmt.Errorf("%w: registration access token", apperror.ErrGeneratingError)
+	}
+	client.RegistrationTokenHash = utils.HashToken(registrationToken)
+
+	secret, err := s.clientService.create(ctx, client)
+	if err != nil {
+		return "", "", metadataError(err)
+	}
+
+	return secret, registrationToken, nil
+}
+
+// Get returns a registered client, the registration access token
+// authenticates the request.
+func (s *RegistrationService) Get(ctx context.Context, clientID, registrationToken string) (*model.Client, error) {
+	client, err := s.clientRepo.GetByID(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrClientNotFound) {
+			// RFC 7592 section 2.1: don't reveal whether the client exists
+			return nil, fmt.Errorf("%w: %w", apperror.ErrInvalidToken, err)
+		}
+		return nil, err
+	}
+
+	tokenHash := utils.HashToken(registrationToken)
+	if client.RegistrationTokenHash == "" ||
+		subtle.ConstantTimeCompare([]byte(client.RegistrationTokenHash), []byte(tokenHash)) != 1 {
+		return nil, fmt.Errorf("%w: invalid registration access token", apperror.ErrInvalidToken)
+	}
+
+	return client, nil
+}
+
+// Update replaces the client metadata. The registration access token is
+// rotated and the new one returned, RFC 7592 section 2.2.
+func (s *RegistrationService) Update(ctx context.Context, clientID, registrationToken string, update *model.Client) (string, error) {
+	client, err := s.Get(ctx, clientID, registrationToken)
+	if err != nil {
+		return "", err
+	}
+
+	if update.Public != client.Public {
+		return "", fmt.Errorf("%w: token_endpoint_auth_method can't change", apperror.ErrInvalidClientMetadata)
+	}
+
+	if err := validateRegistration(update); err != nil {
+		return "", err
+	}
+	if err := checkRegistrationPrivileges(update, client); err != nil {
+		return "", err
+	}
+	if err := validateClient(update); err != nil {
+		return "", metadataError(err)
+	}
+
+	newToken, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", fmt.Errorf("%w: registration access token", apperror.ErrGeneratingError)
+	}
+
+	client.Name = update.Name
+	client.RedirectURIs = update.RedirectURIs
+	client.GrantTypes = update.GrantTypes
+	client.Scopes = update.Scopes
+	client.PostLogoutRedirectURIs = update.PostLogoutRedirectURIs
+	client.BackchannelLogoutURI = update.BackchannelLogoutURI
+	client.JWKS = update.JWKS
+	client.RequirePAR = update.RequirePAR
+	client.RegistrationTokenHash = utils.HashToken(newToken)
+
+	if err := s.clientRepo.Update(ctx, client); err != nil {
+		return "", err
+	}
+
+	*update = *client
+
+	return newToken, nil
+}
+
+func (s *RegistrationService) Delete(ctx context.Context, clientID, registrationToken string) error {
+	client, err := s.Get(ctx, clientID, registrationToken)
+	if err != nil {
+		return err
+	}
+
+	return s.clientRepo.Delete(ctx, client.ID)
+}
+
+// validateRegistration reports redirect URI problems with the RFC 7591
+// error code, the rest is checked by validateClient.
+func validateRegistration(client *model.Client) error {
+	if len(client.RedirectURIs) == 0 && (len(client.GrantTypes) == 0 || slices.Contains(client.GrantTypes, GrantTypeAuthorizationCode)) {
+		return fmt.Errorf("%w: redirect_uris are required", apperror.ErrInvalidRedirectURI)
+	}
+
+	for _, uri := range slices.Concat(client.RedirectURIs, client.PostLogoutRedirectURIs) {
+		if !validClientURI(uri) {
+			return fmt.Errorf("%w: %q", apperror.ErrInvalidRedirectURI, uri)
+		}
+	}
+
+	return nil
+}
+
+// privilegedGrants let a client get tokens without a user, only the admin
+// client API can allow them.
+var privilegedGrants = []string{GrantTypeClientCredentials, GrantTypeTokenExchange}
+
+// checkRegistrationPrivileges keeps dynamically registered clients to
+// user scopes and user grants. On update, stored is the current client and
+// what the admin already allowed on it may be kept.
+func checkRegistrationPrivileges(client, stored *model.Client) error {
+	for _, grantType := range client.GrantTypes {
+		if slices.Contains(privilegedGrants, grantType) && (stored == nil || !stored.AllowsGrant(grantType)) {
+			return fmt.Errorf("%w: grant type %q needs admin approval", apperror.ErrInvalidClientMetadata, grantType)
+		}
+	}
+
+	for _, scope := range client.Scopes {
+		if !slices.Contains(utils.UserScopes, scope) && (stored == nil || !slices.Contains(stored.Scopes, scope)) {
+			return fmt.Errorf("%w: scope %q needs admin approval", apperror.ErrInvalidClientMetadata, scope)
+		}
+	}
+
+	return nil
+}
+
+func metadataError(err error) error {
+	if errors.Is(err, apperror.ErrInvalidRequest) {
+		return fmt.Errorf("%w: %w", apperror.ErrInvalidClientMetadata, err)
+	}
+	return err
+}
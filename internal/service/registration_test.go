@@ -0,0 +1,74 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/model"
+)
+
+func TestCheckRegistrationPrivileges(t *testing.T) {
+	adminApproved := &model.Client{
+		GrantTypes: []string{GrantTypeClientCredentials, GrantTypeRefreshToken},
+		Scopes:     []string{"openid", "users:read"},
+	}
+
+	tests := []struct {
+		name   string
+		client *model.Client
+		stored *model.Client
+		ok     bool
+	}{
+		{
+			name:   "user grants and scopes",
+			client: &model.Client{GrantTypes: []string{GrantTypeAuthorizationCode, GrantTypeRefreshToken}, Scopes: []string{"openid", "profile", "email", "offline_access"}},
+			ok:     true,
+		},
+		{
+			name:   "client credentials on register",
+			client: &model.Client{GrantTypes: []string{GrantTypeClientCredentials}},
+		},
+		{
+			name:   "token exchange on register",
+			client: &model.Client{GrantTypes: []string{GrantTypeTokenExchange}},
+		},
+		{
+			name:   "api scope on register",
+			client: &model.Client{Scopes: []string{"openid", "users:read"}},
+		},
+		{
+			name:   "client credentials added on update",
+			client: &model.Client{GrantTypes: []string{GrantTypeClientCredentials}},
+			stored: &model.Client{GrantTypes: []string{GrantTypeAuthorizationCode}},
+		},
+		{
+			name:   "api scope added on update",
+			client: &model.Client{Scopes: []string{"users:read"}},
+			stored: &model.Client{Scopes: []string{"openid"}},
+		},
+		{
+			name:   "token exchange added next to approved grant",
+			client: &model.Client{GrantTypes: []string{GrantTypeClientCredentials, GrantTypeTokenExchange}},
+			stored: adminApproved,
+		},
+		{
+			name:   "update keeps what the admin approved",
+			client: &model.Client{GrantTypes: []string{GrantTypeClientCredentials}, Scopes: []string{"users:read"}},
+			stored: adminApproved,
+			ok:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkRegistrationPrivileges(tt.client, tt.stored)
+			if tt.ok && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.ok && !errors.Is(err, apperror.ErrInvalidClientMetadata) {
+				t.Fatalf("got %v, want invalid_client_metadata", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/model"
+)
+
+// Authentication context classes, from the weakest to the strongest.
+const (
+	ACRPassword          = "urn:isso:acr:pwd"
+	ACRMultiFactor       = "urn:isso:acr:mfa"
+	ACRPhishingResistant = "urn:isso:acr:phr"
+)
+
+var ACRValuesSupported = []string{ACRPassword, ACRMultiFactor, ACRPhishingResistant}
+
+const (
+	// a login this recent is good enough for acr_values, otherwise the user
+	// would be sent back to the login page after logging in
+	reauthGrace = 5 * time.Minute
+	// how long the user has to log in again for prompt=login
+	loginRequestTTL = 15 * time.Minute
+)
+
+// authenticated records a login that just finished with the methods in amr.
+func authenticated(amr []string) model.Authentication {
+	amr = slices.Clone(amr)
+	if len(amr) > 1 && !slices.Contains(amr, AMRMultiFactor) {
+		amr = append(amr, AMRMultiFactor)
+	}
+
+	acr := ACRPassword
+	switch {
+	case slices.Contains(amr, AMRHardwareKey):
+		acr = ACRPhishingResistant
+	case slices.Contains(amr, AMRMultiFactor):
+		acr = ACRMultiFactor
+	}
+
+	return model.Authentication{
+		Time: time.Now(),
+		AMR:  amr,
+		ACR:  acr,
+	}
+}
+
+// NeedsReauthentication reports whether the user has to log in again
+// before the request is authorized, because of prompt=login or because
+// the session is weaker than the requested acr_values. acr_values are
+// voluntary, OpenID Connect Core section 5.5.1.1: a user who just logged
+// in without reaching them is let through and the client sees the acr.
+//
+// prompt=login is satisfied by a login after the one asked for with
+// loginRequest, see RequestLogin, however recent the session is.
+func (s *OIDCService) NeedsReauthentication(req *model.AuthorizationRequest, auth model.Authentication, loginRequest string) bool {
+	if req.Prompt[PromptLogin] {
+		requestedAt, err := s.jwtProvider.ParseLoginRequestToken(loginRequest)
+		return err != nil || auth.Time.Before(requestedAt)
+	}
+
+	if time.Since(auth.Time) <= reauthGrace {
+		return false
+	}
+
+	return !acrSatisfies(auth.ACR, requiredACR(req.ACRValues))
+}
+
+// RequestLogin returns the token the request is sent back with after the
+// user logged in again.
+func (s *OIDCService) RequestLogin() (string, error) {
+	token, err := s.jwtProvider.GenerateLoginRequestToken(loginRequestTTL)
+	if err != nil {
+		return "", fmt.Errorf("%w: login request", apperror.ErrGeneratingError)
+	}
+
+	return token, nil
+}
+
+// requiredACR returns the weakest known value of acr_values, unknown values
+// are ignored, "" when nothing is required.
+func requiredACR(acrValues string) string {
+	required := ""
+	for _, value := range strings.Fields(acrValues) {
+		rank := slices.Index(ACRValuesSupported, value)
+		if rank < 0 {
+			continue
+		}
+		if required == "" || rank < slices.Index(ACRValuesSupported, required) {
+			required = value
+		}
+	}
+
+	return required
+}
+
+func acrSatisfies(acr, required string) bool {
+	if required == "" {
+		return true
+	}
+
+	return slices.Index(ACRValuesSupported, acr) >= slices.Index(ACRValuesSupported, required)
+}
@@ -0,0 +1,503 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/model"
+	"github.com/kkonst40/isso/internal/repo"
+	"github.com/kkonst40/isso/internal/utils"
+)
+
+// token_type_hint values, RFC 7009 section 2.1
+const (
+	TokenTypeAccessToken  = "access_token"
+	TokenTypeRefreshToken = "refresh_token"
+)
+
+type TokenService struct {
+	jwtProvider      *utils.JWTProvider
+	userRepo         *repo.UserRepo
+	refreshTokenRepo *repo.RefreshTokenRepo
+	tokenIDCache     *utils.TokenIDCache
+	familyCache      *utils.FamilyCache
+}
+
+func NewTokenService(
+	jwtProvider *utils.JWTProvider,
+	userRepo *repo.UserRepo,
+	refreshTokenRepo *repo.RefreshTokenRepo,
+	tokenIDCache *utils.TokenIDCache,
+	familyCache *utils.FamilyCache,
+) *TokenService {
+	return &TokenService{
+		jwtProvider:      jwtProvider,
+		userRepo:         userRepo,
+		refreshTokenRepo: refreshTokenRepo,
+		tokenIDCache:     tokenIDCache,
+		familyCache:      familyCache,
+	}
+}
+
+// Issue starts a new refresh token family for the user's first-party session.
+func (s *TokenService) Issue(ctx context.Context, user *model.User, auth model.Authentication) (*model.TokenPair, error) {
+	return s.IssueForClient(ctx, user, nil, "", auth)
+}
+
+// IssueForClient starts a new refresh token family bound to the client,
+// nil client means isso's own session.
+func (s *TokenService) IssueForClient(
+	ctx context.Context,
+	user *model.User,
+	client *model.Client,
+	scope string,
+	auth model.Authentication,
+) (*model.TokenPair, error) {
+	familyID, err := uuid.NewV7()
+	if err != nil {
+		return nil, fmt.Errorf("%w: token family id", apperror.ErrGeneratingError)
+	}
+
+	stored := &model.RefreshToken{
+		FamilyID: familyID,
+		UserID:   user.ID,
+		Scope:    scope,
+		Auth:     auth,
+	}
+	if client != nil {
+		stored.ClientID = &client.ID
+	}
+
+	return s.issue(ctx, user, client, stored)
+}
+
+// Refresh rotates the refresh token. Presenting an already rotated token
+// means it was leaked, so the whole family gets revoked. The token must
+// belong to the client, nil for first-party sessions.
+func (s *TokenService) Refresh(ctx context.Context, refreshToken string, client *model.Client) (*model.TokenPair, error) {
+	stored, err := s.refreshTokenRepo.GetByHash(ctx, utils.HashToken(refreshToken))
+	if err != nil {
+		return nil, err
+	}
+
+	reused, err := checkRefreshToken(stored, client, time.Now())
+	if reused {
+		return nil, s.revokeReusedFamily(ctx, stored)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	marked, err := s.refreshTokenRepo.MarkUsed(ctx, stored.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !marked {
+		return nil, s.revokeReusedFamily(ctx, stored)
+	}
+
+	user, err := s.userRepo.GetByID(ctx, stored.UserID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrUserNotFound) {
+			return nil, fmt.Errorf("%w: %w", apperror.ErrInvalidToken, err)
+		}
+		return nil, err
+	}
+
+	return s.issue(ctx, user, client, &model.RefreshToken{
+		FamilyID: stored.FamilyID,
+		UserID:   user.ID,
+		ClientID: stored.ClientID,
+		Scope:    stored.Scope,
+		Auth:     stored.Auth,
+	})
+}
+
+// IssueClientToken issues a client_credentials access token, it has no
+// refresh token.
+func (s *TokenService) IssueClientToken(client *model.Client, scope string) (*model.TokenPair, error) {
+	ttl := s.jwtProvider.AccessTTL()
+	if client.AccessTokenTTL > 0 {
+		ttl = client.AccessTokenTTL
+	}
+
+	accessToken, err := s.jwtProvider.GenerateClientToken(client.ID, scope, ttl)
+	if err != nil {
+		return nil, fmt.Errorf("%w: access token", apperror.ErrGeneratingError)
+	}
+
+	return &model.TokenPair{
+		AccessToken:     accessToken,
+		AccessExpiresAt: time.Now().Add(ttl),
+		Scope:           scope,
+	}, nil
+}
+
+// Introspect reports whether the token is active. Access tokens must pass
+// validation and their refresh token family must not be revoked, errors
+// are only returned for failures other than an invalid token.
+func (s *TokenService) Introspect(ctx context.Context, token, tokenTypeHint string) (*model.TokenInfo, error) {
+	lookups := []func(context.Context, string) (*model.TokenInfo, error){s.introspectAccess, s.introspectRefresh}
+	if tokenTypeHint == TokenTypeRefreshToken {
+		slices.Reverse(lookups)
+	}
+
+	for _, lookup := range lookups {
+		info, err := lookup(ctx, token)
+		if err == nil {
+			return info, nil
+		}
+		if !errors.Is(err, apperror.ErrInvalidToken) {
+			return nil, err
+		}
+	}
+
+	return &model.TokenInfo{}, nil
+}
+
+// Revoke revokes the refresh token family of the token, which must be issued
+// to the client. Invalid tokens are ignored, RFC 7009 section 2.2.
+func (s *TokenService) Revoke(ctx context.Context, token, tokenTypeHint, clientID string) error {
+	familyID, owner, err := s.tokenFamily(ctx, token, tokenTypeHint)
+	if err != nil {
+		if errors.Is(err, apperror.ErrInvalidToken) {
+			return nil
+		}
+		return err
+	}
+
+	if owner != clientID {
+		return fmt.Errorf("%w: token was issued to another client", apperror.ErrUnauthorizedClient)
+	}
+
+	return s.RevokeFamily(ctx, familyID)
+}
+
+// RevokeFamily revokes refresh tokens issued from one authorization and
+// the access tokens issued with them.
+func (s *TokenService) RevokeFamily(ctx context.Context, familyID uuid.UUID) error {
+	if err := s.refreshTokenRepo.RevokeFamily(ctx, familyID); err != nil {
+		return err
+	}
+	s.familyCache.Set(familyID, true)
+
+	return nil
+}
+
+// RevokeAll revokes every refresh token of the user, access tokens are
+// revoked by rotating the user's TokenID.
+func (s *TokenService) RevokeAll(ctx context.Context, userID uuid.UUID) error {
+	s.tokenIDCache.Invalidate(userID)
+	return s.refreshTokenRepo.RevokeByUser(ctx, userID)
+}
+
+// ValidateToken validates isso's own session tokens.
+func (s *TokenService) ValidateToken(ctx context.Context, tokenString string) (*utils.UserClaims, error) {
+	claims, err := s.validate(ctx, tokenString, s.jwtProvider.Cfg.JWT.Audience)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.ClientID != "" {
+		return nil, fmt.Errorf("%w: not a session token", apperror.ErrInvalidToken)
+	}
+
+	return claims, nil
+}
+
+// ValidateAPIToken accepts tokens issued for isso's own API, both user
+// sessions and client_credentials tokens.
+func (s *TokenService) ValidateAPIToken(ctx context.Context, tokenString string) (*utils.UserClaims, error) {
+	return s.validate(ctx, tokenString, s.jwtProvider.Cfg.JWT.Audience)
+}
+
+// ValidateAccessToken accepts access tokens issued to any client.
+func (s *TokenService) ValidateAccessToken(ctx context.Context, tokenString string) (*utils.UserClaims, error) {
+	claims, err := s.validate(ctx, tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if slices.Contains(claims.Audience, s.jwtProvider.ForwardAuthAudience()) {
+		return nil, fmt.Errorf("%w: forward-auth token", apperror.ErrInvalidToken)
+	}
+
+	return claims, nil
+}
+
+// ValidateForwardAuthToken accepts the tokens of the forward-auth cookie.
+func (s *TokenService) ValidateForwardAuthToken(ctx context.Context, tokenString string) (*utils.UserClaims, error) {
+	return s.validate(ctx, tokenString, s.jwtProvider.ForwardAuthAudience())
+}
+
+// validate checks the token signature and claims and then makes sure
+// the token was not revoked, by rotating the user's TokenID or by revoking
+// the refresh token family in its jti. Other instances see a revocation
+// once their cached state expires, after TokenCacheSeconds.
+func (s *TokenService) validate(ctx context.Context, tokenString string, audiences ...string) (*utils.UserClaims, error) {
+	claims, err := s.jwtProvider.ValidateToken(tokenString, audiences...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", apperror.ErrInvalidToken, err)
+	}
+
+	// client tokens are short-lived and not bound to a user session
+	if claims.Machine() {
+		return claims, nil
+	}
+
+	tokenID, err := s.currentTokenID(ctx, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if tokenID != claims.TokenID {
+		return nil, fmt.Errorf("%w: token revoked", apperror.ErrInvalidToken)
+	}
+
+	if familyID, err := uuid.Parse(claims.RegisteredClaims.ID); err == nil {
+		revoked, err := s.familyRevoked(ctx, familyID)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, fmt.Errorf("%w: token family revoked", apperror.ErrInvalidToken)
+		}
+	}
+
+	return claims, nil
+}
+
+// Invalidate drops the cached TokenID, so the next validation reads
+// the current value from the database.
+func (s *TokenService) Invalidate(userID uuid.UUID) {
+	s.tokenIDCache.Invalidate(userID)
+}
+
+// issue fills in the rest of the refresh token and stores it.
+func (s *TokenService) issue(
+	ctx context.Context,
+	user *model.User,
+	client *model.Client,
+	stored *model.RefreshToken,
+) (*model.TokenPair, error) {
+	accessTTL := s.jwtProvider.AccessTTL()
+	refreshTTL := s.jwtProvider.RefreshTTL()
+	clientID := ""
+	if client != nil {
+		clientID = client.ID
+		if client.AccessTokenTTL > 0 {
+			accessTTL = client.AccessTokenTTL
+		}
+		if client.RefreshTokenTTL > 0 {
+			refreshTTL = client.RefreshTokenTTL
+		}
+	}
+
+	accessToken, err := s.jwtProvider.GenerateForClient(user, clientID, stored.FamilyID.String(), stored.Scope, accessTTL, stored.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("%w: access token", apperror.ErrGeneratingError)
+	}
+
+	refreshToken, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, fmt.Errorf("%w: refresh token", apperror.ErrGeneratingError)
+	}
+
+	tokenID, err := uuid.NewV7()
+	if err != nil {
+		return nil, fmt.Errorf("%w: refresh token id", apperror.ErrGeneratingError)
+	}
+
+	var forwardAuthToken string
+	if client == nil {
+		forwardAuthToken, err = s.jwtProvider.GenerateForwardAuth(user, stored.FamilyID.String(), accessTTL)
+		if err != nil {
+			return nil, fmt.Errorf("%w: forward-auth token", apperror.ErrGeneratingError)
+		}
+	}
+
+	now := time.Now()
+	stored.ID = tokenID
+	stored.TokenHash = utils.HashToken(refreshToken)
+	stored.CreatedAt = now
+	stored.ExpiresAt = now.Add(refreshTTL)
+
+	if err := s.refreshTokenRepo.Create(ctx, stored); err != nil {
+		return nil, err
+	}
+
+	return &model.TokenPair{
+		FamilyID:         stored.FamilyID,
+		Scope:            stored.Scope,
+		AccessToken:      accessToken,
+		AccessExpiresAt:  now.Add(accessTTL),
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: stored.ExpiresAt,
+		ForwardAuthToken: forwardAuthToken,
+	}, nil
+}
+
+func (s *TokenService) introspectAccess(ctx context.Context, token string) (*model.TokenInfo, error) {
+	claims, err := s.ValidateAccessToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &model.TokenInfo{
+		Active:    true,
+		TokenType: TokenTypeAccessToken,
+		Scope:     claims.Scope,
+		ClientID:  claims.ClientID,
+		Username:  claims.UserName,
+		Subject:   claims.Subject,
+		Audience:  claims.Audience,
+		Issuer:    claims.Issuer,
+		JTI:       claims.RegisteredClaims.ID,
+	}
+	if claims.IssuedAt != nil {
+		info.IssuedAt = claims.IssuedAt.Time
+	}
+	if claims.ExpiresAt != nil {
+		info.ExpiresAt = claims.ExpiresAt.Time
+	}
+
+	return info, nil
+}
+
+func (s *TokenService) introspectRefresh(ctx context.Context, token string) (*model.TokenInfo, error) {
+	stored, err := s.refreshTokenRepo.GetByHash(ctx, utils.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+
+	if stored.RevokedAt != nil || stored.UsedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return nil, fmt.Errorf("%w: refresh token is not active", apperror.ErrInvalidToken)
+	}
+
+	user, err := s.userRepo.GetByID(ctx, stored.UserID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrUserNotFound) {
+			return nil, fmt.Errorf("%w: %w", apperror.ErrInvalidToken, err)
+		}
+		return nil, err
+	}
+
+	info := &model.TokenInfo{
+		Active:    true,
+		TokenType: TokenTypeRefreshToken,
+		Scope:     stored.Scope,
+		Username:  user.Login,
+		Subject:   user.ID.String(),
+		Issuer:    s.jwtProvider.Cfg.JWT.Issuer,
+		IssuedAt:  stored.CreatedAt,
+		ExpiresAt: stored.ExpiresAt,
+	}
+	if stored.ClientID != nil {
+		info.ClientID = *stored.ClientID
+	}
+
+	return info, nil
+}
+
+// tokenFamily finds the refresh token family of an access or refresh token
+// and the client it was issued to, "" for first-party sessions.
+func (s *TokenService) tokenFamily(ctx context.Context, token, tokenTypeHint string) (uuid.UUID, string, error) {
+	if tokenTypeHint != TokenTypeAccessToken {
+		stored, err := s.refreshTokenRepo.GetByHash(ctx, utils.HashToken(token))
+		if err == nil {
+			owner := ""
+			if stored.ClientID != nil {
+				owner = *stored.ClientID
+			}
+			return stored.FamilyID, owner, nil
+		}
+		if !errors.Is(err, apperror.ErrInvalidToken) {
+			return uuid.Nil, "", err
+		}
+	}
+
+	claims, err := s.jwtProvider.ValidateToken(token)
+	if err != nil {
+		return uuid.Nil, "", fmt.Errorf("%w: %w", apperror.ErrInvalidToken, err)
+	}
+
+	familyID, err := uuid.Parse(claims.RegisteredClaims.ID)
+	if err != nil {
+		// client_credentials tokens have no state to revoke
+		return uuid.Nil, "", fmt.Errorf("%w: token can't be revoked", apperror.ErrUnsupportedTokenType)
+	}
+
+	return familyID, claims.ClientID, nil
+}
+
+// checkRefreshToken decides whether the stored token may be rotated,
+// reused reports a token that was rotated before.
+func checkRefreshToken(stored *model.RefreshToken, client *model.Client, now time.Time) (reused bool, err error) {
+	clientID := ""
+	if client != nil {
+		clientID = client.ID
+	}
+	if stored.ClientID == nil && clientID != "" || stored.ClientID != nil && *stored.ClientID != clientID {
+		return false, fmt.Errorf("%w: refresh token was issued to another client", apperror.ErrInvalidToken)
+	}
+
+	if stored.RevokedAt != nil {
+		return false, fmt.Errorf("%w: refresh token revoked", apperror.ErrInvalidToken)
+	}
+
+	if stored.UsedAt != nil {
+		return true, nil
+	}
+
+	if now.After(stored.ExpiresAt) {
+		return false, fmt.Errorf("%w: refresh token expired", apperror.ErrInvalidToken)
+	}
+
+	return false, nil
+}
+
+func (s *TokenService) revokeReusedFamily(ctx context.Context, stored *model.RefreshToken) error {
+	if err := s.RevokeFamily(ctx, stored.FamilyID); err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: refresh token reuse, family %s revoked", apperror.ErrInvalidToken, stored.FamilyID)
+}
+
+func (s *TokenService) currentTokenID(ctx context.Context, userID uuid.UUID) (uuid.UUID, error) {
+	if tokenID, ok := s.tokenIDCache.Get(userID); ok {
+		return tokenID, nil
+	}
+
+	generation := s.tokenIDCache.Generation()
+	tokenID, err := s.userRepo.GetTokenID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrUserNotFound) {
+			return uuid.UUID{}, fmt.Errorf("%w: %w", apperror.ErrInvalidToken, err)
+		}
+		return uuid.UUID{}, err
+	}
+
+	s.tokenIDCache.Set(userID, tokenID, generation)
+
+	return tokenID, nil
+}
+
+func (s *TokenService) familyRevoked(ctx context.Context, familyID uuid.UUID) (bool, error) {
+	if revoked, ok := s.familyCache.Get(familyID); ok {
+		return revoked, nil
+	}
+
+	revoked, err := s.refreshTokenRepo.FamilyRevoked(ctx, familyID)
+	if err != nil {
+		return false, err
+	}
+
+	s.familyCache.Set(familyID, revoked)
+
+	return revoked, nil
+}
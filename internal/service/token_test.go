@@ -0,0 +1,86 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/model"
+)
+
+func TestCheckRefreshToken(t *testing.T) {
+	now := time.Now()
+	earlier := now.Add(-time.Minute)
+	clientID := "app"
+	client := &model.Client{ID: clientID}
+
+	tests := []struct {
+		name   string
+		stored model.RefreshToken
+		client *model.Client
+		reused bool
+		ok     bool
+	}{
+		{
+			name:   "first-party session",
+			stored: model.RefreshToken{ExpiresAt: now.Add(time.Hour)},
+			ok:     true,
+		},
+		{
+			name:   "client token",
+			stored: model.RefreshToken{ClientID: &clientID, ExpiresAt: now.Add(time.Hour)},
+			client: client,
+			ok:     true,
+		},
+		{
+			name:   "rotated before",
+			stored: model.RefreshToken{ExpiresAt: now.Add(time.Hour), UsedAt: &earlier},
+			reused: true,
+		},
+		{
+			// a leaked token is revoked with its family even after it expired
+			name:   "rotated and expired",
+			stored: model.RefreshToken{ExpiresAt: earlier, UsedAt: &earlier},
+			reused: true,
+		},
+		{
+			name:   "revoked family",
+			stored: model.RefreshToken{ExpiresAt: now.Add(time.Hour), UsedAt: &earlier, RevokedAt: &earlier},
+		},
+		{
+			name:   "expired",
+			stored: model.RefreshToken{ExpiresAt: earlier},
+		},
+		{
+			name:   "session token presented by a client",
+			stored: model.RefreshToken{ExpiresAt: now.Add(time.Hour)},
+			client: client,
+		},
+		{
+			name:   "client token presented by the session",
+			stored: model.RefreshToken{ClientID: &clientID, ExpiresAt: now.Add(time.Hour)},
+		},
+		{
+			// another client can't revoke the family by replaying a token
+			name:   "rotated token of another client",
+			stored: model.RefreshToken{ClientID: &clientID, ExpiresAt: now.Add(time.Hour), UsedAt: &earlier},
+			client: &model.Client{ID: "other"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reused, err := checkRefreshToken(&tt.stored, tt.client, now)
+			if reused != tt.reused {
+				t.Fatalf("reused = %v, want %v", reused, tt.reused)
+			}
+			if tt.ok && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.ok && !tt.reused && !errors.Is(err, apperror.ErrInvalidToken) {
+				t.Fatalf("err = %v, want %v", err, apperror.ErrInvalidToken)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
 
 	"github.com/google/uuid"
 	"github.com/kkonst40/isso/internal/apperror"
@@ -13,26 +14,38 @@ import (
 )
 
 type UserService struct {
-	jwtProvider   *utils.JWTProvider
-	pwdHandler    *utils.PasswordHandler
-	credValidator *utils.CredValidator
-	userRepo      *repo.UserRepo
-	specialID     uuid.UUID
+	tokenService   *TokenService
+	logoutService  *LogoutService
+	mfaService     *MFAService
+	passkeyService *WebAuthnService
+	emailLogin     *EmailLoginService
+	pwdHandler     *utils.PasswordHandler
+	credValidator  *utils.CredValidator
+	userRepo       *repo.UserRepo
+	specialID      uuid.UUID
 }
 
 func New(
-	jwtProvider *utils.JWTProvider,
+	tokenService *TokenService,
+	logoutService *LogoutService,
+	mfaService *MFAService,
+	passkeyService *WebAuthnService,
+	emailLogin *EmailLoginService,
 	pwdHandler *utils.PasswordHandler,
 	credValidator *utils.CredValidator,
 	userRepo *repo.UserRepo,
 	specialID uuid.UUID,
 ) *UserService {
 	return &UserService{
-		jwtProvider:   jwtProvider,
-		pwdHandler:    pwdHandler,
-		credValidator: credValidator,
-		userRepo:      userRepo,
-		specialID:     specialID,
+		tokenService:   tokenService,
+		logoutService:  logoutService,
+		mfaService:     mfaService,
+		passkeyService: passkeyService,
+		emailLogin:     emailLogin,
+		pwdHandler:     pwdHandler,
+		credValidator:  credValidator,
+		userRepo:       userRepo,
+		specialID:      specialID,
 	}
 }
 
@@ -40,27 +53,178 @@ func (s *UserService) All(ctx context.Context) ([]model.User, error) {
 	return s.userRepo.GetAll(ctx)
 }
 
+func (s *UserService) Get(ctx context.Context, ID uuid.UUID) (*model.User, error) {
+	return s.userRepo.GetByID(ctx, ID)
+}
+
 func (s *UserService) Exist(ctx context.Context, IDs []uuid.UUID) ([]uuid.UUID, error) {
-	//if requesterID != s.specialID {
-	//	return false, fmt.Errorf("no permission")
-	//}
 	return s.userRepo.Exist(ctx, IDs)
 }
 
-func (s *UserService) Login(ctx context.Context, login, password string) (string, error) {
+// Login checks the password. Users with a second factor get an MFA token
+// instead of the session, the login is finished with LoginTOTP,
+// LoginWebAuthn or LoginRecoveryCode.
+func (s *UserService) Login(ctx context.Context, login, password string) (*model.LoginResult, error) {
 	user, err := s.userRepo.GetByLogin(ctx, login)
 	if err != nil {
 		if !errors.Is(err, apperror.ErrInternalDB) {
-			return "", apperror.ErrInvalidCredentials
+			return nil, apperror.ErrInvalidCredentials
 		}
-		return "", err
+		return nil, err
 	}
 
+	return s.loginWithPassword(ctx, user, password)
+}
+
+// Reauthenticate repeats the login of the logged in user, so the session
+// gets a fresh auth_time for the endpoints that require a recent login.
+// The second factor is asked for the same way as by Login.
+func (s *UserService) Reauthenticate(ctx context.Context, ID uuid.UUID, password string) (*model.LoginResult, error) {
+	user, err := s.userRepo.GetByID(ctx, ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.loginWithPassword(ctx, user, password)
+}
+
+func (s *UserService) loginWithPassword(ctx context.Context, user *model.User, password string) (*model.LoginResult, error) {
 	if !s.pwdHandler.VerifyPwd(password, user.PasswordHash) {
-		return "", apperror.ErrInvalidCredentials
+		return nil, apperror.ErrInvalidCredentials
+	}
+
+	if s.pwdHandler.NeedsRehash(user.PasswordHash) {
+		s.rehash(ctx, user, password)
+	}
+
+	return s.firstFactorPassed(ctx, user, []string{AMRPassword})
+}
+
+// rehash moves a verified password to the current hash algorithm and
+// parameters. Failing doesn't fail the login, it is retried next time.
+func (s *UserService) rehash(ctx context.Context, user *model.User, password string) {
+	pwdHash, err := s.pwdHandler.GeneratePwdHash(password)
+	if err != nil {
+		log.Println("Password rehash error", "error", err.Error())
+		return
+	}
+
+	if err := s.userRepo.UpdatePasswordHash(ctx, user.ID, user.PasswordHash, pwdHash); err != nil {
+		log.Println("Password rehash error", "error", err.Error())
+		return
+	}
+
+	user.PasswordHash = pwdHash
+}
+
+// firstFactorPassed starts the session, or asks for the second factor when
+// the user has one.
+func (s *UserService) firstFactorPassed(ctx context.Context, user *model.User, amr []string) (*model.LoginResult, error) {
+	methods, err := s.mfaService.Methods(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(methods) > 0 {
+		mfaToken, err := s.mfaService.Challenge(user.ID, amr)
+		if err != nil {
+			return nil, err
+		}
+		return &model.LoginResult{MFAToken: mfaToken, MFAMethods: methods}, nil
+	}
+
+	tokens, err := s.tokenService.Issue(ctx, user, authenticated(amr))
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.LoginResult{Tokens: tokens}, nil
+}
+
+func (s *UserService) LoginTOTP(ctx context.Context, mfaToken, code string) (*model.TokenPair, error) {
+	userID, amr, err := s.mfaService.VerifyTOTPLogin(ctx, mfaToken, code)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issueVerified(ctx, userID, amr)
+}
+
+// LoginRecoveryCode finishes the login of a user without access to the
+// second factor, the code is used up.
+func (s *UserService) LoginRecoveryCode(ctx context.Context, mfaToken, code string) (*model.TokenPair, error) {
+	userID, amr, err := s.mfaService.VerifyRecoveryCodeLogin(ctx, mfaToken, code)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issueVerified(ctx, userID, amr)
+}
+
+// StartEmailLogin mails a login link and code to the user, the code is
+// redeemed with the returned challenge ID.
+func (s *UserService) StartEmailLogin(ctx context.Context, login, returnTo string) (uuid.UUID, error) {
+	return s.emailLogin.Start(ctx, login, returnTo)
+}
+
+// LoginEmailLink replaces the password step, users with a second factor
+// still get an MFA token.
+func (s *UserService) LoginEmailLink(ctx context.Context, token string) (*model.LoginResult, error) {
+	userID, amr, err := s.emailLogin.VerifyLink(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.emailFactorPassed(ctx, userID, amr)
+}
+
+func (s *UserService) LoginEmailCode(ctx context.Context, challengeID uuid.UUID, code string) (*model.LoginResult, error) {
+	userID, amr, err := s.emailLogin.VerifyCode(ctx, challengeID, code)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.emailFactorPassed(ctx, userID, amr)
+}
+
+func (s *UserService) emailFactorPassed(ctx context.Context, userID uuid.UUID, amr []string) (*model.LoginResult, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrUserNotFound) {
+			return nil, fmt.Errorf("%w: %w", apperror.ErrInvalidLoginCode, err)
+		}
+		return nil, err
+	}
+
+	return s.firstFactorPassed(ctx, user, amr)
+}
+
+// BeginLoginWebAuthn starts a passwordless login, or the second step of a
+// password login when mfaToken is set.
+func (s *UserService) BeginLoginWebAuthn(ctx context.Context, mfaToken string) (*model.WebAuthnCeremony, error) {
+	return s.passkeyService.BeginLogin(ctx, mfaToken)
+}
+
+func (s *UserService) LoginWebAuthn(ctx context.Context, mfaToken, sessionID string, response []byte) (*model.TokenPair, error) {
+	userID, amr, err := s.passkeyService.FinishLogin(ctx, mfaToken, sessionID, response)
+	if err != nil {
+		return nil, err
 	}
 
-	return s.jwtProvider.Generate(user)
+	return s.issueVerified(ctx, userID, amr)
+}
+
+// issueVerified starts the session of a user who passed all factors.
+func (s *UserService) issueVerified(ctx context.Context, userID uuid.UUID, amr []string) (*model.TokenPair, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrUserNotFound) {
+			return nil, fmt.Errorf("%w: %w", apperror.ErrInvalidToken, err)
+		}
+		return nil, err
+	}
+
+	return s.tokenService.Issue(ctx, user, authenticated(amr))
 }
 
 func (s *UserService) Create(ctx context.Context, login, password string) error {
@@ -95,50 +259,58 @@ func (s *UserService) UpdateLogin(ctx context.Context, ID uuid.UUID, newLogin st
 		return apperror.ErrInvalidLogin
 	}
 
-	user, err := s.userRepo.GetByID(ctx, ID)
-	if err != nil {
-		return err
-	}
-
-	user.Login = newLogin
-
-	return s.userRepo.Update(ctx, user)
+	return s.userRepo.UpdateLogin(ctx, ID, newLogin)
 }
 
-func (s *UserService) UpdatePassword(ctx context.Context, ID uuid.UUID, newPwd string) error {
+// UpdatePassword logs every other session of the user out like a logout,
+// clients are notified over the back channel. The returned tokens replace
+// the requester's current ones and keep its auth.
+func (s *UserService) UpdatePassword(
+	ctx context.Context,
+	ID uuid.UUID,
+	newPwd string,
+	auth model.Authentication,
+) (*model.TokenPair, error) {
 	if !s.credValidator.ValidatePwd(newPwd) {
-		return apperror.ErrInvalidPwd
+		return nil, apperror.ErrInvalidPwd
 	}
 
 	user, err := s.userRepo.GetByID(ctx, ID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	newPwdHash, err := s.pwdHandler.GeneratePwdHash(newPwd)
 	if err != nil {
-		return fmt.Errorf("%w: password hash", apperror.ErrGeneratingError)
+		return nil, fmt.Errorf("%w: password hash", apperror.ErrGeneratingError)
 	}
 
 	user.PasswordHash = newPwdHash
+	user.TokenID, err = s.logoutService.EndSessions(ctx, user.ID, func(tokenID uuid.UUID) error {
+		return s.userRepo.UpdatePassword(ctx, user.ID, user.PasswordHash, tokenID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.tokenService.Issue(ctx, user, auth)
+}
 
-	return s.userRepo.Update(ctx, user)
+func (s *UserService) Refresh(ctx context.Context, refreshToken string) (*model.TokenPair, error) {
+	return s.tokenService.Refresh(ctx, refreshToken, nil)
 }
 
 func (s *UserService) Delete(ctx context.Context, ID, requesterID uuid.UUID) error {
-	if requesterID != ID && requesterID != s.specialID {
+	if requesterID != ID && !isAdmin(s.specialID, requesterID) {
 		return apperror.ErrNoPermission
 	}
 
-	return s.userRepo.Delete(ctx, ID)
+	err := s.userRepo.Delete(ctx, ID)
+	s.tokenService.Invalidate(ID)
+
+	return err
 }
 
 func (s *UserService) Logout(ctx context.Context, ID uuid.UUID) error {
-	user, err := s.userRepo.GetByID(ctx, ID)
-	if err != nil {
-		return fmt.Errorf("logging out error")
-	}
-
-	user.TokenID = uuid.New()
-	return s.userRepo.Update(ctx, user)
+	return s.logoutService.Logout(ctx, ID)
 }
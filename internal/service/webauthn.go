@@ -0,0 +1,409 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/config"
+	"github.com/kkonst40/isso/internal/model"
+	"github.com/kkonst40/isso/internal/repo"
+	"github.com/kkonst40/isso/internal/utils"
+)
+
+const (
+	MFAMethodWebAuthn = "webauthn"
+
+	webAuthnDisplayName = "isso"
+	webAuthnSessionTTL  = 5 * time.Minute
+	maxPasskeyNameLen   = 64
+)
+
+// NewRelyingParty configures WebAuthn for the RP ID and origins from the
+// config, or for the JWT issuer when they are not set.
+func NewRelyingParty(cfg *config.Config) (*webauthn.WebAuthn, error) {
+	rpID, origins := cfg.WebAuthn.RPID, cfg.WebAuthn.Origins
+
+	if rpID == "" || len(origins) == 0 {
+		issuer, err := url.Parse(cfg.JWT.Issuer)
+		if err != nil || issuer.Host == "" {
+			return nil, fmt.Errorf("invalid webauthn relying party: issuer %q is not an url", cfg.JWT.Issuer)
+		}
+		if rpID == "" {
+			rpID = issuer.Hostname()
+		}
+		if len(origins) == 0 {
+			origins = []string{issuer.Scheme + "://" + issuer.Host}
+		}
+	}
+
+	rp, err := webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: webAuthnDisplayName,
+		RPOrigins:     origins,
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: webAuthnSessionTTL},
+			Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: webAuthnSessionTTL},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid webauthn relying party: %w", err)
+	}
+
+	return rp, nil
+}
+
+type WebAuthnService struct {
+	relyingParty *webauthn.WebAuthn
+	mfaService   *MFAService
+	credRepo     *repo.WebAuthnCredentialRepo
+	sessionRepo  *repo.WebAuthnSessionRepo
+	userRepo     *repo.UserRepo
+}
+
+func NewWebAuthnService(
+	relyingParty *webauthn.WebAuthn,
+	mfaService *MFAService,
+	credRepo *repo.WebAuthnCredentialRepo,
+	sessionRepo *repo.WebAuthnSessionRepo,
+	userRepo *repo.UserRepo,
+) *WebAuthnService {
+	return &WebAuthnService{
+		relyingParty: relyingParty,
+		mfaService:   mfaService,
+		credRepo:     credRepo,
+		sessionRepo:  sessionRepo,
+		userRepo:     userRepo,
+	}
+}
+
+// webAuthnUser adapts model.User to webauthn.User, the user handle is the
+// user ID.
+type webAuthnUser struct {
+	user  *model.User
+	creds []webauthn.Credential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return u.user.ID[:]
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.user.Login
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return u.user.Login
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.creds
+}
+
+func (s *WebAuthnService) Credentials(ctx context.Context, userID uuid.UUID) ([]model.WebAuthnCredential, error) {
+	return s.credRepo.GetByUser(ctx, userID)
+}
+
+func (s *WebAuthnService) DeleteCredential(ctx context.Context, userID uuid.UUID, ID []byte) error {
+	if err := s.credRepo.Delete(ctx, userID, ID); err != nil {
+		return err
+	}
+
+	return s.mfaService.forgetRecoveryCodes(ctx, userID)
+}
+
+// BeginRegistration asks for a discoverable credential when the
+// authenticator supports it, only those work for passwordless login.
+func (s *WebAuthnService) BeginRegistration(ctx context.Context, userID uuid.UUID) (*model.WebAuthnCeremony, error) {
+	user, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	exclusions := webauthn.Credentials(user.creds).CredentialDescriptors()
+	options, session, err := s.relyingParty.BeginRegistration(
+		user,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: webauthn registration: %w", apperror.ErrGeneratingError, err)
+	}
+
+	return s.startCeremony(ctx, &userID, session, options)
+}
+
+// FinishRegistration stores the credential, the recovery codes are returned
+// when it is the user's first second factor.
+func (s *WebAuthnService) FinishRegistration(ctx context.Context, userID uuid.UUID, sessionID, name string, response []byte) (*model.WebAuthnCredential, []string, error) {
+	if len(name) > maxPasskeyNameLen {
+		return nil, nil, fmt.Errorf("%w: name is too long", apperror.ErrInvalidRequest)
+	}
+
+	session, err := s.takeSession(ctx, sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if session.userID == nil || *session.userID != userID {
+		return nil, nil, fmt.Errorf("%w: session of another user", apperror.ErrInvalidPasskey)
+	}
+
+	user, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", apperror.ErrInvalidPasskey, err)
+	}
+
+	credential, err := s.relyingParty.CreateCredential(user, session.data, parsed)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", apperror.ErrInvalidPasskey, err)
+	}
+
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: webauthn credential", apperror.ErrGeneratingError)
+	}
+
+	cred := &model.WebAuthnCredential{
+		ID:        credential.ID,
+		UserID:    userID,
+		Name:      name,
+		Data:      data,
+		CreatedAt: time.Now(),
+	}
+	if err := s.credRepo.Create(ctx, cred); err != nil {
+		return nil, nil, err
+	}
+
+	codes, err := s.mfaService.ensureRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cred, codes, nil
+}
+
+// BeginLogin starts a passkey login. With an MFA token it is the second
+// step of a password login and only the user's credentials are allowed,
+// without one any discoverable credential may answer.
+func (s *WebAuthnService) BeginLogin(ctx context.Context, mfaToken string) (*model.WebAuthnCeremony, error) {
+	if mfaToken == "" {
+		options, session, err := s.relyingParty.BeginDiscoverableLogin(
+			webauthn.WithUserVerification(protocol.VerificationRequired),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%w: webauthn login: %w", apperror.ErrGeneratingError, err)
+		}
+
+		return s.startCeremony(ctx, nil, session, options)
+	}
+
+	userID, _, err := s.mfaService.parseChallenge(mfaToken)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(user.creds) == 0 {
+		return nil, fmt.Errorf("%w: user %s", apperror.ErrPasskeyNotFound, userID)
+	}
+
+	options, session, err := s.relyingParty.BeginLogin(user)
+	if err != nil {
+		return nil, fmt.Errorf("%w: webauthn login: %w", apperror.ErrGeneratingError, err)
+	}
+
+	return s.startCeremony(ctx, &userID, session, options)
+}
+
+// FinishLogin verifies the assertion and returns the user with the methods
+// used. A passwordless login requires user verification on the
+// authenticator, so it counts as multi-factor by itself.
+func (s *WebAuthnService) FinishLogin(ctx context.Context, mfaToken, sessionID string, response []byte) (uuid.UUID, []string, error) {
+	session, err := s.takeSession(ctx, sessionID)
+	if err != nil {
+		return uuid.UUID{}, nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return uuid.UUID{}, nil, fmt.Errorf("%w: %w", apperror.ErrInvalidPasskey, err)
+	}
+
+	var (
+		user       *webAuthnUser
+		credential *webauthn.Credential
+		amr        []string
+	)
+
+	if mfaToken == "" {
+		if session.userID != nil {
+			return uuid.UUID{}, nil, fmt.Errorf("%w: second factor session", apperror.ErrInvalidPasskey)
+		}
+
+		found, cred, err := s.relyingParty.ValidatePasskeyLogin(func(_, userHandle []byte) (webauthn.User, error) {
+			userID, err := uuid.FromBytes(userHandle)
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid user handle", apperror.ErrInvalidPasskey)
+			}
+			return s.loadUser(ctx, userID)
+		}, session.data, parsed)
+		if err != nil {
+			if errors.Is(err, apperror.ErrInternalDB) {
+				return uuid.UUID{}, nil, err
+			}
+			return uuid.UUID{}, nil, fmt.Errorf("%w: %w", apperror.ErrInvalidPasskey, err)
+		}
+
+		user, credential = found.(*webAuthnUser), cred
+		amr = []string{AMRHardwareKey, AMRMultiFactor}
+	} else {
+		userID, firstFactors, err := s.mfaService.parseChallenge(mfaToken)
+		if err != nil {
+			return uuid.UUID{}, nil, err
+		}
+		if session.userID == nil || *session.userID != userID {
+			return uuid.UUID{}, nil, fmt.Errorf("%w: session of another user", apperror.ErrInvalidPasskey)
+		}
+
+		user, err = s.loadUser(ctx, userID)
+		if err != nil {
+			return uuid.UUID{}, nil, err
+		}
+
+		credential, err = s.relyingParty.ValidateLogin(user, session.data, parsed)
+		if err != nil {
+			return uuid.UUID{}, nil, fmt.Errorf("%w: %w", apperror.ErrInvalidPasskey, err)
+		}
+
+		amr = append(firstFactors, AMRHardwareKey)
+	}
+
+	if err := checkSignCount(credential); err != nil {
+		return uuid.UUID{}, nil, err
+	}
+
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return uuid.UUID{}, nil, fmt.Errorf("%w: webauthn credential", apperror.ErrGeneratingError)
+	}
+	if err := s.credRepo.Use(ctx, credential.ID, data, time.Now()); err != nil {
+		return uuid.UUID{}, nil, err
+	}
+
+	return user.user.ID, amr, nil
+}
+
+// checkSignCount rejects an assertion whose signature counter didn't go
+// up, the authenticator may be cloned then.
+func checkSignCount(credential *webauthn.Credential) error {
+	if credential.Authenticator.CloneWarning {
+		return fmt.Errorf("%w: signature counter went back, the authenticator may be cloned", apperror.ErrInvalidPasskey)
+	}
+
+	return nil
+}
+
+// RunCleanup deletes the sessions of abandoned ceremonies.
+func (s *WebAuthnService) RunCleanup(ctx context.Context) {
+	ticker := time.NewTicker(cleanupEvery)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.sessionRepo.DeleteExpired(ctx, time.Now()); err != nil {
+				log.Println("WebAuthn sessions cleanup error", "error", err.Error())
+			}
+		}
+	}
+}
+
+func (s *WebAuthnService) loadUser(ctx context.Context, userID uuid.UUID) (*webAuthnUser, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrUserNotFound) {
+			return nil, fmt.Errorf("%w: %w", apperror.ErrInvalidPasskey, err)
+		}
+		return nil, err
+	}
+
+	stored, err := s.credRepo.GetByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	creds := make([]webauthn.Credential, 0, len(stored))
+	for _, cred := range stored {
+		var credential webauthn.Credential
+		if err := json.Unmarshal(cred.Data, &credential); err != nil {
+			return nil, fmt.Errorf("%w: credential data: %w", apperror.ErrInternalDB, err)
+		}
+		creds = append(creds, credential)
+	}
+
+	return &webAuthnUser{user: user, creds: creds}, nil
+}
+
+type webAuthnSession struct {
+	userID *uuid.UUID
+	data   webauthn.SessionData
+}
+
+func (s *WebAuthnService) startCeremony(ctx context.Context, userID *uuid.UUID, session *webauthn.SessionData, options any) (*model.WebAuthnCeremony, error) {
+	sessionID, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, fmt.Errorf("%w: webauthn session", apperror.ErrGeneratingError)
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return nil, fmt.Errorf("%w: webauthn session", apperror.ErrGeneratingError)
+	}
+
+	if err := s.sessionRepo.Create(ctx, &model.WebAuthnSession{
+		SessionHash: utils.HashToken(sessionID),
+		UserID:      userID,
+		Data:        data,
+		ExpiresAt:   time.Now().Add(webAuthnSessionTTL),
+	}); err != nil {
+		return nil, err
+	}
+
+	return &model.WebAuthnCeremony{SessionID: sessionID, Options: options}, nil
+}
+
+func (s *WebAuthnService) takeSession(ctx context.Context, sessionID string) (*webAuthnSession, error) {
+	stored, err := s.sessionRepo.Take(ctx, utils.HashToken(sessionID))
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Now().After(stored.ExpiresAt) {
+		return nil, fmt.Errorf("%w: session expired", apperror.ErrInvalidPasskey)
+	}
+
+	session := &webAuthnSession{userID: stored.UserID}
+	if err := json.Unmarshal(stored.Data, &session.data); err != nil {
+		return nil, fmt.Errorf("%w: session data: %w", apperror.ErrInternalDB, err)
+	}
+
+	return session, nil
+}
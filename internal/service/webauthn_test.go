@@ -0,0 +1,279 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/apperror"
+	"github.com/kkonst40/isso/internal/config"
+	"github.com/kkonst40/isso/internal/model"
+)
+
+const testOrigin = "https://id.example.com"
+
+// softAuthenticator is a software passkey with an ES256 key and "none"
+// attestation.
+type softAuthenticator struct {
+	t         *testing.T
+	rpID      string
+	key       *ecdsa.PrivateKey
+	credID    []byte
+	signCount uint32
+}
+
+func newSoftAuthenticator(t *testing.T, rpID string) *softAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	credID := make([]byte, 16)
+	if _, err := rand.Read(credID); err != nil {
+		t.Fatal(err)
+	}
+
+	return &softAuthenticator{t: t, rpID: rpID, key: key, credID: credID}
+}
+
+func (a *softAuthenticator) authData(flags byte, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	return append(data, attested...)
+}
+
+func (a *softAuthenticator) clientData(typ, challenge, origin string) []byte {
+	data, err := json.Marshal(map[string]string{
+		"type":      typ,
+		"challenge": challenge,
+		"origin":    origin,
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	return data
+}
+
+func (a *softAuthenticator) create(session *webauthn.SessionData, origin string) []byte {
+	a.t.Helper()
+
+	coseKey, err := webauthncbor.Marshal(map[int]any{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	attested := make([]byte, 16) // zero AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credID)))
+	attested = append(attested, a.credID...)
+	attested = append(attested, coseKey...)
+
+	// user present, user verified, attested credential data
+	attestation, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": a.authData(0x45, attested),
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	return a.response(map[string]string{
+		"clientDataJSON":    b64url(a.clientData("webauthn.create", session.Challenge, origin)),
+		"attestationObject": b64url(attestation),
+	})
+}
+
+func (a *softAuthenticator) get(session *webauthn.SessionData, userHandle []byte, origin string) []byte {
+	a.t.Helper()
+
+	authData := a.authData(0x05, nil)
+	clientData := a.clientData("webauthn.get", session.Challenge, origin)
+	clientDataHash := sha256.Sum256(clientData)
+
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	return a.response(map[string]string{
+		"clientDataJSON":    b64url(clientData),
+		"authenticatorData": b64url(authData),
+		"signature":         b64url(signature),
+		"userHandle":        b64url(userHandle),
+	})
+}
+
+func (a *softAuthenticator) response(response map[string]string) []byte {
+	data, err := json.Marshal(map[string]any{
+		"id":       b64url(a.credID),
+		"rawId":    b64url(a.credID),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	return data
+}
+
+func b64url(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func newTestRelyingParty(t *testing.T) *webauthn.WebAuthn {
+	t.Helper()
+
+	rp, err := NewRelyingParty(&config.Config{JWT: config.JWTConfig{Issuer: testOrigin}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rp
+}
+
+// registerPasskey runs a registration ceremony and returns the credential
+// the way it is stored and loaded again.
+func registerPasskey(t *testing.T, rp *webauthn.WebAuthn, user *webAuthnUser, auth *softAuthenticator) webauthn.Credential {
+	t.Helper()
+
+	_, session, err := rp.BeginRegistration(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(auth.create(session, testOrigin))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	credential, err := rp.CreateCredential(user, *session, parsed)
+	if err != nil {
+		t.Fatalf("registration: %v", err)
+	}
+
+	data, err := json.Marshal(credential)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stored webauthn.Credential
+	if err := json.Unmarshal(data, &stored); err != nil {
+		t.Fatal(err)
+	}
+
+	return stored
+}
+
+func loginPasskey(rp *webauthn.WebAuthn, user *webAuthnUser, auth *softAuthenticator, origin string) (*webauthn.Credential, error) {
+	_, session, err := rp.BeginLogin(user)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(auth.get(session, user.WebAuthnID(), origin))
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := rp.ValidateLogin(user, *session, parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	return credential, checkSignCount(credential)
+}
+
+func TestWebAuthnRoundTrip(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	user := &webAuthnUser{user: &model.User{ID: uuid.New(), Login: "alice"}}
+	auth := newSoftAuthenticator(t, "id.example.com")
+
+	stored := registerPasskey(t, rp, user, auth)
+	if string(stored.ID) != string(auth.credID) {
+		t.Fatalf("credential ID = %x, want %x", stored.ID, auth.credID)
+	}
+	user.creds = []webauthn.Credential{stored}
+
+	auth.signCount = 1
+	credential, err := loginPasskey(rp, user, auth, testOrigin)
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if credential.Authenticator.SignCount != 1 {
+		t.Fatalf("sign count = %d, want 1", credential.Authenticator.SignCount)
+	}
+}
+
+func TestWebAuthnSignCountRegression(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	user := &webAuthnUser{user: &model.User{ID: uuid.New(), Login: "alice"}}
+	auth := newSoftAuthenticator(t, "id.example.com")
+
+	auth.signCount = 5
+	stored := registerPasskey(t, rp, user, auth)
+	user.creds = []webauthn.Credential{stored}
+
+	// a clone still at the count of the registration
+	if _, err := loginPasskey(rp, user, auth, testOrigin); !errors.Is(err, apperror.ErrInvalidPasskey) {
+		t.Fatalf("same count: err = %v, want %v", err, apperror.ErrInvalidPasskey)
+	}
+
+	auth.signCount = 3
+	if _, err := loginPasskey(rp, user, auth, testOrigin); !errors.Is(err, apperror.ErrInvalidPasskey) {
+		t.Fatalf("lower count: err = %v, want %v", err, apperror.ErrInvalidPasskey)
+	}
+}
+
+func TestWebAuthnWrongOrigin(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	user := &webAuthnUser{user: &model.User{ID: uuid.New(), Login: "alice"}}
+	auth := newSoftAuthenticator(t, "id.example.com")
+
+	_, session, err := rp.BeginRegistration(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(auth.create(session, "https://evil.example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rp.CreateCredential(user, *session, parsed); !isOriginError(err) {
+		t.Fatalf("registration from another origin: err = %v", err)
+	}
+
+	user.creds = []webauthn.Credential{registerPasskey(t, rp, user, auth)}
+
+	auth.signCount = 1
+	if _, err := loginPasskey(rp, user, auth, "https://evil.example.com"); !isOriginError(err) {
+		t.Fatalf("login from another origin: err = %v", err)
+	}
+}
+
+func isOriginError(err error) bool {
+	var protocolErr *protocol.Error
+	return errors.As(err, &protocolErr) && protocolErr.Details == "Error validating origin"
+}
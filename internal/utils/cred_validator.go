@@ -1,6 +1,13 @@
 package utils
 
-import "github.com/kkonst40/isso/internal/config"
+import (
+	"net/mail"
+
+	"github.com/kkonst40/isso/internal/config"
+)
+
+// RFC 5321 section 4.5.3.1.3 path limit
+const maxEmailLength = 254
 
 type CredValidator struct {
 	loginChars     map[rune]struct{}
@@ -69,3 +76,13 @@ func (v *CredValidator) ValidatePwd(pwd string) bool {
 
 	return true
 }
+
+// ValidateEmail accepts a bare address, without a display name.
+func (v *CredValidator) ValidateEmail(email string) bool {
+	if len(email) > maxEmailLength {
+		return false
+	}
+
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
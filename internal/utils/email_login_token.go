@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// EmailLoginAudience keeps login links from being accepted as sessions and
+// the other way around.
+const EmailLoginAudience = "isso:email-login"
+
+// GenerateEmailLoginToken signs the token of a login link, jti is the
+// challenge the link uses up.
+func (p *JWTProvider) GenerateEmailLoginToken(userID, challengeID uuid.UUID, expiresAt time.Time) (string, error) {
+	claims := jwt.RegisteredClaims{
+		Issuer:    p.Cfg.JWT.Issuer,
+		Subject:   userID.String(),
+		Audience:  []string{EmailLoginAudience},
+		ID:        challengeID.String(),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+	}
+
+	return p.Sign(claims)
+}
+
+func (p *JWTProvider) ParseEmailLoginToken(tokenString string) (*jwt.RegisteredClaims, error) {
+	claims := &jwt.RegisteredClaims{}
+
+	_, err := jwt.ParseWithClaims(
+		tokenString,
+		claims,
+		p.keyFunc,
+		jwt.WithIssuer(p.Cfg.JWT.Issuer),
+		jwt.WithAudience(EmailLoginAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
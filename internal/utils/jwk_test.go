@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"crypto"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// signingAlgorithms are the asymmetric algorithms a signing key can have.
+var signingAlgorithms = []string{"RS256", "PS256", "ES256", "ES384", "ES512", "EdDSA"}
+
+func TestJWKRoundTrip(t *testing.T) {
+	for _, alg := range signingAlgorithms {
+		t.Run(alg, func(t *testing.T) {
+			generated, der, err := GenerateSigningKey(alg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			key, err := ParseSigningKey(alg, generated.ID, der)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			jwk, err := PublicJWK(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if jwk.Kid != generated.ID || jwk.Alg != alg || jwk.Use != "sig" {
+				t.Fatalf("got kid %q alg %q use %q", jwk.Kid, jwk.Alg, jwk.Use)
+			}
+
+			// the key ID is the thumbprint unless one was configured
+			if thumbprint, err := jwk.Thumbprint(); err != nil || thumbprint != generated.ID {
+				t.Fatalf("thumbprint %q, %v, want %q", thumbprint, err, generated.ID)
+			}
+
+			data, err := json.Marshal(JWKS{Keys: []JWK{jwk}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			set, err := ParseJWKS(string(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, ok := set.Key(key.ID)
+			if !ok {
+				t.Fatal("key not found by kid")
+			}
+
+			public, err := parsed.PublicKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !public.(interface{ Equal(crypto.PublicKey) bool }).Equal(key.Public) {
+				t.Fatal("public key changed in the round trip")
+			}
+
+			tokenString, err := signWith(key, jwt.RegisteredClaims{
+				Subject:   "alice",
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := jwt.Parse(tokenString, func(*jwt.Token) (any, error) { return public, nil }); err != nil {
+				t.Fatalf("token doesn't verify with the JWK: %v", err)
+			}
+		})
+	}
+}
+
+// RFC 7638 section 3.1.
+func TestJWKThumbprint(t *testing.T) {
+	jwk := JWK{
+		Kty: "RSA",
+		N: "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMs" +
+			"tn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91" +
+			"CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E:   "AQAB",
+		Alg: "RS256",
+		Kid: "2011-04-29",
+	}
+
+	thumbprint, err := jwk.Thumbprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"; thumbprint != want {
+		t.Fatalf("thumbprint = %q, want %q", thumbprint, want)
+	}
+}
+
+func TestJWTProviderJWKS(t *testing.T) {
+	provider := newTestJWTProvider(t)
+
+	key, _, err := GenerateSigningKey("ES256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider.SetKeys([]*SigningKey{key})
+
+	jwks := provider.JWKS()
+	// the HMAC secret is never published
+	if len(jwks.Keys) != 1 || jwks.Keys[0].Kid != key.ID {
+		t.Fatalf("got %+v, want only %s", jwks.Keys, key.ID)
+	}
+}
+
+func TestInvalidJWKs(t *testing.T) {
+	for _, data := range []string{
+		`{"keys":[]}`,
+		`{"keys":[{"kty":"oct","k":"c2VjcmV0"}]}`,
+		`{"keys":[{"kty":"RSA","n":"0vx7","e":"AQ"}]}`,
+		`{"keys":[{"kty":"RSA","n":"0vx7","e":"!"}]}`,
+		`{"keys":[{"kty":"EC","crv":"P-256","x":"AQ","y":"AQ"}]}`,
+		`{"keys":[{"kty":"EC","crv":"secp256k1","x":"AQ","y":"AQ"}]}`,
+		`{"keys":[{"kty":"OKP","crv":"Ed25519","x":"AQ"}]}`,
+		`{"keys":[{"kty":"OKP","crv":"X25519","x":"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"}]}`,
+		`not json`,
+	} {
+		if _, err := ParseJWKS(data); err == nil {
+			t.Errorf("ParseJWKS(%s) succeeded", data)
+		}
+	}
+}
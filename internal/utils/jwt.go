@@ -1,6 +1,12 @@
 package utils
 
 import (
+	"crypto"
+	_ "crypto/sha512"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -13,54 +19,279 @@ type UserClaims struct {
 	ID       uuid.UUID `json:"id"`
 	UserName string    `json:"userName"`
 	TokenID  uuid.UUID `json:"tokenId"`
+	ClientID string    `json:"client_id,omitempty"`
+	Scope    string    `json:"scope,omitempty"`
+	Act      *Actor    `json:"act,omitempty"`
+	// OpenID Connect Core section 2, copied from the login into every token
+	// of the session
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+	AMR      []string         `json:"amr,omitempty"`
+	ACR      string           `json:"acr,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Actor is the act claim of a delegated token, RFC 8693 section 4.1.
+// Act holds the previous actor of a delegation chain.
+type Actor struct {
+	Subject string `json:"sub"`
+	Act     *Actor `json:"act,omitempty"`
+}
+
+// Machine reports whether the token was issued to a client for itself,
+// such tokens have no user.
+func (c *UserClaims) Machine() bool {
+	return c.ID == uuid.Nil && c.ClientID != "" && c.Subject == c.ClientID
+}
+
+// Authentication returns how the session of the token was authenticated,
+// zero Time for tokens issued before auth_time was added.
+func (c *UserClaims) Authentication() model.Authentication {
+	auth := model.Authentication{AMR: c.AMR, ACR: c.ACR}
+	if c.AuthTime != nil {
+		auth.Time = c.AuthTime.Time
+	}
+
+	return auth
+}
+
+type IDTokenClaims struct {
+	Nonce    string           `json:"nonce,omitempty"`
+	AtHash   string           `json:"at_hash,omitempty"`
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+	AMR      []string         `json:"amr,omitempty"`
+	ACR      string           `json:"acr,omitempty"`
+	// only with the email scope
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
 	jwt.RegisteredClaims
 }
 
 type JWTProvider struct {
-	Cfg *config.Config
+	Cfg  *config.Config
+	ring *KeyRing
 }
 
-func NewJWTProvider(cfg *config.Config) *JWTProvider {
+// NewJWTProvider puts the configured secret and key file into the key ring,
+// rotated keys are added later with SetKeys.
+func NewJWTProvider(cfg *config.Config) (*JWTProvider, error) {
+	var legacy *SigningKey
+	var static []*SigningKey
+
+	// tokens issued before kid was introduced are signed with the secret
+	if cfg.JWT.SecretKey != "" {
+		hmacKey, err := NewHMACKey(jwt.SigningMethodHS256.Alg(), []byte(cfg.JWT.SecretKey))
+		if err != nil {
+			return nil, err
+		}
+		legacy = hmacKey
+		static = append(static, hmacKey)
+	}
+
+	alg := cfg.JWT.SigningAlg
+	if alg != "" && alg != jwt.SigningMethodHS256.Alg() && cfg.JWT.SigningKeyFile != "" {
+		key, err := LoadAsymmetricKey(alg, cfg.JWT.SigningKeyID, cfg.JWT.SigningKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		// preferred over the secret until a rotated key becomes active
+		key.NotBefore = time.Unix(1, 0)
+		static = append(static, key)
+	}
+
 	return &JWTProvider{
-		Cfg: cfg,
+		Cfg:  cfg,
+		ring: NewKeyRing(legacy, static...),
+	}, nil
+}
+
+func (p *JWTProvider) SetKeys(keys []*SigningKey) {
+	p.ring.SetDynamic(keys)
+}
+
+func (p *JWTProvider) CanSign() bool {
+	return p.ring.Current() != nil
+}
+
+// Generate issues an access token for isso's own first-party session.
+func (p *JWTProvider) Generate(user *model.User, auth model.Authentication) (string, error) {
+	return p.GenerateForClient(user, "", "", "", p.AccessTTL(), auth)
+}
+
+// GenerateForClient issues an access token with the client as its audience,
+// jti is the refresh token family the token was issued with.
+func (p *JWTProvider) GenerateForClient(
+	user *model.User,
+	clientID, jti, scope string,
+	ttl time.Duration,
+	auth model.Authentication,
+) (string, error) {
+	audience := clientID
+	if audience == "" {
+		audience = p.Cfg.JWT.Audience
 	}
+
+	claims := UserClaims{
+		ID:       user.ID,
+		TokenID:  user.TokenID,
+		UserName: user.Login,
+		ClientID: clientID,
+		Scope:    scope,
+		AuthTime: authTime(auth),
+		AMR:      auth.AMR,
+		ACR:      auth.ACR,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    p.Cfg.JWT.Issuer,
+			Subject:   user.ID.String(),
+			Audience:  []string{audience},
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	return p.Sign(claims)
+}
+
+// ForwardAuthAudience is the audience of forward-auth tokens, only the
+// forward-auth endpoint accepts it.
+func (p *JWTProvider) ForwardAuthAudience() string {
+	return strings.TrimSuffix(p.Cfg.JWT.Issuer, "/") + "/forward-auth"
 }
 
-func (p *JWTProvider) Generate(user *model.User) (string, error) {
+// GenerateForwardAuth issues the token of the forward-auth cookie. It only
+// names the user, so apps that see the cookie can't call APIs with it.
+// jti is the refresh token family, it is revoked together with the session.
+func (p *JWTProvider) GenerateForwardAuth(user *model.User, jti string, ttl time.Duration) (string, error) {
 	claims := UserClaims{
 		ID:       user.ID,
 		TokenID:  user.TokenID,
 		UserName: user.Login,
 		RegisteredClaims: jwt.RegisteredClaims{
-			Issuer:   p.Cfg.JWT.Issuer,
-			Audience: []string{p.Cfg.JWT.Audience},
-			ExpiresAt: jwt.NewNumericDate(
-				time.Now().Add(time.Duration(p.Cfg.JWT.ExpireDays) * 24 * time.Hour),
-			),
-			IssuedAt: jwt.NewNumericDate(time.Now()),
+			Issuer:    p.Cfg.JWT.Issuer,
+			Subject:   user.ID.String(),
+			Audience:  []string{p.ForwardAuthAudience()},
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	return p.Sign(claims)
+}
+
+// GenerateIDToken issues an OpenID Connect ID token for the client, at_hash
+// binds it to the access token issued in the same response.
+func (p *JWTProvider) GenerateIDToken(
+	user *model.User,
+	clientID, scope, nonce, accessToken string,
+	auth model.Authentication,
+) (string, error) {
+	key := p.ring.Current()
+	if key == nil {
+		return "", errors.New("no active signing key")
+	}
+
+	claims := IDTokenClaims{
+		Nonce:    nonce,
+		AtHash:   leftHalfHash(key.Method, accessToken),
+		AuthTime: authTime(auth),
+		AMR:      auth.AMR,
+		ACR:      auth.ACR,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    p.Cfg.JWT.Issuer,
+			Subject:   user.ID.String(),
+			Audience:  []string{clientID},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(p.AccessTTL())),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
+	if HasScope(scope, ScopeEmail) && user.Email != nil {
+		claims.Email = *user.Email
+		claims.EmailVerified = &user.EmailVerified
+	}
+
+	return signWith(key, claims)
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+// Sign signs any claims with the current signing key and sets the kid header.
+func (p *JWTProvider) Sign(claims jwt.Claims) (string, error) {
+	key := p.ring.Current()
+	if key == nil {
+		return "", errors.New("no active signing key")
+	}
 
-	return token.SignedString([]byte(p.Cfg.JWT.SecretKey))
+	return signWith(key, claims)
 }
 
-func (p *JWTProvider) ValidateToken(tokenString string) (*UserClaims, error) {
-	claims := &UserClaims{}
+func (p *JWTProvider) AccessTTL() time.Duration {
+	return time.Duration(p.Cfg.JWT.AccessExpireMinutes) * time.Minute
+}
 
-	token, err := jwt.ParseWithClaims(
-		tokenString,
-		claims,
-		func(token *jwt.Token) (any, error) {
-			if token.Method != jwt.SigningMethodHS256 {
-				return nil, jwt.ErrSignatureInvalid
-			}
-			return []byte(p.Cfg.JWT.SecretKey), nil
+func (p *JWTProvider) RefreshTTL() time.Duration {
+	return time.Duration(p.Cfg.JWT.ExpireDays) * 24 * time.Hour
+}
+
+// GenerateClientToken issues a client_credentials token for isso's own API.
+func (p *JWTProvider) GenerateClientToken(clientID, scope string, ttl time.Duration) (string, error) {
+	claims := UserClaims{
+		ClientID: clientID,
+		Scope:    scope,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    p.Cfg.JWT.Issuer,
+			Subject:   clientID,
+			Audience:  []string{p.Cfg.JWT.Audience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
+	}
+
+	return p.Sign(claims)
+}
+
+// GenerateDelegated issues a token for the audience on behalf of the subject
+// token's user, the actor client is recorded in the act claim. The token
+// keeps the subject's TokenID and jti, so it is revoked together with it.
+func (p *JWTProvider) GenerateDelegated(subject *UserClaims, actorID, audience, scope string, ttl time.Duration) (string, error) {
+	claims := UserClaims{
+		ID:       subject.ID,
+		UserName: subject.UserName,
+		TokenID:  subject.TokenID,
+		ClientID: actorID,
+		Scope:    scope,
+		Act: &Actor{
+			Subject: actorID,
+			Act:     subject.Act,
+		},
+		AuthTime: subject.AuthTime,
+		AMR:      subject.AMR,
+		ACR:      subject.ACR,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    p.Cfg.JWT.Issuer,
+			Subject:   subject.Subject,
+			Audience:  []string{audience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        subject.RegisteredClaims.ID,
+		},
+	}
+
+	return p.Sign(claims)
+}
+
+// ValidateToken accepts tokens for any of the audiences, with no audiences
+// given the token may belong to any client.
+func (p *JWTProvider) ValidateToken(tokenString string, audiences ...string) (*UserClaims, error) {
+	claims := &UserClaims{}
+
+	opts := []jwt.ParserOption{
 		jwt.WithIssuer(p.Cfg.JWT.Issuer),
-		jwt.WithAudience(p.Cfg.JWT.Audience),
-	)
+		jwt.WithExpirationRequired(),
+	}
+	if len(audiences) > 0 {
+		opts = append(opts, jwt.WithAudience(audiences...))
+	}
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, p.keyFunc, opts...)
 
 	if err != nil {
 		return nil, err
@@ -72,3 +303,87 @@ func (p *JWTProvider) ValidateToken(tokenString string) (*UserClaims, error) {
 
 	return claims, nil
 }
+
+// JWKS returns the public keys other services can verify our tokens with.
+func (p *JWTProvider) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range p.ring.Verification() {
+		if key.Symmetric() {
+			continue
+		}
+
+		jwk, err := PublicJWK(key)
+		if err != nil {
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	return jwks
+}
+
+// Algorithms lists the algorithms of the keys tokens may be signed with.
+func (p *JWTProvider) Algorithms() []string {
+	algs := []string{}
+	for _, key := range p.ring.Verification() {
+		if !slices.Contains(algs, key.Method.Alg()) {
+			algs = append(algs, key.Method.Alg())
+		}
+	}
+
+	return algs
+}
+
+func (p *JWTProvider) keyFunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, ok := p.ring.Get(kid)
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown kid %q", jwt.ErrTokenUnverifiable, kid)
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, jwt.ErrSignatureInvalid
+	}
+
+	return key.Public, nil
+}
+
+func authTime(auth model.Authentication) *jwt.NumericDate {
+	if auth.Time.IsZero() {
+		return nil
+	}
+
+	return jwt.NewNumericDate(auth.Time)
+}
+
+func signWith(key *SigningKey, claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.Private)
+}
+
+// leftHalfHash computes at_hash/c_hash values with the hash of the JWS
+// algorithm, OpenID Connect Core section 3.1.3.6.
+func leftHalfHash(method jwt.SigningMethod, value string) string {
+	hash := crypto.SHA256
+	switch m := method.(type) {
+	case *jwt.SigningMethodHMAC:
+		hash = m.Hash
+	case *jwt.SigningMethodRSA:
+		hash = m.Hash
+	case *jwt.SigningMethodRSAPSS:
+		hash = m.Hash
+	case *jwt.SigningMethodECDSA:
+		hash = m.Hash
+	case *jwt.SigningMethodEd25519:
+		hash = crypto.SHA512
+	}
+
+	h := hash.New()
+	h.Write([]byte(value))
+	sum := h.Sum(nil)
+
+	return b64(sum[:len(sum)/2])
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// KeyRing holds every key tokens may be verified with and picks the one new
+// tokens are signed with. Static keys come from the config, dynamic keys are
+// managed by rotation and replaced as a whole on reload.
+type KeyRing struct {
+	mu      sync.RWMutex
+	legacy  *SigningKey
+	static  []*SigningKey
+	dynamic []*SigningKey
+}
+
+func NewKeyRing(legacy *SigningKey, static ...*SigningKey) *KeyRing {
+	return &KeyRing{
+		legacy: legacy,
+		static: static,
+	}
+}
+
+func (r *KeyRing) SetDynamic(keys []*SigningKey) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.dynamic = keys
+}
+
+// Current returns the active key with the latest not-before.
+func (r *KeyRing) Current() *SigningKey {
+	now := time.Now()
+
+	var current *SigningKey
+	for _, key := range r.all() {
+		if !key.Active(now) || now.Before(key.NotBefore) {
+			continue
+		}
+		if current == nil || key.NotBefore.After(current.NotBefore) {
+			current = key
+		}
+	}
+
+	return current
+}
+
+// Get looks up a verification key by kid, the empty kid means a token
+// issued before kids were introduced.
+func (r *KeyRing) Get(kid string) (*SigningKey, bool) {
+	if kid == "" {
+		return r.legacy, r.legacy != nil
+	}
+
+	now := time.Now()
+	for _, key := range r.all() {
+		if key.ID == kid && key.Active(now) {
+			return key, true
+		}
+	}
+
+	return nil, false
+}
+
+// Verification returns keys which are not retired yet, including keys
+// which are published ahead of their not-before.
+func (r *KeyRing) Verification() []*SigningKey {
+	now := time.Now()
+
+	keys := []*SigningKey{}
+	for _, key := range r.all() {
+		if key.Active(now) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].NotBefore.After(keys[j].NotBefore)
+	})
+
+	return keys
+}
+
+func (r *KeyRing) all() []*SigningKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := make([]*SigningKey, 0, len(r.static)+len(r.dynamic))
+	keys = append(keys, r.static...)
+	keys = append(keys, r.dynamic...)
+
+	return keys
+}
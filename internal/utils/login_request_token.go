@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// LoginRequestAudience keeps login request tokens from being accepted as
+// anything else.
+const LoginRequestAudience = "isso:login-request"
+
+// GenerateLoginRequestToken records that an authorization request asked
+// for a new login now, the request is sent back with the token once the
+// user logged in.
+func (p *JWTProvider) GenerateLoginRequestToken(ttl time.Duration) (string, error) {
+	claims := jwt.RegisteredClaims{
+		Issuer:    p.Cfg.JWT.Issuer,
+		Audience:  []string{LoginRequestAudience},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+	}
+
+	return p.Sign(claims)
+}
+
+// ParseLoginRequestToken returns when the login was requested.
+func (p *JWTProvider) ParseLoginRequestToken(tokenString string) (time.Time, error) {
+	claims := &jwt.RegisteredClaims{}
+
+	_, err := jwt.ParseWithClaims(
+		tokenString,
+		claims,
+		p.keyFunc,
+		jwt.WithIssuer(p.Cfg.JWT.Issuer),
+		jwt.WithAudience(LoginRequestAudience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if claims.IssuedAt == nil {
+		return time.Time{}, jwt.ErrTokenRequiredClaimMissing
+	}
+
+	return claims.IssuedAt.Time, nil
+}
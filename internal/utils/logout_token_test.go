@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kkonst40/isso/internal/config"
+	"github.com/kkonst40/isso/internal/model"
+)
+
+func newTestJWTProvider(t *testing.T) *JWTProvider {
+	t.Helper()
+
+	provider, err := NewJWTProvider(&config.Config{
+		JWT: config.JWTConfig{
+			SecretKey:           "test-secret-test-secret-test-secret",
+			Issuer:              "https://id.example.com",
+			Audience:            "isso",
+			AccessExpireMinutes: 5,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return provider
+}
+
+func TestParseIDTokenHint(t *testing.T) {
+	provider := newTestJWTProvider(t)
+	user := &model.User{ID: uuid.New(), Login: "alice", TokenID: uuid.New()}
+	auth := model.Authentication{Time: time.Now(), AMR: []string{"pwd"}}
+
+	idToken, err := provider.GenerateIDToken(user, "app", "openid", "nonce", "access", auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hint, err := provider.ParseIDTokenHint(idToken)
+	if err != nil {
+		t.Fatalf("ID token rejected: %v", err)
+	}
+	if hint.Subject != user.ID.String() || len(hint.Audience) != 1 || hint.Audience[0] != "app" {
+		t.Fatalf("unexpected claims: sub %q aud %v", hint.Subject, hint.Audience)
+	}
+
+	session, err := provider.Generate(user, auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientAccess, err := provider.GenerateForClient(user, "app", uuid.NewString(), "openid", time.Minute, auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	machine, err := provider.GenerateClientToken("app", "users:read", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logout, err := provider.GenerateLogoutToken(user.ID, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	emailLogin, err := provider.GenerateEmailLoginToken(user.ID, uuid.New(), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := newTestJWTProvider(t)
+	other.Cfg.JWT.Issuer = "https://other.example.com"
+	foreign, err := other.GenerateIDToken(user, "app", "openid", "", "access", auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rejected := map[string]string{
+		"session access token": session,
+		"client access token":  clientAccess,
+		"client token":         machine,
+		"logout token":         logout,
+		"email login token":    emailLogin,
+		"other issuer":         foreign,
+		"garbage":              "not.a.jwt",
+	}
+	for name, token := range rejected {
+		if _, err := provider.ParseIDTokenHint(token); err == nil {
+			t.Errorf("%s accepted as id_token_hint", name)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/kkonst40/isso/internal/config"
+)
+
+type Mail struct {
+	To      string
+	Subject string
+	// plain text
+	Body string
+}
+
+// Mailer delivers mails to users, the implementation is picked by
+// NewMailer.
+type Mailer interface {
+	Send(ctx context.Context, mail Mail) error
+}
+
+func NewMailer(cfg config.MailConfig) Mailer {
+	switch {
+	case cfg.SMTPAddr != "":
+		return NewSMTPMailer(cfg)
+	case cfg.Dir != "":
+		return NewFileMailer(cfg.From, cfg.Dir)
+	default:
+		log.Println("Mail delivery is not configured, mails are only kept in memory")
+		return NewMemoryMailer()
+	}
+}
+
+// SMTPMailer sends mails through a relay, with PLAIN auth when a user is
+// configured.
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func NewSMTPMailer(cfg config.MailConfig) *SMTPMailer {
+	mailer := &SMTPMailer{
+		addr: cfg.SMTPAddr,
+		from: cfg.From,
+	}
+	if cfg.SMTPUser != "" {
+		host, _, _ := net.SplitHostPort(cfg.SMTPAddr)
+		mailer.auth = smtp.PlainAuth("", cfg.SMTPUser, cfg.SMTPPassword, host)
+	}
+
+	return mailer
+}
+
+// Send does what smtp.SendMail does, on a connection bounded by ctx.
+func (m *SMTPMailer) Send(ctx context.Context, mail Mail) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", m.addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	host, _, _ := net.SplitHostPort(m.addr)
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if m.auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		if err := client.Auth(m.auth); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(m.from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(mail.To); err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(formatMail(m.from, mail)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// FileMailer writes every mail to its own .eml file, for development and
+// tests without a mail server.
+type FileMailer struct {
+	from string
+	dir  string
+}
+
+func NewFileMailer(from, dir string) *FileMailer {
+	return &FileMailer{
+		from: from,
+		dir:  dir,
+	}
+}
+
+func (m *FileMailer) Send(ctx context.Context, mail Mail) error {
+	if err := os.MkdirAll(m.dir, 0o700); err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), hex.EncodeToString(suffix))
+
+	return os.WriteFile(filepath.Join(m.dir, name), formatMail(m.from, mail), 0o600)
+}
+
+const (
+	mailQueueSize   = 100
+	mailSendTimeout = 30 * time.Second
+)
+
+var errMailQueueFull = errors.New("mail queue is full")
+
+// AsyncMailer hands mails to a background sender, so a slow mail server
+// doesn't hold up requests. Mails that fail are logged and dropped.
+type AsyncMailer struct {
+	next  Mailer
+	queue chan Mail
+}
+
+func NewAsyncMailer(next Mailer) *AsyncMailer {
+	return &AsyncMailer{
+		next:  next,
+		queue: make(chan Mail, mailQueueSize),
+	}
+}
+
+// Send only fails when the queue is full.
+func (m *AsyncMailer) Send(ctx context.Context, mail Mail) error {
+	select {
+	case m.queue <- mail:
+		return nil
+	default:
+		return errMailQueueFull
+	}
+}
+
+// Run sends queued mails until ctx is done.
+func (m *AsyncMailer) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case mail := <-m.queue:
+			sendCtx, cancel := context.WithTimeout(ctx, mailSendTimeout)
+			if err := m.next.Send(sendCtx, mail); err != nil {
+				log.Println("Mail sending error", "error", err.Error())
+			}
+			cancel()
+		}
+	}
+}
+
+// memoryMailerLimit keeps a forgotten MemoryMailer from growing forever
+const memoryMailerLimit = 100
+
+// MemoryMailer keeps the last sent mails, used when no mail delivery is
+// configured and in tests.
+type MemoryMailer struct {
+	mu   sync.Mutex
+	sent []Mail
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Send(ctx context.Context, mail Mail) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.sent) == memoryMailerLimit {
+		m.sent = m.sent[1:]
+	}
+	m.sent = append(m.sent, mail)
+
+	return nil
+}
+
+// Sent returns the kept mails, the oldest first.
+func (m *MemoryMailer) Sent() []Mail {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Mail(nil), m.sent...)
+}
+
+func formatMail(from string, mail Mail) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", mail.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", mail.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(mail.Body)
+
+	return buf.Bytes()
+}
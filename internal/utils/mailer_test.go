@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAsyncMailerDelivers(t *testing.T) {
+	memory := NewMemoryMailer()
+	mailer := NewAsyncMailer(memory)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go mailer.Run(ctx)
+
+	if err := mailer.Send(ctx, Mail{To: "a@example.com", Subject: "Вход", Body: "code"}); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for len(memory.Sent()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("mail was not delivered")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if sent := memory.Sent()[0]; sent.To != "a@example.com" || sent.Body != "code" {
+		t.Fatalf("unexpected mail %+v", sent)
+	}
+}
+
+func TestAsyncMailerFullQueue(t *testing.T) {
+	// not running, nothing drains the queue
+	mailer := NewAsyncMailer(NewMemoryMailer())
+
+	for i := 0; i < mailQueueSize; i++ {
+		if err := mailer.Send(context.Background(), Mail{To: "a@example.com"}); err != nil {
+			t.Fatalf("mail %d: %v", i, err)
+		}
+	}
+
+	if err := mailer.Send(context.Background(), Mail{To: "a@example.com"}); err == nil {
+		t.Fatal("send into a full queue succeeded")
+	}
+}
+
+func TestFormatMailEncodesSubject(t *testing.T) {
+	msg := string(formatMail("isso@example.com", Mail{To: "a@example.com", Subject: "Вход в isso", Body: "текст"}))
+
+	if !strings.Contains(msg, "Subject: =?utf-8?q?") {
+		t.Fatalf("subject is not encoded:\n%s", msg)
+	}
+	if !strings.HasSuffix(msg, "\r\n\r\nтекст") {
+		t.Fatalf("body is not after the headers:\n%s", msg)
+	}
+}
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// MFAAudience keeps MFA tokens from being accepted as sessions and the other
+// way around.
+const MFAAudience = "isso:mfa"
+
+const mfaTokenTTL = 5 * time.Minute
+
+// MFATokenClaims describe a login waiting for its second factor, AMR lists
+// the methods the user already passed.
+type MFATokenClaims struct {
+	AMR []string `json:"amr"`
+	jwt.RegisteredClaims
+}
+
+func (p *JWTProvider) GenerateMFAToken(userID uuid.UUID, amr []string) (string, error) {
+	claims := MFATokenClaims{
+		AMR: amr,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    p.Cfg.JWT.Issuer,
+			Subject:   userID.String(),
+			Audience:  []string{MFAAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(mfaTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	return p.Sign(claims)
+}
+
+func (p *JWTProvider) ParseMFAToken(tokenString string) (*MFATokenClaims, error) {
+	claims := &MFATokenClaims{}
+
+	_, err := jwt.ParseWithClaims(
+		tokenString,
+		claims,
+		p.keyFunc,
+		jwt.WithIssuer(p.Cfg.JWT.Issuer),
+		jwt.WithAudience(MFAAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var errMalformedPHC = errors.New("malformed PHC string")
+
+// phcHash is a parsed PHC string:
+// $<id>[$v=<version>][$<param>=<value>,...]$<salt>$<hash>
+// Salt and hash are B64, standard base64 without padding.
+type phcHash struct {
+	ID      string
+	Version int
+	Params  map[string]string
+	Salt    []byte
+	Hash    []byte
+}
+
+func parsePHC(encoded string) (*phcHash, error) {
+	fields := strings.Split(encoded, "$")
+	if len(fields) < 4 || fields[0] != "" || fields[1] == "" {
+		return nil, errMalformedPHC
+	}
+
+	phc := &phcHash{
+		ID:     fields[1],
+		Params: map[string]string{},
+	}
+	fields = fields[2:]
+
+	if version, ok := strings.CutPrefix(fields[0], "v="); ok {
+		v, err := strconv.Atoi(version)
+		if err != nil {
+			return nil, errMalformedPHC
+		}
+		phc.Version = v
+		fields = fields[1:]
+	}
+
+	if len(fields) == 3 {
+		for _, pair := range strings.Split(fields[0], ",") {
+			key, val, ok := strings.Cut(pair, "=")
+			if !ok {
+				return nil, errMalformedPHC
+			}
+			phc.Params[key] = val
+		}
+		fields = fields[1:]
+	}
+
+	if len(fields) != 2 {
+		return nil, errMalformedPHC
+	}
+
+	var err error
+	if phc.Salt, err = base64.RawStdEncoding.DecodeString(fields[0]); err != nil {
+		return nil, errMalformedPHC
+	}
+	if phc.Hash, err = base64.RawStdEncoding.DecodeString(fields[1]); err != nil {
+		return nil, errMalformedPHC
+	}
+
+	return phc, nil
+}
+
+// intParam returns the named parameter, ok is false when it is missing or
+// not a positive integer.
+func (p *phcHash) intParam(name string) (int, bool) {
+	val, err := strconv.Atoi(p.Params[name])
+	if err != nil || val <= 0 {
+		return 0, false
+	}
+
+	return val, true
+}
+
+// formatPHC builds a PHC string, params is the joined parameter list.
+func formatPHC(id string, version int, params string, salt, hash []byte) string {
+	var b strings.Builder
+	b.WriteString("$" + id)
+	if version != 0 {
+		b.WriteString("$v=" + strconv.Itoa(version))
+	}
+	if params != "" {
+		b.WriteString("$" + params)
+	}
+	b.WriteString("$" + base64.RawStdEncoding.EncodeToString(salt))
+	b.WriteString("$" + base64.RawStdEncoding.EncodeToString(hash))
+
+	return b.String()
+}
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFormatPHCRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      string
+		version int
+		params  string
+		want    string
+	}{
+		{
+			name:    "version and params",
+			id:      "argon2id",
+			version: 19,
+			params:  "m=65536,t=2,p=1",
+			want:    "$argon2id$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$aGFzaA",
+		},
+		{
+			name:   "params only",
+			id:     "scrypt",
+			params: "ln=15,r=8,p=1",
+			want:   "$scrypt$ln=15,r=8,p=1$c29tZXNhbHQ$aGFzaA",
+		},
+		{
+			name: "salt and hash only",
+			id:   "custom",
+			want: "$custom$c29tZXNhbHQ$aGFzaA",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := formatPHC(tt.id, tt.version, tt.params, []byte("somesalt"), []byte("hash"))
+			if encoded != tt.want {
+				t.Fatalf("formatPHC = %q, want %q", encoded, tt.want)
+			}
+
+			phc, err := parsePHC(encoded)
+			if err != nil {
+				t.Fatalf("parsePHC: %v", err)
+			}
+			if phc.ID != tt.id || phc.Version != tt.version {
+				t.Fatalf("got id %q version %d", phc.ID, phc.Version)
+			}
+			if !bytes.Equal(phc.Salt, []byte("somesalt")) || !bytes.Equal(phc.Hash, []byte("hash")) {
+				t.Fatalf("got salt %q hash %q", phc.Salt, phc.Hash)
+			}
+			if tt.params == "" && len(phc.Params) != 0 {
+				t.Fatalf("got params %v", phc.Params)
+			}
+		})
+	}
+}
+
+func TestParsePHCParams(t *testing.T) {
+	phc, err := parsePHC("$argon2id$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$aGFzaA")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]int{"m": 65536, "t": 2, "p": 1} {
+		if got, ok := phc.intParam(name); !ok || got != want {
+			t.Fatalf("%s = %d, %v, want %d", name, got, ok, want)
+		}
+	}
+	if _, ok := phc.intParam("x"); ok {
+		t.Fatal("missing param reported as present")
+	}
+}
+
+func TestParsePHCMalformed(t *testing.T) {
+	for _, encoded := range []string{
+		"",
+		"$",
+		"$$",
+		"argon2id",
+		"$argon2id",
+		"$argon2id$",
+		"$argon2id$c29tZXNhbHQ",
+		"argon2id$v=19$m=1,t=1,p=1$c29tZXNhbHQ$aGFzaA",
+		"$$v=19$m=1,t=1,p=1$c29tZXNhbHQ$aGFzaA",
+		"$argon2id$v=x$m=1,t=1,p=1$c29tZXNhbHQ$aGFzaA",
+		"$argon2id$v=19$m$c29tZXNhbHQ$aGFzaA",
+		"$argon2id$v=19$m=1,t=1,p=1$c29tZXNhbHQ$aGFzaA$extra",
+		"$argon2id$v=19$m=1,t=1,p=1$c29tZX*hbHQ$aGFzaA",
+		"$argon2id$v=19$m=1,t=1,p=1$c29tZXNhbHQ$aGFzaA==",
+		"$argon2id$v=19$m=1,t=1,p=1$c29tZXNhbHQ",
+	} {
+		if _, err := parsePHC(encoded); err == nil {
+			t.Errorf("parsePHC(%q) succeeded", encoded)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"strings"
+	"testing"
+)
+
+// RFC 7636 Appendix B.
+const (
+	rfcCodeVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	rfcCodeChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		ok        bool
+	}{
+		{name: "RFC 7636 example", verifier: rfcCodeVerifier, challenge: rfcCodeChallenge, ok: true},
+		{name: "other verifier", verifier: strings.Repeat("a", 43), challenge: rfcCodeChallenge},
+		{name: "empty verifier", challenge: rfcCodeChallenge},
+		{name: "empty challenge", verifier: rfcCodeVerifier},
+		// the plain method is not supported
+		{name: "plain", verifier: rfcCodeVerifier, challenge: rfcCodeVerifier},
+		{name: "padded challenge", verifier: rfcCodeVerifier, challenge: rfcCodeChallenge + "="},
+		{name: "short verifier", verifier: rfcCodeVerifier[:42], challenge: challengeOf(rfcCodeVerifier[:42])},
+		{name: "long verifier", verifier: strings.Repeat("a", 129), challenge: challengeOf(strings.Repeat("a", 129))},
+		{name: "shortest verifier", verifier: strings.Repeat("a", 43), challenge: challengeOf(strings.Repeat("a", 43)), ok: true},
+		{name: "longest verifier", verifier: strings.Repeat("a", 128), challenge: challengeOf(strings.Repeat("a", 128)), ok: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ok := VerifyPKCE(tt.verifier, tt.challenge); ok != tt.ok {
+				t.Fatalf("VerifyPKCE = %v, want %v", ok, tt.ok)
+			}
+		})
+	}
+}
+
+func challengeOf(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return b64(sum[:])
+}
@@ -1,28 +1,93 @@
 package utils
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"fmt"
 
-type PasswordHandler struct{}
+	"github.com/kkonst40/isso/internal/config"
+)
 
-func NewPasswordHandler() *PasswordHandler {
-	return &PasswordHandler{}
+// PasswordHasher makes and checks PHC formatted hashes of one algorithm.
+type PasswordHasher interface {
+	// ID is the algorithm identifier of the PHC string
+	ID() string
+	Hash(password string) (string, error)
+	Verify(password, encoded string) bool
+	// Outdated reports a hash made with other parameters than the current
+	// ones
+	Outdated(encoded string) bool
 }
 
-func (h *PasswordHandler) GeneratePwdHash(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword(
-		[]byte(password),
-		bcrypt.DefaultCost,
-	)
-	if err != nil {
-		return "", err
+// PasswordHandler hashes with the configured algorithm and verifies hashes
+// of every supported one, so the algorithm can be changed without locking
+// anyone out.
+type PasswordHandler struct {
+	hasher  PasswordHasher
+	hashers map[string]PasswordHasher
+}
+
+func NewPasswordHandler(cfg config.PasswordConfig) (*PasswordHandler, error) {
+	hashers := map[string]PasswordHasher{}
+	for _, hasher := range []PasswordHasher{
+		NewArgon2idHasher(cfg.Argon2Memory, cfg.Argon2Iterations, cfg.Argon2Parallelism),
+		NewBcryptHasher(cfg.BcryptCost),
+		NewScryptHasher(cfg.ScryptLogN, cfg.ScryptR, cfg.ScryptP),
+	} {
+		hashers[hasher.ID()] = hasher
 	}
-	return string(hash), nil
+
+	alg := cfg.Algorithm
+	switch alg {
+	case "":
+		alg = "argon2id"
+	case "bcrypt":
+		alg = "bcrypt-sha256"
+	}
+
+	hasher, ok := hashers[alg]
+	if !ok {
+		return nil, fmt.Errorf("unsupported password hash algorithm: %s", cfg.Algorithm)
+	}
+
+	return &PasswordHandler{
+		hasher:  hasher,
+		hashers: hashers,
+	}, nil
+}
+
+func (h *PasswordHandler) GeneratePwdHash(password string) (string, error) {
+	return h.hasher.Hash(password)
 }
 
 func (h *PasswordHandler) VerifyPwd(password string, passwordHash string) bool {
-	err := bcrypt.CompareHashAndPassword(
-		[]byte(passwordHash),
-		[]byte(password),
-	)
-	return err == nil
+	hasher, ok := h.hasherFor(passwordHash)
+	if !ok {
+		return false
+	}
+
+	return hasher.Verify(password, passwordHash)
+}
+
+// NeedsRehash reports a hash not made by the configured algorithm with its
+// current parameters. Only call it after VerifyPwd succeeded.
+func (h *PasswordHandler) NeedsRehash(passwordHash string) bool {
+	hasher, ok := h.hasherFor(passwordHash)
+	if !ok || hasher != h.hasher {
+		return true
+	}
+
+	return hasher.Outdated(passwordHash)
+}
+
+func (h *PasswordHandler) hasherFor(passwordHash string) (PasswordHasher, bool) {
+	if isBcryptMCF(passwordHash) {
+		return h.hashers["bcrypt-sha256"], true
+	}
+
+	phc, err := parsePHC(passwordHash)
+	if err != nil {
+		return nil, false
+	}
+
+	hasher, ok := h.hashers[phc.ID]
+	return hasher, ok
 }
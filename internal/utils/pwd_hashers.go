@@ -0,0 +1,306 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	pwdSaltLength = 16
+	pwdKeyLength  = 32
+)
+
+func newPwdSalt() ([]byte, error) {
+	salt := make([]byte, pwdSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	return salt, nil
+}
+
+// Argon2idHasher makes $argon2id$v=19$m=<KiB>,t=<passes>,p=<lanes> hashes,
+// the defaults are OWASP's minimum.
+type Argon2idHasher struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+func NewArgon2idHasher(memory, iterations, parallelism int) *Argon2idHasher {
+	if memory <= 0 {
+		memory = 19 * 1024
+	}
+	if iterations <= 0 {
+		iterations = 2
+	}
+	if parallelism <= 0 || parallelism > 255 {
+		parallelism = 1
+	}
+
+	return &Argon2idHasher{
+		memory:      uint32(memory),
+		iterations:  uint32(iterations),
+		parallelism: uint8(parallelism),
+	}
+}
+
+func (h *Argon2idHasher) ID() string {
+	return "argon2id"
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt, err := newPwdSalt()
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.iterations, h.memory, h.parallelism, pwdKeyLength)
+	params := fmt.Sprintf("m=%d,t=%d,p=%d", h.memory, h.iterations, h.parallelism)
+
+	return formatPHC(h.ID(), argon2.Version, params, salt, key), nil
+}
+
+func (h *Argon2idHasher) Verify(password, encoded string) bool {
+	phc, m, t, p, ok := h.parse(encoded)
+	if !ok {
+		return false
+	}
+
+	key := argon2.IDKey([]byte(password), phc.Salt, uint32(t), uint32(m), uint8(p), uint32(len(phc.Hash)))
+
+	return subtle.ConstantTimeCompare(key, phc.Hash) == 1
+}
+
+func (h *Argon2idHasher) Outdated(encoded string) bool {
+	phc, m, t, p, ok := h.parse(encoded)
+	if !ok {
+		return true
+	}
+
+	return uint32(m) != h.memory || uint32(t) != h.iterations || uint8(p) != h.parallelism ||
+		len(phc.Hash) != pwdKeyLength
+}
+
+func (h *Argon2idHasher) parse(encoded string) (phc *phcHash, m, t, p int, ok bool) {
+	phc, err := parsePHC(encoded)
+	if err != nil || phc.ID != h.ID() || phc.Version != argon2.Version || len(phc.Hash) == 0 {
+		return nil, 0, 0, 0, false
+	}
+
+	m, okM := phc.intParam("m")
+	t, okT := phc.intParam("t")
+	p, okP := phc.intParam("p")
+	if !okM || !okT || !okP || p > 255 {
+		return nil, 0, 0, 0, false
+	}
+
+	return phc, m, t, p, true
+}
+
+// ScryptHasher makes $scrypt$ln=<log2 N>,r=<block size>,p=<parallelism>
+// hashes, N=2^15 by default.
+type ScryptHasher struct {
+	logN int
+	r    int
+	p    int
+}
+
+func NewScryptHasher(logN, r, p int) *ScryptHasher {
+	if logN <= 1 || logN > 30 {
+		logN = 15
+	}
+	if r <= 0 {
+		r = 8
+	}
+	if p <= 0 {
+		p = 1
+	}
+
+	return &ScryptHasher{
+		logN: logN,
+		r:    r,
+		p:    p,
+	}
+}
+
+func (h *ScryptHasher) ID() string {
+	return "scrypt"
+}
+
+func (h *ScryptHasher) Hash(password string) (string, error) {
+	salt, err := newPwdSalt()
+	if err != nil {
+		return "", err
+	}
+
+	key, err := scrypt.Key([]byte(password), salt, 1<<h.logN, h.r, h.p, pwdKeyLength)
+	if err != nil {
+		return "", err
+	}
+	params := fmt.Sprintf("ln=%d,r=%d,p=%d", h.logN, h.r, h.p)
+
+	return formatPHC(h.ID(), 0, params, salt, key), nil
+}
+
+func (h *ScryptHasher) Verify(password, encoded string) bool {
+	phc, logN, r, p, ok := h.parse(encoded)
+	if !ok {
+		return false
+	}
+
+	key, err := scrypt.Key([]byte(password), phc.Salt, 1<<logN, r, p, len(phc.Hash))
+	if err != nil {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare(key, phc.Hash) == 1
+}
+
+func (h *ScryptHasher) Outdated(encoded string) bool {
+	phc, logN, r, p, ok := h.parse(encoded)
+	if !ok {
+		return true
+	}
+
+	return logN != h.logN || r != h.r || p != h.p || len(phc.Hash) != pwdKeyLength
+}
+
+func (h *ScryptHasher) parse(encoded string) (phc *phcHash, logN, r, p int, ok bool) {
+	phc, err := parsePHC(encoded)
+	if err != nil || phc.ID != h.ID() || len(phc.Hash) == 0 {
+		return nil, 0, 0, 0, false
+	}
+
+	logN, okN := phc.intParam("ln")
+	r, okR := phc.intParam("r")
+	p, okP := phc.intParam("p")
+	if !okN || !okR || !okP || logN > 30 {
+		return nil, 0, 0, 0, false
+	}
+
+	return phc, logN, r, p, true
+}
+
+// bcryptEncoding is bcrypt's own base64 alphabet, salt and hash are
+// re-encoded to standard base64 for the PHC string.
+var bcryptEncoding = base64.NewEncoding("./ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789").
+	WithPadding(base64.NoPadding)
+
+const (
+	bcryptSaltLength = 22
+	bcryptHashLength = 31
+)
+
+// BcryptHasher makes $bcrypt-sha256$r=<cost> hashes. The password is
+// hashed with SHA-256 first, bcrypt only reads 72 bytes of its input.
+// Plain bcrypt hashes ($2a$, $2b$, $2y$) made before are still verified
+// but always outdated.
+type BcryptHasher struct {
+	cost int
+}
+
+func NewBcryptHasher(cost int) *BcryptHasher {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		cost = bcrypt.DefaultCost
+	}
+
+	return &BcryptHasher{
+		cost: cost,
+	}
+}
+
+func (h *BcryptHasher) ID() string {
+	return "bcrypt-sha256"
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	mcf, err := bcrypt.GenerateFromPassword(bcryptPrehash(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+
+	// $2a$<cost>$<salt><hash>
+	fields := strings.Split(string(mcf), "$")
+	if len(fields) != 4 || len(fields[3]) != bcryptSaltLength+bcryptHashLength {
+		return "", fmt.Errorf("unexpected bcrypt hash")
+	}
+
+	salt, err := bcryptEncoding.DecodeString(fields[3][:bcryptSaltLength])
+	if err != nil {
+		return "", err
+	}
+	hash, err := bcryptEncoding.DecodeString(fields[3][bcryptSaltLength:])
+	if err != nil {
+		return "", err
+	}
+
+	return formatPHC(h.ID(), 0, fmt.Sprintf("r=%d", h.cost), salt, hash), nil
+}
+
+func (h *BcryptHasher) Verify(password, encoded string) bool {
+	if isBcryptMCF(encoded) {
+		return bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)) == nil
+	}
+
+	phc, cost, ok := h.parse(encoded)
+	if !ok {
+		return false
+	}
+
+	mcf := fmt.Sprintf(
+		"$2a$%02d$%s%s",
+		cost,
+		bcryptEncoding.EncodeToString(phc.Salt),
+		bcryptEncoding.EncodeToString(phc.Hash),
+	)
+
+	return bcrypt.CompareHashAndPassword([]byte(mcf), bcryptPrehash(password)) == nil
+}
+
+func (h *BcryptHasher) Outdated(encoded string) bool {
+	if isBcryptMCF(encoded) {
+		return true
+	}
+
+	_, cost, ok := h.parse(encoded)
+
+	return !ok || cost != h.cost
+}
+
+func (h *BcryptHasher) parse(encoded string) (phc *phcHash, cost int, ok bool) {
+	phc, err := parsePHC(encoded)
+	if err != nil || phc.ID != h.ID() {
+		return nil, 0, false
+	}
+
+	cost, ok = phc.intParam("r")
+	if !ok || cost > bcrypt.MaxCost ||
+		len(bcryptEncoding.EncodeToString(phc.Salt)) != bcryptSaltLength ||
+		len(bcryptEncoding.EncodeToString(phc.Hash)) != bcryptHashLength {
+		return nil, 0, false
+	}
+
+	return phc, cost, true
+}
+
+// bcryptPrehash is base64 of the SHA-256, bcrypt stops at a zero byte so
+// the raw digest can't be used.
+func bcryptPrehash(password string) []byte {
+	digest := sha256.Sum256([]byte(password))
+	return []byte(base64.StdEncoding.EncodeToString(digest[:]))
+}
+
+func isBcryptMCF(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") ||
+		strings.HasPrefix(encoded, "$2b$") ||
+		strings.HasPrefix(encoded, "$2y$")
+}
@@ -0,0 +1,227 @@
+package utils
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/kkonst40/isso/internal/config"
+)
+
+// cheap parameters, the tests only check the encoding
+var testPwdConfig = config.PasswordConfig{
+	Argon2Memory:      64,
+	Argon2Iterations:  1,
+	Argon2Parallelism: 1,
+	BcryptCost:        4,
+	ScryptLogN:        4,
+	ScryptR:           8,
+	ScryptP:           1,
+}
+
+func newTestPasswordHandler(t *testing.T, alg string) *PasswordHandler {
+	t.Helper()
+
+	cfg := testPwdConfig
+	cfg.Algorithm = alg
+	handler, err := NewPasswordHandler(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return handler
+}
+
+func TestPasswordHashVectors(t *testing.T) {
+	// RFC 7914 section 12, N=1024, r=8, p=16
+	scryptKey, err := hex.DecodeString("fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b373162" +
+		"2eaf30d92e22a3886ff109279d9830dac727afb94a83ee6d8360cbdfa2cc0640")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		encoded  string
+	}{
+		{
+			// the reference implementation's test suite
+			name:     "argon2id",
+			password: "password",
+			encoded:  "$argon2id$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc",
+		},
+		{
+			name:     "scrypt",
+			password: "password",
+			encoded:  formatPHC("scrypt", 0, "ln=10,r=8,p=16", []byte("NaCl"), scryptKey),
+		},
+		{
+			// made by this package, keeps the SHA-256 prehash stable
+			name:     "bcrypt-sha256",
+			password: "correct horse battery staple",
+			encoded:  "$bcrypt-sha256$r=4$b2IGd8k61hRxBkS5uE1FNw$6yYlU2fkpLWE0smFZYXVdkQFfzYf5t4",
+		},
+		{
+			// the Openwall crypt_blowfish test suite
+			name:     "legacy bcrypt",
+			password: "U*U",
+			encoded:  "$2a$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW",
+		},
+	}
+
+	handler := newTestPasswordHandler(t, "")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !handler.VerifyPwd(tt.password, tt.encoded) {
+				t.Fatal("known hash didn't verify")
+			}
+			if handler.VerifyPwd(tt.password+"x", tt.encoded) {
+				t.Fatal("wrong password verified")
+			}
+		})
+	}
+}
+
+func TestPasswordHandlerRoundTrip(t *testing.T) {
+	for _, alg := range []string{"argon2id", "bcrypt", "bcrypt-sha256", "scrypt"} {
+		t.Run(alg, func(t *testing.T) {
+			handler := newTestPasswordHandler(t, alg)
+
+			encoded, err := handler.GeneratePwdHash("secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !handler.VerifyPwd("secret", encoded) {
+				t.Fatalf("%q didn't verify", encoded)
+			}
+			if handler.VerifyPwd("Secret", encoded) {
+				t.Fatal("wrong password verified")
+			}
+			if handler.NeedsRehash(encoded) {
+				t.Fatal("fresh hash needs a rehash")
+			}
+		})
+	}
+}
+
+// bcrypt-sha256 has no 72 byte limit.
+func TestBcryptLongPassword(t *testing.T) {
+	handler := newTestPasswordHandler(t, "bcrypt")
+
+	long := string(make([]byte, 100))
+	encoded, err := handler.GeneratePwdHash(long + "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if handler.VerifyPwd(long+"b", encoded) {
+		t.Fatal("password differing after 72 bytes verified")
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	tests := []struct {
+		name   string
+		config func(cfg *config.PasswordConfig)
+		alg    string
+		// the configured algorithm, alg when empty
+		current string
+	}{
+		{name: "argon2id memory", alg: "argon2id", config: func(cfg *config.PasswordConfig) { cfg.Argon2Memory = 128 }},
+		{name: "argon2id iterations", alg: "argon2id", config: func(cfg *config.PasswordConfig) { cfg.Argon2Iterations = 2 }},
+		{name: "argon2id parallelism", alg: "argon2id", config: func(cfg *config.PasswordConfig) { cfg.Argon2Parallelism = 2 }},
+		{name: "bcrypt cost", alg: "bcrypt", config: func(cfg *config.PasswordConfig) { cfg.BcryptCost = 5 }},
+		{name: "scrypt cost", alg: "scrypt", config: func(cfg *config.PasswordConfig) { cfg.ScryptLogN = 5 }},
+		{name: "scrypt block size", alg: "scrypt", config: func(cfg *config.PasswordConfig) { cfg.ScryptR = 4 }},
+		{name: "other algorithm", alg: "scrypt", config: func(cfg *config.PasswordConfig) {}, current: "argon2id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := tt.current
+			if current == "" {
+				current = tt.alg
+			}
+			handler := newTestPasswordHandler(t, current)
+
+			cfg := testPwdConfig
+			cfg.Algorithm = tt.alg
+			tt.config(&cfg)
+			old, err := NewPasswordHandler(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			encoded, err := old.GeneratePwdHash("secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !handler.VerifyPwd("secret", encoded) {
+				t.Fatalf("%q didn't verify after the change", encoded)
+			}
+			if !handler.NeedsRehash(encoded) {
+				t.Fatalf("%q doesn't need a rehash", encoded)
+			}
+		})
+	}
+}
+
+func TestLegacyBcryptUpgrade(t *testing.T) {
+	const legacy = "$2a$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW"
+
+	for _, alg := range []string{"argon2id", "bcrypt"} {
+		t.Run(alg, func(t *testing.T) {
+			handler := newTestPasswordHandler(t, alg)
+
+			if !handler.VerifyPwd("U*U", legacy) {
+				t.Fatal("legacy hash didn't verify")
+			}
+			if !handler.NeedsRehash(legacy) {
+				t.Fatal("legacy hash doesn't need a rehash")
+			}
+
+			upgraded, err := handler.GeneratePwdHash("U*U")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !handler.VerifyPwd("U*U", upgraded) || handler.NeedsRehash(upgraded) {
+				t.Fatalf("upgraded hash %q isn't current", upgraded)
+			}
+		})
+	}
+}
+
+func TestMalformedPasswordHashes(t *testing.T) {
+	handler := newTestPasswordHandler(t, "")
+
+	for _, encoded := range []string{
+		"",
+		"plain",
+		"$",
+		"$unknown$c29tZXNhbHQ$aGFzaA",
+		"$argon2id$v=19$c29tZXNhbHQ$aGFzaA",
+		"$argon2id$v=18$m=64,t=1,p=1$c29tZXNhbHQ$aGFzaA",
+		"$argon2id$v=19$m=0,t=1,p=1$c29tZXNhbHQ$aGFzaA",
+		"$argon2id$v=19$m=64,t=-1,p=1$c29tZXNhbHQ$aGFzaA",
+		"$argon2id$v=19$m=64,t=1,p=256$c29tZXNhbHQ$aGFzaA",
+		"$argon2id$v=19$m=64,t=1,p=1$c29tZXNhbHQ$",
+		"$argon2id$v=19$m=64,t=1,p=1$$aGFzaA",
+		"$scrypt$ln=31,r=8,p=1$c29tZXNhbHQ$aGFzaA",
+		"$scrypt$ln=4,r=8$c29tZXNhbHQ$aGFzaA",
+		"$scrypt$ln=4,r=1073741824,p=8$c29tZXNhbHQ$aGFzaA",
+		"$bcrypt-sha256$r=4$c29tZXNhbHQ$aGFzaA",
+		"$bcrypt-sha256$r=1$b2IGd8k61hRxBkS5uE1FNw$6yYlU2fkpLWE0smFZYXVdkQFfzYf5t4",
+		"$bcrypt-sha256$r=32$b2IGd8k61hRxBkS5uE1FNw$6yYlU2fkpLWE0smFZYXVdkQFfzYf5t4",
+		"$bcrypt-sha256$b2IGd8k61hRxBkS5uE1FNw$6yYlU2fkpLWE0smFZYXVdkQFfzYf5t4",
+		"$2a$",
+		"$2a$05$",
+		"$2b$99$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW",
+		"$2y$05$CCCC",
+	} {
+		if handler.VerifyPwd("secret", encoded) {
+			t.Errorf("VerifyPwd(%q) succeeded", encoded)
+		}
+		if !handler.NeedsRehash(encoded) {
+			t.Errorf("NeedsRehash(%q) = false", encoded)
+		}
+	}
+}
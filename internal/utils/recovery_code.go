@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strings"
+)
+
+// recoveryCodeAlphabet has no look-alike characters, 32 symbols give
+// 50 bits per code.
+const (
+	recoveryCodeAlphabet = "23456789ABCDEFGHJKLMNPQRSTUVWXYZ"
+	recoveryCodeLength   = 10
+)
+
+// GenerateRecoveryCode returns a code formatted as XXXXX-XXXXX.
+func GenerateRecoveryCode() (string, error) {
+	max := big.NewInt(int64(len(recoveryCodeAlphabet)))
+
+	b := make([]byte, recoveryCodeLength)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = recoveryCodeAlphabet[n.Int64()]
+	}
+
+	return string(b[:recoveryCodeLength/2]) + "-" + string(b[recoveryCodeLength/2:]), nil
+}
+
+// NormalizeRecoveryCode drops dashes, spaces and case from a typed in code,
+// the hash is computed over the normalized form.
+func NormalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			r -= 'a' - 'A'
+		}
+		if !strings.ContainsRune(recoveryCodeAlphabet, r) {
+			return -1
+		}
+		return r
+	}, code)
+}
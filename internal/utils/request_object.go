@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// RequestObjectAlgorithms are the accepted request object signatures, the
+// client's keys are public so "none" and HMAC are excluded.
+var RequestObjectAlgorithms = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+// ParseRequestObject verifies a request object signed by the client and
+// returns its claims as authorization request parameters, RFC 9101 section 6.
+func ParseRequestObject(tokenString, clientID, audience string, keys JWKS) (url.Values, error) {
+	claims := jwt.MapClaims{}
+
+	keyFunc := func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		jwk, ok := keys.Key(kid)
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown kid %q", jwt.ErrTokenUnverifiable, kid)
+		}
+
+		if jwk.Alg != "" && jwk.Alg != token.Method.Alg() {
+			return nil, jwt.ErrSignatureInvalid
+		}
+
+		return jwk.PublicKey()
+	}
+
+	_, err := jwt.ParseWithClaims(
+		tokenString,
+		claims,
+		keyFunc,
+		jwt.WithValidMethods(RequestObjectAlgorithms),
+		jwt.WithIssuer(clientID),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if claimClientID, _ := claims["client_id"].(string); claimClientID != clientID {
+		return nil, errors.New("client_id mismatch")
+	}
+
+	params := url.Values{}
+	for name, value := range claims {
+		switch v := value.(type) {
+		case string:
+			params.Set(name, v)
+		case float64:
+			params.Set(name, strconv.FormatFloat(v, 'f', -1, 64))
+		}
+	}
+
+	// request objects can't refer to other requests
+	params.Del("request")
+	params.Del("request_uri")
+
+	return params, nil
+}
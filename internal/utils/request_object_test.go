@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testRequestClient   = "app"
+	testRequestAudience = "https://id.example.com"
+)
+
+func newTestRequestKey(t *testing.T, alg string) (*SigningKey, JWKS) {
+	t.Helper()
+
+	key, _, err := GenerateSigningKey(alg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwk, err := PublicJWK(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key, JWKS{Keys: []JWK{jwk}}
+}
+
+func requestObjectClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":           testRequestClient,
+		"aud":           testRequestAudience,
+		"exp":           time.Now().Add(time.Minute).Unix(),
+		"client_id":     testRequestClient,
+		"response_type": "code",
+		"redirect_uri":  "https://app.example.com/callback",
+		"scope":         "openid profile",
+		"max_age":       300,
+		"request_uri":   "urn:ietf:params:oauth:request_uri:nested",
+	}
+}
+
+func TestParseRequestObject(t *testing.T) {
+	key, keys := newTestRequestKey(t, "ES256")
+
+	requestObject, err := signWith(key, requestObjectClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params, err := ParseRequestObject(requestObject, testRequestClient, testRequestAudience, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{
+		"client_id":     testRequestClient,
+		"response_type": "code",
+		"scope":         "openid profile",
+		"max_age":       "300",
+	} {
+		if got := params.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if params.Has("request_uri") {
+		t.Error("request object can refer to another request")
+	}
+}
+
+func TestParseRequestObjectRejects(t *testing.T) {
+	key, keys := newTestRequestKey(t, "ES256")
+	other, _ := newTestRequestKey(t, "ES256")
+
+	hmacKey, err := NewHMACKey("HS256", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		key    *SigningKey
+		claims func(claims jwt.MapClaims)
+	}{
+		{name: "another client's key", key: other},
+		{name: "HMAC", key: hmacKey},
+		{name: "other issuer", key: key, claims: func(c jwt.MapClaims) { c["iss"] = "other" }},
+		{name: "other client_id", key: key, claims: func(c jwt.MapClaims) { c["client_id"] = "other" }},
+		{name: "other audience", key: key, claims: func(c jwt.MapClaims) { c["aud"] = "https://other.example.com" }},
+		{name: "no exp", key: key, claims: func(c jwt.MapClaims) { delete(c, "exp") }},
+		{name: "expired", key: key, claims: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := requestObjectClaims()
+			if tt.claims != nil {
+				tt.claims(claims)
+			}
+
+			requestObject, err := signWith(tt.key, claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := ParseRequestObject(requestObject, testRequestClient, testRequestAudience, keys); err == nil {
+				t.Fatal("request object accepted")
+			}
+		})
+	}
+
+	t.Run("unsigned", func(t *testing.T) {
+		requestObject, err := jwt.NewWithClaims(jwt.SigningMethodNone, requestObjectClaims()).
+			SignedString(jwt.UnsafeAllowNoneSignatureType)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := ParseRequestObject(requestObject, testRequestClient, testRequestAudience, keys); err == nil {
+			t.Fatal("request object accepted")
+		}
+	})
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"slices"
+	"strings"
+)
+
+const (
+	ScopeOpenID        = "openid"
+	ScopeProfile       = "profile"
+	ScopeEmail         = "email"
+	ScopeOfflineAccess = "offline_access"
+	ScopeUsersRead     = "users:read"
+)
+
+// UserScopes can be requested on behalf of a user and need the user's consent.
+var UserScopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail, ScopeOfflineAccess}
+
+func HasScope(scope, want string) bool {
+	return slices.Contains(strings.Fields(scope), want)
+}
+
+// ScopeSubset reports whether every scope in requested is in allowed.
+func ScopeSubset(requested string, allowed []string) bool {
+	for _, scope := range strings.Fields(requested) {
+		if !slices.Contains(allowed, scope) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func Scopes(scope string) []string {
+	return strings.Fields(scope)
+}
@@ -0,0 +1,219 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	// []byte for HMAC, crypto.Signer for asymmetric methods
+	Private any
+	// []byte for HMAC, crypto.PublicKey for asymmetric methods
+	Public any
+	// zero values mean no restriction
+	NotBefore time.Time
+	RetireAt  time.Time
+}
+
+func (k *SigningKey) Symmetric() bool {
+	_, ok := k.Private.([]byte)
+	return ok
+}
+
+func (k *SigningKey) Active(now time.Time) bool {
+	return k.RetireAt.IsZero() || now.Before(k.RetireAt)
+}
+
+// GenerateSigningKey creates a new key for the method and returns it together
+// with its serialized form: the raw secret for HMAC, PKCS #8 DER otherwise.
+func GenerateSigningKey(alg string) (*SigningKey, []byte, error) {
+	var signer crypto.Signer
+	var err error
+
+	switch method := jwt.GetSigningMethod(alg).(type) {
+	case *jwt.SigningMethodHMAC:
+		secret := make([]byte, method.Hash.Size())
+		if _, err := rand.Read(secret); err != nil {
+			return nil, nil, err
+		}
+		key, err := NewHMACKey(alg, secret)
+		return key, secret, err
+	case *jwt.SigningMethodRSA:
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	case *jwt.SigningMethodRSAPSS:
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	case *jwt.SigningMethodECDSA:
+		var curve elliptic.Curve
+		switch method.CurveBits {
+		case 256:
+			curve = elliptic.P256()
+		case 384:
+			curve = elliptic.P384()
+		default:
+			curve = elliptic.P521()
+		}
+		signer, err = ecdsa.GenerateKey(curve, rand.Reader)
+	case *jwt.SigningMethodEd25519:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, nil, fmt.Errorf("unsupported signing method: %s", alg)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := NewAsymmetricKey(alg, "", signer)
+	return key, der, err
+}
+
+// ParseSigningKey is the reverse of GenerateSigningKey.
+func ParseSigningKey(alg, kid string, data []byte) (*SigningKey, error) {
+	if _, ok := jwt.GetSigningMethod(alg).(*jwt.SigningMethodHMAC); ok {
+		key, err := NewHMACKey(alg, data)
+		if err != nil {
+			return nil, err
+		}
+		key.ID = kid
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(data)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported private key type")
+	}
+
+	return NewAsymmetricKey(alg, kid, signer)
+}
+
+func NewHMACKey(alg string, secret []byte) (*SigningKey, error) {
+	method, ok := jwt.GetSigningMethod(alg).(*jwt.SigningMethodHMAC)
+	if !ok {
+		return nil, fmt.Errorf("unsupported HMAC signing method: %s", alg)
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("empty HMAC secret")
+	}
+
+	sum := sha256.Sum256(secret)
+
+	return &SigningKey{
+		ID:      "hs-" + hex.EncodeToString(sum[:8]),
+		Method:  method,
+		Private: secret,
+		Public:  secret,
+	}, nil
+}
+
+func NewAsymmetricKey(alg, kid string, signer crypto.Signer) (*SigningKey, error) {
+	method := jwt.GetSigningMethod(alg)
+	if method == nil {
+		return nil, fmt.Errorf("unsupported signing method: %s", alg)
+	}
+
+	if err := checkKeyType(method, signer); err != nil {
+		return nil, err
+	}
+
+	key := &SigningKey{
+		ID:      kid,
+		Method:  method,
+		Private: signer,
+		Public:  signer.Public(),
+	}
+
+	if key.ID == "" {
+		jwk, err := PublicJWK(key)
+		if err != nil {
+			return nil, err
+		}
+		key.ID, err = jwk.Thumbprint()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return key, nil
+}
+
+func LoadAsymmetricKey(alg, kid, pemPath string) (*SigningKey, error) {
+	data, err := os.ReadFile(pemPath)
+	if err != nil {
+		return nil, fmt.Errorf("signing key reading error: %w", err)
+	}
+
+	signer, err := ParsePrivateKeyPEM(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewAsymmetricKey(alg, kid, signer)
+}
+
+func ParsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("signing key is not PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("unsupported private key type")
+		}
+		return signer, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	return nil, errors.New("unsupported private key format")
+}
+
+func checkKeyType(method jwt.SigningMethod, signer crypto.Signer) error {
+	var ok bool
+	switch method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		_, ok = signer.(*rsa.PrivateKey)
+	case *jwt.SigningMethodECDSA:
+		var key *ecdsa.PrivateKey
+		key, ok = signer.(*ecdsa.PrivateKey)
+		ok = ok && key.Curve.Params().BitSize == method.(*jwt.SigningMethodECDSA).CurveBits
+	case *jwt.SigningMethodEd25519:
+		_, ok = signer.(ed25519.PrivateKey)
+	}
+
+	if !ok {
+		return fmt.Errorf("private key does not match signing method %s", method.Alg())
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type tokenIDEntry struct {
+	tokenID   uuid.UUID
+	expiresAt time.Time
+}
+
+// TokenIDCache keeps recently looked up user TokenIDs so that every
+// authenticated request does not have to hit the database.
+type TokenIDCache struct {
+	mu      sync.RWMutex
+	ttl     time.Duration
+	entries map[uuid.UUID]tokenIDEntry
+	// bumped by every Invalidate, a lookup that started before one must
+	// not write back the TokenID it read
+	generation uint64
+}
+
+func NewTokenIDCache(ttl time.Duration) *TokenIDCache {
+	return &TokenIDCache{
+		ttl:     ttl,
+		entries: make(map[uuid.UUID]tokenIDEntry),
+	}
+}
+
+func (c *TokenIDCache) Get(userID uuid.UUID) (uuid.UUID, bool) {
+	c.mu.RLock()
+	entry, ok := c.entries[userID]
+	c.mu.RUnlock()
+
+	if !ok {
+		return uuid.UUID{}, false
+	}
+
+	if time.Now().After(entry.expiresAt) {
+		c.mu.Lock()
+		if entry, ok := c.entries[userID]; ok && time.Now().After(entry.expiresAt) {
+			delete(c.entries, userID)
+		}
+		c.mu.Unlock()
+		return uuid.UUID{}, false
+	}
+
+	return entry.tokenID, true
+}
+
+// Generation is taken before looking up a TokenID and passed to Set.
+func (c *TokenIDCache) Generation() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.generation
+}
+
+// Set caches the TokenID unless the cache was invalidated since generation
+// was taken, the value may be stale then.
+func (c *TokenIDCache) Set(userID, tokenID uuid.UUID, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	c.entries[userID] = tokenIDEntry{
+		tokenID:   tokenID,
+		expiresAt: time.Now().Add(c.ttl),
+	}
+}
+
+func (c *TokenIDCache) Invalidate(userID uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, userID)
+	c.generation++
+}
+
+type familyEntry struct {
+	revoked   bool
+	expiresAt time.Time
+}
+
+// FamilyCache keeps recently looked up revocation states of refresh token
+// families, access tokens carry their family as jti. Revocation is final,
+// so a stale lookup never turns a revoked family back into a live one.
+type FamilyCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[uuid.UUID]familyEntry
+}
+
+func NewFamilyCache(ttl time.Duration) *FamilyCache {
+	return &FamilyCache{
+		ttl:     ttl,
+		entries: make(map[uuid.UUID]familyEntry),
+	}
+}
+
+func (c *FamilyCache) Get(familyID uuid.UUID) (revoked bool, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[familyID]
+	if !ok {
+		return false, false
+	}
+
+	if time.Now().After(entry.expiresAt) {
+		delete(c.entries, familyID)
+		return false, false
+	}
+
+	return entry.revoked, true
+}
+
+func (c *FamilyCache) Set(familyID uuid.UUID, revoked bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.entries[familyID]; ok && entry.revoked {
+		revoked = true
+	}
+
+	c.entries[familyID] = familyEntry{
+		revoked:   revoked,
+		expiresAt: time.Now().Add(c.ttl),
+	}
+}
@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestFamilyCacheKeepsRevocation(t *testing.T) {
+	cache := NewFamilyCache(time.Minute)
+	familyID := uuid.New()
+
+	if _, ok := cache.Get(familyID); ok {
+		t.Fatal("empty cache returned an entry")
+	}
+
+	cache.Set(familyID, true)
+	// a lookup that started before the revocation finishes late
+	cache.Set(familyID, false)
+
+	revoked, ok := cache.Get(familyID)
+	if !ok || !revoked {
+		t.Fatalf("got revoked=%v ok=%v, want the family revoked", revoked, ok)
+	}
+}
+
+func TestFamilyCacheExpires(t *testing.T) {
+	cache := NewFamilyCache(-time.Second)
+	familyID := uuid.New()
+
+	cache.Set(familyID, false)
+	if _, ok := cache.Get(familyID); ok {
+		t.Fatal("expired entry returned")
+	}
+}
+
+func TestTokenIDCacheDropsStaleSet(t *testing.T) {
+	cache := NewTokenIDCache(time.Minute)
+	userID := uuid.New()
+	oldTokenID := uuid.New()
+
+	// a lookup reads the old TokenID, then the password changes
+	generation := cache.Generation()
+	cache.Invalidate(userID)
+	cache.Set(userID, oldTokenID, generation)
+
+	if tokenID, ok := cache.Get(userID); ok {
+		t.Fatalf("stale TokenID %s cached after invalidation", tokenID)
+	}
+
+	newTokenID := uuid.New()
+	cache.Set(userID, newTokenID, cache.Generation())
+	if tokenID, ok := cache.Get(userID); !ok || tokenID != newTokenID {
+		t.Fatalf("got %s ok=%v, want %s", tokenID, ok, newTokenID)
+	}
+}
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// the SHA-1 seed of RFC 4226 and RFC 6238
+var rfcTOTPSecret = []byte("12345678901234567890")
+
+// RFC 4226 Appendix D.
+func TestHOTPVectors(t *testing.T) {
+	want := []string{
+		"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489",
+	}
+
+	for counter, code := range want {
+		if got := totpCode(rfcTOTPSecret, int64(counter)); got != code {
+			t.Errorf("counter %d: got %s, want %s", counter, got, code)
+		}
+	}
+}
+
+// RFC 6238 Appendix B, SHA-1. The RFC lists 8 digit codes, a 6 digit code
+// is their last 6 digits.
+func TestTOTPVectors(t *testing.T) {
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{unix: 59, code: "94287082"},
+		{unix: 1111111109, code: "07081804"},
+		{unix: 1111111111, code: "14050471"},
+		{unix: 1234567890, code: "89005924"},
+		{unix: 2000000000, code: "69279037"},
+		{unix: 20000000000, code: "65353130"},
+	}
+
+	for _, tt := range tests {
+		now := time.Unix(tt.unix, 0)
+		code := tt.code[len(tt.code)-totpDigits:]
+
+		step, ok := ValidateTOTP(rfcTOTPSecret, code, now)
+		if !ok {
+			t.Errorf("%d: %s rejected", tt.unix, code)
+			continue
+		}
+		if step != tt.unix/totpPeriod {
+			t.Errorf("%d: step %d, want %d", tt.unix, step, tt.unix/totpPeriod)
+		}
+	}
+}
+
+func TestValidateTOTPWindow(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := now.Unix() / totpPeriod
+
+	for offset := int64(-3); offset <= 3; offset++ {
+		code := totpCode(rfcTOTPSecret, current+offset)
+		step, ok := ValidateTOTP(rfcTOTPSecret, code, now)
+
+		inWindow := offset >= -totpSkew && offset <= totpSkew
+		if ok != inWindow {
+			t.Errorf("offset %d: ok = %v, want %v", offset, ok, inWindow)
+		}
+		if ok && step != current+offset {
+			t.Errorf("offset %d: step %d, want %d", offset, step, current+offset)
+		}
+	}
+}
+
+func TestValidateTOTPMalformed(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+
+	for _, code := range []string{"", "5924", "89005924", "005924 ", " 05924", "abcdef"} {
+		if _, ok := ValidateTOTP(rfcTOTPSecret, code, now); ok {
+			t.Errorf("%q accepted", code)
+		}
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("isso", "alice", rfcTOTPSecret)
+
+	for _, part := range []string{
+		"otpauth://totp/isso:alice?",
+		"secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+		"issuer=isso",
+		"digits=6",
+		"period=30",
+	} {
+		if !strings.Contains(uri, part) {
+			t.Errorf("%s doesn't contain %s", uri, part)
+		}
+	}
+}
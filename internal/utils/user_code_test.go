@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUserCodeRoundTrip(t *testing.T) {
+	code, err := GenerateUserCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(code) != userCodeLength || NormalizeUserCode(code) != code {
+		t.Fatalf("generated code %q is not normalized", code)
+	}
+
+	typed := strings.ToLower(FormatUserCode(code))
+	if got := NormalizeUserCode(" " + typed + " "); got != code {
+		t.Fatalf("NormalizeUserCode(%q) = %q, want %q", typed, got, code)
+	}
+}
+
+func TestNormalizeUserCode(t *testing.T) {
+	tests := []struct {
+		typed string
+		want  string
+	}{
+		{typed: "BCDF-GHJK", want: "BCDFGHJK"},
+		{typed: "bcdf ghjk", want: "BCDFGHJK"},
+		// vowels and digits are not in the alphabet
+		{typed: "BCDF-GHJ0", want: "BCDFGHJ"},
+		{typed: "AEIOU", want: ""},
+		// Cyrillic look-alikes
+		{typed: "ВСDF", want: "DF"},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeUserCode(tt.typed); got != tt.want {
+			t.Errorf("NormalizeUserCode(%q) = %q, want %q", tt.typed, got, tt.want)
+		}
+	}
+}
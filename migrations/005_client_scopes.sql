@@ -0,0 +1,2 @@
+-- scopes a client may request for itself with the client_credentials grant
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS scopes TEXT[] NOT NULL DEFAULT '{}';
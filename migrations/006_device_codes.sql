@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS device_codes (
+    device_code_hash TEXT PRIMARY KEY,
+    user_code        TEXT NOT NULL UNIQUE,
+    client_id        TEXT NOT NULL REFERENCES oauth_clients (id) ON DELETE CASCADE,
+    scope            TEXT NOT NULL DEFAULT '',
+    user_id          UUID REFERENCES users (id) ON DELETE CASCADE,
+    poll_interval    INTEGER NOT NULL,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at       TIMESTAMPTZ NOT NULL,
+    last_polled_at   TIMESTAMPTZ,
+    approved_at      TIMESTAMPTZ,
+    denied_at        TIMESTAMPTZ,
+    used_at          TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS device_codes_expires_at_idx ON device_codes (expires_at);
@@ -0,0 +1,2 @@
+-- audiences a client may exchange user tokens into, RFC 8693
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS exchange_audiences TEXT[] NOT NULL DEFAULT '{}';
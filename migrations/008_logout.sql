@@ -0,0 +1,16 @@
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS post_logout_redirect_uris TEXT[] NOT NULL DEFAULT '{}';
+-- empty means the client doesn't want back-channel logout notifications
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS backchannel_logout_uri TEXT NOT NULL DEFAULT '';
+
+-- back-channel logout deliveries waiting for a (re)try
+CREATE TABLE IF NOT EXISTS logout_notifications (
+    id              UUID PRIMARY KEY,
+    client_id       TEXT NOT NULL REFERENCES oauth_clients (id) ON DELETE CASCADE,
+    user_id         UUID NOT NULL,
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    last_error      TEXT NOT NULL DEFAULT '',
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS logout_notifications_next_attempt_at_idx ON logout_notifications (next_attempt_at);
@@ -0,0 +1,10 @@
+-- scopes each user approved for a client, the consent page is skipped
+-- while a grant covers the requested scopes
+CREATE TABLE IF NOT EXISTS consent_grants (
+    user_id    UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    client_id  TEXT NOT NULL REFERENCES oauth_clients (id) ON DELETE CASCADE,
+    scopes     TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, client_id)
+);
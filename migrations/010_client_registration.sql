@@ -0,0 +1,9 @@
+-- admin-issued bearer tokens allowing dynamic client registration, RFC 7591
+CREATE TABLE IF NOT EXISTS initial_access_tokens (
+    token_hash TEXT PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+-- empty for clients created by an admin, they can't be managed through RFC 7592
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS registration_token_hash TEXT NOT NULL DEFAULT '';
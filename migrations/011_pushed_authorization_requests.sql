@@ -0,0 +1,14 @@
+-- RFC 9126, the parameters are kept url-encoded as the client pushed them
+CREATE TABLE IF NOT EXISTS pushed_authorization_requests (
+    request_uri_hash TEXT PRIMARY KEY,
+    client_id        TEXT NOT NULL REFERENCES oauth_clients (id) ON DELETE CASCADE,
+    params           TEXT NOT NULL,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at       TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS pushed_authorization_requests_expires_at_idx ON pushed_authorization_requests (expires_at);
+
+-- JWK Set verifying the client's signed request objects, RFC 9101
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS jwks TEXT NOT NULL DEFAULT '';
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS require_pushed_authorization_requests BOOLEAN NOT NULL DEFAULT false;
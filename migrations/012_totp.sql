@@ -0,0 +1,18 @@
+-- the secret is encrypted with the MFA encryption key, see utils.SecretBox
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id          UUID PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    secret_encrypted TEXT NOT NULL,
+    -- NULL until the user confirms the enrollment with a first code
+    confirmed_at     TIMESTAMPTZ,
+    -- codes of this time step and earlier can't be used again
+    last_used_step   BIGINT NOT NULL DEFAULT 0,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- wrong second factor codes of a user, every kind of code counts against
+-- the same lockout
+CREATE TABLE IF NOT EXISTS mfa_lockouts (
+    user_id         UUID PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    failed_attempts INTEGER NOT NULL DEFAULT 0,
+    locked_until    TIMESTAMPTZ
+);
@@ -0,0 +1,22 @@
+-- passkeys and security keys, data is the go-webauthn Credential as JSON
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+    id           BYTEA PRIMARY KEY,
+    user_id      UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name         TEXT NOT NULL DEFAULT '',
+    data         JSONB NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_used_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS webauthn_credentials_user_id_idx ON webauthn_credentials (user_id);
+
+-- challenges of running ceremonies, user_id is NULL for a passwordless login
+-- where the user is only known from the assertion
+CREATE TABLE IF NOT EXISTS webauthn_sessions (
+    session_hash TEXT PRIMARY KEY,
+    user_id      UUID REFERENCES users (id) ON DELETE CASCADE,
+    data         JSONB NOT NULL,
+    expires_at   TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS webauthn_sessions_expires_at_idx ON webauthn_sessions (expires_at);
@@ -0,0 +1,23 @@
+-- how the user authenticated when the session started, refreshes keep it
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS auth_time TIMESTAMPTZ;
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS amr TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS acr TEXT NOT NULL DEFAULT '';
+
+-- older sessions count from the first token of their family
+UPDATE refresh_tokens r
+SET auth_time = f.started_at
+FROM (SELECT family_id, min(created_at) AS started_at FROM refresh_tokens GROUP BY family_id) f
+WHERE r.family_id = f.family_id AND r.auth_time IS NULL;
+
+ALTER TABLE refresh_tokens ALTER COLUMN auth_time SET NOT NULL;
+
+ALTER TABLE authorization_codes ADD COLUMN IF NOT EXISTS auth_time TIMESTAMPTZ;
+ALTER TABLE authorization_codes ADD COLUMN IF NOT EXISTS amr TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE authorization_codes ADD COLUMN IF NOT EXISTS acr TEXT NOT NULL DEFAULT '';
+UPDATE authorization_codes SET auth_time = created_at WHERE auth_time IS NULL;
+ALTER TABLE authorization_codes ALTER COLUMN auth_time SET NOT NULL;
+
+-- NULL until the user approves the code
+ALTER TABLE device_codes ADD COLUMN IF NOT EXISTS auth_time TIMESTAMPTZ;
+ALTER TABLE device_codes ADD COLUMN IF NOT EXISTS amr TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE device_codes ADD COLUMN IF NOT EXISTS acr TEXT NOT NULL DEFAULT '';
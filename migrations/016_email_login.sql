@@ -0,0 +1,22 @@
+-- a login by the link or the code sent to the user's verified email, see
+-- 017_email_verification.sql for the address itself, single-use
+CREATE TABLE IF NOT EXISTS email_login_challenges (
+    id         UUID PRIMARY KEY,
+    user_id    UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash  TEXT NOT NULL,
+    attempts   INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS email_login_challenges_user_id_idx ON email_login_challenges (user_id, created_at);
+CREATE INDEX IF NOT EXISTS email_login_challenges_expires_at_idx ON email_login_challenges (expires_at);
+
+-- wrong codes of a user, counted across challenges so that asking for a
+-- new code doesn't give more guesses
+CREATE TABLE IF NOT EXISTS email_login_lockouts (
+    user_id         UUID PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    failed_attempts INTEGER NOT NULL DEFAULT 0,
+    locked_until    TIMESTAMPTZ
+);